@@ -76,6 +76,174 @@ const envSchema = z.object({
     .transform((val) => val === "true" || val === "1")
     .default("false"),
   LOG_STORAGE_PATH: z.string().optional(),
+  RECORDING_REQUIRE_CONSENT: z
+    .string()
+    .optional()
+    .transform((val) => val === "true" || val === "1")
+    .default("false"),
+  FILE_URL_SIGNING_SECRET: z.string().optional(),
+  REQUIRE_SIGNED_FILE_URLS: z
+    .string()
+    .optional()
+    .transform((val) => val === "true" || val === "1")
+    .default("false"),
+  LIVE_VIEW_ENSURE_FOCUS: z
+    .string()
+    .optional()
+    .transform((val) => val === "true" || val === "1")
+    .default("false"),
+  API_KEY: z.string().optional(),
+  LIVE_VIEW_JWT_SECRET: z.string().optional(),
+  LIVE_VIEW_JWT_JWKS_URL: z.string().optional(),
+  LIVE_VIEW_JWT_AUDIENCE: z.string().optional(),
+  LIVE_VIEW_JWT_ISSUER: z.string().optional(),
+  AUTHORIZER: z
+    .string()
+    .optional()
+    .transform((val) => (val ? val.split(",").map((kind) => kind.trim()) : []))
+    .default(""),
+  AUTHORIZER_URL: z.string().optional(),
+  AUTHORIZER_TIMEOUT_MS: z
+    .string()
+    .optional()
+    .default("2000")
+    .transform((val) => parseInt(val, 10) || 2000),
+  AUTHORIZER_CACHE_MS: z
+    .string()
+    .optional()
+    .default("5000")
+    .transform((val) => parseInt(val, 10) || 5000),
+  DLP_URL: z.string().optional(),
+  DLP_PAYLOAD: z.enum(["metadata", "hash", "content"]).default("hash"),
+  DLP_MAX_CONTENT_BYTES: z
+    .string()
+    .optional()
+    .default("1048576")
+    .transform((val) => parseInt(val, 10) || 1048576),
+  DLP_TIMEOUT_MS: z
+    .string()
+    .optional()
+    .default("5000")
+    .transform((val) => parseInt(val, 10) || 5000),
+  DLP_FAIL_OPEN: z
+    .string()
+    .optional()
+    .transform((val) => val === "true" || val === "1")
+    .default("false"),
+  LIVE_VIEW_TOKEN_TTL_MS: z
+    .string()
+    .optional()
+    .default("43200000")
+    .transform((val) => parseInt(val, 10) || 43200000),
+  LIVE_VIEW_RESUME_GRACE_MS: z
+    .string()
+    .optional()
+    .default("30000")
+    .transform((val) => parseInt(val, 10) || 0),
+  LIVE_VIEW_PING_INTERVAL_MS: z
+    .string()
+    .optional()
+    .default("30000")
+    .transform((val) => parseInt(val, 10) || 30000),
+  LIVE_VIEW_MAX_MISSED_PONGS: z
+    .string()
+    .optional()
+    .default("2")
+    .transform((val) => parseInt(val, 10) || 2),
+  LIVE_VIEW_INPUT_CONCURRENCY: z
+    .string()
+    .optional()
+    .default("4")
+    .transform((val) => parseInt(val, 10) || 4),
+  LIVE_VIEW_INPUT_QUEUE_SIZE: z
+    .string()
+    .optional()
+    .default("256")
+    .transform((val) => parseInt(val, 10) || 256),
+  LIVE_VIEW_INPUT_TIMEOUT_MS: z
+    .string()
+    .optional()
+    .default("5000")
+    .transform((val) => parseInt(val, 10) || 5000),
+  LIVE_VIEW_MOUSE_MOVE_INTERVAL_MS: z
+    .string()
+    .optional()
+    .default("16")
+    .transform((val) => parseInt(val, 10) || 0),
+  LIVE_VIEW_INPUT_RATE_LIMIT: z
+    .string()
+    .optional()
+    .default("200")
+    .transform((val) => parseInt(val, 10) || 0),
+  LIVE_VIEW_COMMAND_TIMEOUT_MS: z
+    .string()
+    .optional()
+    .default("10000")
+    .transform((val) => parseInt(val, 10) || 10000),
+  LIVE_VIEW_MAX_UPLOAD_BYTES: z
+    .string()
+    .optional()
+    .default("104857600")
+    .transform((val) => parseInt(val, 10) || 104857600),
+  LIVE_VIEW_HISTORY_RETENTION_MS: z
+    .string()
+    .optional()
+    .default("3600000")
+    .transform((val) => parseInt(val, 10) || 3600000),
+  SCRATCH_DIR: z.string().optional(),
+  SCRATCH_MAX_AGE_MS: z
+    .string()
+    .optional()
+    .default("86400000")
+    .transform((val) => parseInt(val, 10) || 86400000),
+  MAX_VIEWERS: z
+    .string()
+    .optional()
+    .default("0")
+    .transform((val) => parseInt(val, 10) || 0),
+  WEBHOOK_URLS: z
+    .string()
+    .optional()
+    .transform((val) => (val ? val.split(",").map((url) => url.trim()) : []))
+    .default(""),
+  WEBHOOK_EVENTS: z
+    .string()
+    .optional()
+    .transform((val) => (val ? val.split(",").map((event) => event.trim()) : []))
+    .default(""),
+  WEBHOOK_SECRET: z.string().optional(),
+  FEATURE_FLAGS: z.string().optional(),
+  FEATURE_FLAGS_FILE: z.string().optional(),
+  WEBSOCKET_COMPRESSION: z
+    .string()
+    .optional()
+    .transform((val) => val === "true" || val === "1")
+    .default("false"),
+  CRASH_REPORT_DIR: z.string().optional(),
+  THUMBNAIL_INTERVAL_MS: z
+    .string()
+    .optional()
+    .default("0")
+    .transform((val) => parseInt(val, 10) || 0),
+  THUMBNAIL_WIDTH: z
+    .string()
+    .optional()
+    .default("320")
+    .transform((val) => parseInt(val, 10) || 320),
+  USAGE_RETENTION_DAYS: z
+    .string()
+    .optional()
+    .default("31")
+    .transform((val) => parseInt(val, 10) || 31),
+  USAGE_EXPORT_DIR: z.string().optional(),
+  USAGE_EXPORT_FORMAT: z.enum(["json", "csv"]).default("json"),
+  SELFTEST_PROBE: z
+    .string()
+    .optional()
+    .transform((val) => val === "true" || val === "1")
+    .default("false"),
+  BUILD_GIT_SHA: z.string().optional(),
+  BUILD_DATE: z.string().optional(),
   DISABLE_CHROME_SANDBOX: z
     .string()
     .optional()
@@ -5,6 +5,10 @@ import steelBrowserPlugin from "./steel-browser-plugin.js";
 import uiPlugin from "./plugins/ui-plugin.js";
 import { loggingConfig } from "./config.js";
 import { MB } from "./utils/size.js";
+import { getBuildInfo } from "./utils/build-info.js";
+import { runSelfTest } from "./utils/self-test.js";
+import { exitOnFatalError, installFatalErrorHandlers } from "./utils/fatal.js";
+import { env } from "./env.js";
 import path from "node:path";
 
 const HOST = process.env.HOST ?? "0.0.0.0";
@@ -36,13 +40,25 @@ const setupServer = async () => {
   });
 };
 
+const fatalErrorOptions = { config: env, directory: env.CRASH_REPORT_DIR };
+
 const startServer = async () => {
+  installFatalErrorHandlers(server.log, fatalErrorOptions);
   try {
     await setupServer();
     await server.listen({ port: PORT, host: HOST });
+    server.log.info(getBuildInfo(), "Steel Browser API started");
+
+    const { checks } = await runSelfTest({ probe: env.SELFTEST_PROBE });
+    for (const check of checks) {
+      if (check.status === "fail") {
+        server.log.error({ check: check.name }, check.message);
+      } else if (check.status === "warn") {
+        server.log.warn({ check: check.name }, check.message);
+      }
+    }
   } catch (err) {
-    server.log.error(err);
-    process.exit(1);
+    exitOnFatalError(server.log, "startupFailed", err, fatalErrorOptions);
   }
 };
 
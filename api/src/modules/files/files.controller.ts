@@ -6,13 +6,17 @@ import * as fs from "fs";
 import http from "http";
 import https from "https";
 import mime from "mime-types";
-import { tmpdir } from "os";
 import path from "path";
 import { Readable } from "stream";
 import { pipeline } from "stream/promises";
 import { v4 as uuidv4 } from "uuid";
+import { env } from "../../env.js";
+import { DLP_DENIED_MESSAGE, DlpTransfer } from "../../services/dlp.service.js";
 import { FileService } from "../../services/file.service.js";
 import { getErrors } from "../../utils/errors.js";
+import { signFileClaims, verifyFileSignature } from "../../utils/signing.js";
+import { getUrl } from "../../utils/url.js";
+import { SignedFileQuery, SignedFileUrlRequest } from "./files.schema.js";
 
 export class FilesController {
   constructor(private fileService: FileService) {}
@@ -38,6 +42,25 @@ export class FilesController {
     return true;
   }
 
+  /**
+   * Asks the DLP endpoint about a file before it enters or leaves the session
+   * @returns the reason the transfer was blocked, or null if it may proceed
+   */
+  private async checkDlp(
+    server: FastifyInstance,
+    transfer: DlpTransfer,
+    openStream: () => Readable | Promise<Readable>,
+  ): Promise<string | null> {
+    if (!server.dlp.isEnabled()) {
+      return null;
+    }
+    const decision = await server.dlp.checkFile(
+      { mimeType: mime.lookup(transfer.fileName ?? "") || undefined, ...transfer },
+      await openStream(),
+    );
+    return decision.allowed ? null : (decision.reason ?? DLP_DENIED_MESSAGE);
+  }
+
   async handleFileUpload(
     server: FastifyInstance,
     request: FastifyRequest<{ Params: { sessionId: string } }>,
@@ -64,7 +87,10 @@ export class FilesController {
             const file = part as MultipartFile;
             fileProvided = true;
 
-            tempFilePath = path.join(tmpdir(), `upload_${uuidv4()}`);
+            tempFilePath = path.join(
+              await server.sessionService.scratch.directory(server.sessionService.activeSession.id),
+              `upload_${uuidv4()}`,
+            );
 
             const writeStream = fs.createWriteStream(tempFilePath);
             await pipeline(file.file, writeStream);
@@ -104,6 +130,18 @@ export class FilesController {
           finalPath = filePath;
         }
 
+        const uploadedPath = tempFilePath;
+        const dlpDenied = await this.checkDlp(
+          server,
+          { action: "upload", sessionId: request.params.sessionId, fileName: finalPath },
+          () => fs.createReadStream(uploadedPath),
+        );
+        if (dlpDenied) {
+          await fs.promises.unlink(tempFilePath).catch(() => {});
+          tempFilePath = null;
+          return reply.code(403).send({ success: false, message: dlpDenied });
+        }
+
         const readStream = fs.createReadStream(tempFilePath);
         saveFileResult = await this.fileService.saveFile({
           filePath: finalPath,
@@ -129,10 +167,37 @@ export class FilesController {
         }
 
         const { stream } = await this.createStreamFromUrl(fileUrl);
-        saveFileResult = await this.fileService.saveFile({
-          filePath: finalPath,
-          stream,
-        });
+        if (!server.dlp.isEnabled()) {
+          saveFileResult = await this.fileService.saveFile({
+            filePath: finalPath,
+            stream,
+          });
+        } else {
+          // The content has to be checked before it is saved, so it is downloaded first
+          const downloadedPath = path.join(
+            await server.sessionService.scratch.directory(server.sessionService.activeSession.id),
+            `upload_${uuidv4()}`,
+          );
+          tempFilePath = downloadedPath;
+          await pipeline(stream, fs.createWriteStream(downloadedPath));
+          const dlpDenied = await this.checkDlp(
+            server,
+            { action: "upload", sessionId: request.params.sessionId, fileName: finalPath },
+            () => fs.createReadStream(downloadedPath),
+          );
+          if (dlpDenied) {
+            await fs.promises.unlink(downloadedPath).catch(() => {});
+            tempFilePath = null;
+            return reply.code(403).send({ success: false, message: dlpDenied });
+          }
+
+          saveFileResult = await this.fileService.saveFile({
+            filePath: finalPath,
+            stream: fs.createReadStream(downloadedPath),
+          });
+          await fs.promises.unlink(downloadedPath).catch(() => {});
+          tempFilePath = null;
+        }
       }
 
       if (!saveFileResult) {
@@ -190,25 +255,121 @@ export class FilesController {
     });
   }
 
+  private async sendFile(
+    server: FastifyInstance,
+    reply: FastifyReply,
+    sessionId: string,
+    filePath: string,
+  ) {
+    const dlpDenied = await this.checkDlp(
+      server,
+      { action: "download", sessionId, fileName: filePath },
+      async () => (await this.fileService.downloadFile({ filePath })).stream,
+    );
+    if (dlpDenied) {
+      return reply.code(403).send({ success: false, message: dlpDenied });
+    }
+
+    const { stream, size, lastModified } = await this.fileService.downloadFile({ filePath });
+
+    const name = filePath.split("/").pop() || "downloaded-file";
+
+    reply
+      .header("Content-Type", mime.lookup(filePath) || "application/octet-stream")
+      .header("Content-Length", size)
+      .header("Content-Disposition", `attachment; filename="${encodeURIComponent(name)}"`)
+      .header("Last-Modified", lastModified.toISOString());
+
+    return reply.send(stream);
+  }
+
+  private rejectUnsigned(reply: FastifyReply) {
+    return reply.code(403).send({
+      success: false,
+      message: "Direct file access is disabled. Request a signed URL instead.",
+    });
+  }
+
   async handleFileDownload(
     server: FastifyInstance,
     request: FastifyRequest<{ Params: { sessionId: string; "*": string } }>,
     reply: FastifyReply,
   ) {
+    if (env.REQUIRE_SIGNED_FILE_URLS) {
+      return this.rejectUnsigned(reply);
+    }
+
     try {
-      const { stream, size, lastModified } = await this.fileService.downloadFile({
-        filePath: request.params["*"],
-      });
+      return await this.sendFile(server, reply, request.params.sessionId, request.params["*"]);
+    } catch (e: unknown) {
+      const error = getErrors(e);
+      return reply.code(500).send({ success: false, message: error });
+    }
+  }
+
+  async handleCreateSignedUrl(
+    server: FastifyInstance,
+    request: FastifyRequest<{ Params: { sessionId: string }; Body: SignedFileUrlRequest }>,
+    reply: FastifyReply,
+  ) {
+    const { sessionId } = request.params;
+    const { path: filePath, expiresIn, subject } = request.body;
+
+    if (!this.validatePath(filePath)) {
+      return reply.code(400).send({ success: false, message: "Invalid path provided" });
+    }
+
+    try {
+      await this.fileService.getFile({ filePath });
+    } catch (e: unknown) {
+      return reply.code(404).send({ success: false, message: getErrors(e) });
+    }
+
+    const expires = Math.floor(Date.now() / 1000) + expiresIn;
+    const signature = signFileClaims({ sessionId, path: filePath, expires, subject });
+
+    const query = new URLSearchParams({ expires: String(expires), signature });
+    if (subject) {
+      query.set("subject", subject);
+    }
+    const encodedPath = filePath.split("/").map(encodeURIComponent).join("/");
+
+    server.log.info(
+      { audit: "signed_url_created", sessionId, path: filePath, subject, ip: request.ip, expires },
+      "Signed file URL created",
+    );
 
-      const name = request.params["*"].split("/").pop() || "downloaded-file";
+    return reply.send({
+      url: getUrl(`v1/sessions/${sessionId}/signed-files/${encodedPath}?${query.toString()}`),
+      expiresAt: new Date(expires * 1000).toISOString(),
+    });
+  }
+
+  async handleSignedFileDownload(
+    server: FastifyInstance,
+    request: FastifyRequest<{
+      Params: { sessionId: string; "*": string };
+      Querystring: SignedFileQuery;
+    }>,
+    reply: FastifyReply,
+  ) {
+    const { sessionId } = request.params;
+    const filePath = request.params["*"];
+    const { expires, signature, subject } = request.query;
+
+    const valid = verifyFileSignature({ sessionId, path: filePath, expires, subject }, signature);
 
-      reply
-        .header("Content-Type", mime.lookup(request.params["*"]) || "application/octet-stream")
-        .header("Content-Length", size)
-        .header("Content-Disposition", `attachment; filename="${encodeURIComponent(name)}"`)
-        .header("Last-Modified", lastModified.toISOString());
+    server.log.info(
+      { audit: "signed_file_download", sessionId, path: filePath, subject, ip: request.ip, valid },
+      valid ? "Signed file downloaded" : "Rejected signed file download",
+    );
 
-      return reply.send(stream);
+    if (!valid) {
+      return reply.code(403).send({ success: false, message: "Invalid or expired signature" });
+    }
+
+    try {
+      return await this.sendFile(server, reply, sessionId, filePath);
     } catch (e: unknown) {
       const error = getErrors(e);
       return reply.code(500).send({ success: false, message: error });
@@ -220,6 +381,10 @@ export class FilesController {
     request: FastifyRequest<{ Params: { sessionId: string; "*": string } }>,
     reply: FastifyReply,
   ) {
+    if (env.REQUIRE_SIGNED_FILE_URLS) {
+      return this.rejectUnsigned(reply);
+    }
+
     const { size, lastModified } = await this.fileService.getFile({
       filePath: request.params["*"],
     });
@@ -293,11 +458,24 @@ export class FilesController {
     request: FastifyRequest<{ Params: { sessionId: string } }>,
     reply: FastifyReply,
   ) {
+    if (env.REQUIRE_SIGNED_FILE_URLS) {
+      return this.rejectUnsigned(reply);
+    }
+
     const prebuiltArchivePath = await this.fileService.getPrebuiltArchivePath();
 
     try {
       const stats = await fs.promises.stat(prebuiltArchivePath);
       if (stats.isFile()) {
+        const dlpDenied = await this.checkDlp(
+          server,
+          { action: "download", sessionId: request.params.sessionId, fileName: "files.zip" },
+          () => fs.createReadStream(prebuiltArchivePath),
+        );
+        if (dlpDenied) {
+          return reply.code(403).send({ success: false, message: dlpDenied });
+        }
+
         server.log.info(`Serving prebuilt archive: ${prebuiltArchivePath}`);
         const stream = fs.createReadStream(prebuiltArchivePath);
 
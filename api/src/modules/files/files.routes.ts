@@ -4,6 +4,7 @@ import { $ref } from "../../plugins/schemas.js";
 import { FileService } from "../../services/file.service.js";
 import { MB } from "../../utils/size.js";
 import { FilesController } from "./files.controller.js";
+import { SignedFileQuery, SignedFileUrlRequest } from "./files.schema.js";
 
 async function routes(server: FastifyInstance) {
   const filesController = new FilesController(FileService.getInstance());
@@ -130,6 +131,49 @@ async function routes(server: FastifyInstance) {
       filesController.handleFileDeleteAll(server, request, reply),
   );
 
+  server.post(
+    "/sessions/:sessionId/signed-urls",
+    {
+      schema: {
+        operationId: "create_signed_file_url",
+        summary: "Create a signed file URL",
+        description:
+          "Mints a short-lived signed URL that allows downloading a single file without direct file access.",
+        tags: ["Files"],
+        body: $ref("SignedFileUrlRequest"),
+        response: {
+          200: $ref("SignedFileUrlResponse"),
+        },
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string }; Body: SignedFileUrlRequest }>,
+      reply,
+    ) => filesController.handleCreateSignedUrl(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/signed-files/*",
+    {
+      // The signature authenticates the request
+      config: { skipAuth: true },
+      schema: {
+        operationId: "download_signed_file",
+        summary: "Download a file with a signed URL",
+        description: "Download a file from a session using a URL minted by create_signed_file_url",
+        tags: ["Files"],
+        querystring: $ref("SignedFileQuery"),
+      },
+    },
+    async (
+      request: FastifyRequest<{
+        Params: { sessionId: string; "*": string };
+        Querystring: SignedFileQuery;
+      }>,
+      reply,
+    ) => filesController.handleSignedFileDownload(server, request, reply),
+  );
+
   server.get(
     "/sessions/:sessionId/files.zip",
     {
@@ -15,14 +15,46 @@ const MultipleFiles = z.object({
   data: z.array(FileDetails).describe("Array of files for the current page"),
 });
 
+const SignedFileUrlRequest = z.object({
+  path: z.string().describe("Path to the file in the storage system"),
+  expiresIn: z
+    .number()
+    .int()
+    .positive()
+    .max(86400)
+    .optional()
+    .default(300)
+    .describe("Number of seconds the URL stays valid"),
+  subject: z
+    .string()
+    .optional()
+    .describe("Identity of the recipient, recorded in the audit log when the URL is used"),
+});
+
+const SignedFileUrlResponse = z.object({
+  url: z.string().describe("Short-lived URL to download the file"),
+  expiresAt: z.string().datetime().describe("Timestamp when the URL stops working"),
+});
+
+const SignedFileQuery = z.object({
+  expires: z.number().int().describe("Unix timestamp in seconds when the URL expires"),
+  signature: z.string().describe("Signature for the URL"),
+  subject: z.string().optional().describe("Identity the URL was minted for"),
+});
+
 export type FileDetails = z.infer<typeof FileDetails>;
 export type MultipleFiles = z.infer<typeof MultipleFiles>;
 export type FileUploadRequest = z.infer<typeof FileUploadRequest>;
+export type SignedFileUrlRequest = z.infer<typeof SignedFileUrlRequest>;
+export type SignedFileQuery = z.infer<typeof SignedFileQuery>;
 
 export const filesSchemas = {
   FileUploadRequest,
   FileDetails,
   MultipleFiles,
+  SignedFileUrlRequest,
+  SignedFileUrlResponse,
+  SignedFileQuery,
 };
 
 export default filesSchemas;
@@ -0,0 +1,20 @@
+import { FastifyInstance, FastifyReply, FastifyRequest } from "fastify";
+
+async function routes(server: FastifyInstance) {
+  server.get(
+    "/metrics",
+    {
+      schema: {
+        operationId: "get_metrics",
+        description: "Runtime metrics in the Prometheus text exposition format",
+        tags: ["Metrics"],
+        summary: "Get metrics",
+      },
+    },
+    async (_request: FastifyRequest, reply: FastifyReply) => {
+      return reply.type("text/plain; version=0.0.4; charset=utf-8").send(server.metrics.render());
+    },
+  );
+}
+
+export default routes;
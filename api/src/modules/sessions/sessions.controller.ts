@@ -1,15 +1,44 @@
 import { CDPService } from "../../services/cdp/cdp.service.js";
+import { v4 as uuidv4 } from "uuid";
 import { FastifyInstance, FastifyReply, FastifyRequest } from "fastify";
 import { getErrors } from "../../utils/errors.js";
-import { CreateSessionRequest, SessionDetails, SessionStreamRequest } from "./sessions.schema.js";
+import {
+  DEFAULT_STREAM_QUALITY,
+  getSessionStreamSettings,
+  resolveStreamQuality,
+} from "../../utils/stream-quality.js";
+import {
+  BandwidthLimitRequest,
+  ControlGrantRequest,
+  CreateSessionRequest,
+  MaintenanceRequest,
+  ResolutionRequest,
+  SecretRequest,
+  StreamQualityRequest,
+  LiveScreenshotQuery,
+  SessionDetails,
+  SessionStreamRequest,
+} from "./sessions.schema.js";
 import { CookieData } from "../../services/context/types.js";
 import { getUrl, getBaseUrl } from "../../utils/url.js";
+import { getTargetId } from "../../utils/browser.js";
+import { issueViewerToken } from "../../utils/viewer-token.js";
+import { env } from "../../env.js";
 
 export const handleLaunchBrowserSession = async (
   server: FastifyInstance,
   request: CreateSessionRequest,
   reply: FastifyReply,
 ) => {
+  // Running sessions are left alone, only new ones wait for maintenance to end
+  if (server.maintenance.isActive()) {
+    const { message, until } = server.maintenance.status();
+    return reply
+      .code(503)
+      .header("Retry-After", server.maintenance.retryAfterSeconds())
+      .send({ success: false, code: "maintenance", message, until });
+  }
+
   try {
     const {
       sessionId,
@@ -31,9 +60,13 @@ export const handleLaunchBrowserSession = async (
       userPreferences,
       deviceConfig,
       headless,
+      screenContent,
+      streamPreset,
+      clipboardSync,
     } = request.body;
 
-    return await server.sessionService.startSession({
+    const streamSettings = streamPreset ? getSessionStreamSettings(streamPreset) : null;
+    const session = await server.sessionService.startSession({
       sessionId,
       proxyUrl,
       userDataDir,
@@ -56,7 +89,15 @@ export const handleLaunchBrowserSession = async (
       userPreferences,
       deviceConfig,
       headless,
+      screenContent: screenContent ?? streamSettings?.screenContent,
+      streamPreset,
+      clipboardSync,
     });
+
+    // Every session starts from its preset, or the default quality, rather than from whatever
+    // the previous session's viewers were left with. A failed launch leaves the quality alone
+    server.viewerService.setStreamQuality(streamSettings?.quality ?? DEFAULT_STREAM_QUALITY);
+    return session;
   } catch (e: unknown) {
     server.log.error({ err: e }, "Failed lauching browser session");
     const error = getErrors(e);
@@ -145,6 +186,24 @@ export const handleGetSessionStream = async (
   reply: FastifyReply,
 ) => {
   const { showControls, theme, interactive, pageId, pageIndex } = request.query;
+  const sessionId = server.sessionService.activeSession.id;
+
+  // The page hands out a token its sockets are let in with, so it is authorized like a socket.
+  // Passing the admin check alone is not enough, authorizers that only guard live view allow it.
+  const token =
+    request.query.token || request.headers.authorization?.replace(/^Bearer\s+/i, "") || null;
+  const decision = await server.authorizer.checkUpgrade(request.raw, {
+    sessionId,
+    token,
+    page: true,
+  });
+  if (!decision.allowed) {
+    return reply.code(401).send({ success: false, message: decision.reason ?? "Unauthorized" });
+  }
+  const claims = decision.claims;
+  if (claims?.sessionId && claims.sessionId !== sessionId) {
+    return reply.code(404).send({ success: false, message: "Session not found" });
+  }
 
   const singlePageMode = !!(pageId || pageIndex);
 
@@ -156,11 +215,27 @@ export const handleGetSessionStream = async (
     wsUrl += `?pageIndex=${encodeURIComponent(pageIndex)}`;
   }
 
+  // The page opens its sockets with a token scoped to this session, as the viewer its credential
+  // names. The interactive flag can only narrow what that credential allows, never widen it.
+  const permission = interactive && claims?.permission !== "view" ? "control" : "view";
+  const viewerToken = issueViewerToken(
+    {
+      sessionId,
+      viewerId: typeof claims?.sub === "string" && claims.sub ? claims.sub : uuidv4(),
+      permission,
+      maxBitrateKbps:
+        typeof claims?.maxBitrateKbps === "number" ? claims.maxBitrateKbps : undefined,
+      streamPreset: typeof claims?.streamPreset === "string" ? claims.streamPreset : undefined,
+    },
+    env.LIVE_VIEW_TOKEN_TTL_MS,
+  );
+
   return reply.view("live-session-streamer.ejs", {
     wsUrl,
+    viewerToken,
     showControls,
     theme,
-    interactive,
+    interactive: permission === "control",
     dimensions: server.sessionService.activeSession.dimensions,
     singlePageMode,
   });
@@ -177,7 +252,7 @@ export const handleGetSessionLiveDetails = async (
     const pagesInfo = await Promise.all(
       pages.map(async (page) => {
         try {
-          const pageId = page.target()._targetId;
+          const pageId = getTargetId(page);
 
           const title = await page.title();
 
@@ -203,6 +278,7 @@ export const handleGetSessionLiveDetails = async (
             url: page.url(),
             title,
             favicon,
+            viewerCount: server.viewerService.count(pageId),
           };
         } catch (error) {
           console.error("Error collecting page info:", error);
@@ -224,6 +300,7 @@ export const handleGetSessionLiveDetails = async (
         height: 1080,
       },
       pageCount: validPagesInfo.length,
+      viewerCount: server.viewerService.count(),
     };
 
     return reply.send({
@@ -241,3 +318,334 @@ export const handleGetSessionLiveDetails = async (
     });
   }
 };
+
+export const handleGrantControl = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string }; Body: ControlGrantRequest }>,
+  reply: FastifyReply,
+) => {
+  const { viewerId, durationSeconds } = request.body;
+  try {
+    const grant = server.viewerService.grantControl(viewerId, durationSeconds * 1000);
+    return reply.send({
+      viewerId: grant.viewerId,
+      expiresAt: new Date(grant.expiresAt).toISOString(),
+    });
+  } catch (e: unknown) {
+    return reply.code(400).send({ success: false, message: getErrors(e) });
+  }
+};
+
+export const handleRevokeControl = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  server.viewerService.revokeControl();
+  return reply.code(204).send();
+};
+
+export const handleBlankStream = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  server.viewerService.setBlanked(true);
+  return reply.code(204).send();
+};
+
+export const handleResumeStream = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  server.viewerService.setBlanked(false);
+  return reply.code(204).send();
+};
+
+export const handleGetStreamQuality = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  return reply.send(server.viewerService.getStreamQuality());
+};
+
+export const handleSetStreamQuality = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string }; Body: StreamQualityRequest }>,
+  reply: FastifyReply,
+) => {
+  const quality = resolveStreamQuality(request.body);
+  server.viewerService.setStreamQuality(quality);
+  return reply.send(quality);
+};
+
+/**
+ * Captures what a page of the session shows right now, without opening a live view connection
+ * and without activating the page
+ */
+export const handleGetLiveScreenshot = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string }; Querystring: LiveScreenshotQuery }>,
+  reply: FastifyReply,
+) => {
+  // The page is hidden from live viewers in these states, so it is not shown here either
+  if (server.viewerService.isBlanked() || server.sessionService.isPaused()) {
+    return reply.code(409).send({
+      success: false,
+      message: server.viewerService.isBlanked() ? "Stream is blanked" : "Session is paused",
+    });
+  }
+
+  const { format, quality, pageId } = request.query;
+  const pages = await server.cdpService.getAllPages();
+  const page = pageId
+    ? pages.find((candidate) => getTargetId(candidate) === pageId)
+    : await server.cdpService.getPrimaryPage();
+  if (!page || page.isClosed()) {
+    return reply.code(404).send({ success: false, message: "Page not found" });
+  }
+
+  const client = await page.target().createCDPSession();
+  try {
+    const { data } = await client.send("Page.captureScreenshot", {
+      format,
+      quality: format === "jpeg" ? quality : undefined,
+    });
+    return reply
+      .header("Cache-Control", "no-store")
+      .type(`image/${format}`)
+      .send(Buffer.from(data, "base64"));
+  } catch (e: unknown) {
+    server.log.error({ err: e, pageId }, "Failed to capture a session screenshot");
+    return reply.code(500).send({ success: false, message: getErrors(e) });
+  } finally {
+    await client.detach().catch(() => {});
+  }
+};
+
+export const handleGetThumbnail = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  // The last thumbnail may have been taken just before the screen was hidden, so it is held back
+  // like a live screenshot
+  if (server.viewerService.isBlanked() || server.sessionService.isPaused()) {
+    return reply.code(409).send({
+      success: false,
+      message: server.viewerService.isBlanked() ? "Stream is blanked" : "Session is paused",
+    });
+  }
+  const thumbnail = server.thumbnails.latest(request.params.sessionId);
+  if (!thumbnail) {
+    return reply.code(404).send({ success: false, message: "No thumbnail for this session" });
+  }
+  return reply
+    .header("Cache-Control", "no-cache")
+    .header("Last-Modified", new Date(thumbnail.capturedAt).toUTCString())
+    .type("image/jpeg")
+    .send(thumbnail.data);
+};
+
+export const handleListViewers = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  const viewers = server.viewerService.list().map((viewer) => ({
+    connectionId: viewer.connectionId,
+    viewerId: viewer.viewerId,
+    pageId: viewer.pageId,
+    state: viewer.state,
+    connectedAt: new Date(viewer.connectedAt).toISOString(),
+    lastActiveAt: new Date(viewer.lastActiveAt).toISOString(),
+    viewOnly: !!viewer.viewOnly,
+    dryRun: !!viewer.dryRun,
+    hasControl: !viewer.viewOnly && server.viewerService.canControl(viewer.viewerId),
+    health: server.viewerService.getHealth(viewer.viewerId),
+  }));
+  return reply.send({ viewers });
+};
+
+export const handleGetLiveViewStats = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  const connections = server.viewerService.list().map((viewer) => {
+    const { rttMs, missedPongs } = server.viewerService.getHealth(viewer.viewerId);
+    return {
+      connectionId: viewer.connectionId,
+      viewerId: viewer.viewerId,
+      pageId: viewer.pageId,
+      framesSent: 0,
+      framesDropped: 0,
+      bytesSent: 0,
+      bitrateKbps: 0,
+      ...server.viewerService.getMediaStats(viewer.connectionId),
+      rttMs,
+      missedPongs,
+    };
+  });
+  return reply.send({ connections });
+};
+
+export const handleGetLiveViewConnections = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  const toISOString = (at: number) => new Date(at).toISOString();
+  const { connections, rejections } = server.connectionHistory.list(request.params.sessionId);
+  return reply.send({
+    connections: connections.map((connection) => ({
+      connectionId: connection.connectionId,
+      viewerId: connection.viewerId,
+      pageId: connection.pageId,
+      openedAt: toISOString(connection.openedAt),
+      closedAt: connection.closedAt === null ? null : toISOString(connection.closedAt),
+      closeCode: connection.closeCode,
+      closeReason: connection.closeReason,
+      timeline: connection.timeline.map((entry) => ({ ...entry, at: toISOString(entry.at) })),
+    })),
+    rejections: rejections.map(({ at, viewerId, reason }) => ({
+      at: toISOString(at),
+      viewerId,
+      reason,
+    })),
+  });
+};
+
+export const handleSetBandwidthLimit = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{
+    Params: { sessionId: string; viewerId: string };
+    Body: BandwidthLimitRequest;
+  }>,
+  reply: FastifyReply,
+) => {
+  try {
+    server.viewerService.setBandwidthLimit(request.params.viewerId, request.body.maxBitrateKbps);
+    return reply.code(204).send();
+  } catch (e: unknown) {
+    return reply.code(400).send({ success: false, message: getErrors(e) });
+  }
+};
+
+/**
+ * preHandler for the live view routes, which only act on the active session
+ */
+export const requireActiveSession =
+  (server: FastifyInstance) =>
+  async (request: FastifyRequest, reply: FastifyReply) => {
+    const { sessionId } = request.params as { sessionId: string };
+    if (server.sessionService.activeSession.id !== sessionId) {
+      return reply.code(404).send({ success: false, message: "Session not found" });
+    }
+  };
+
+export const handleSetSecret = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string; name: string }; Body: SecretRequest }>,
+  reply: FastifyReply,
+) => {
+  // Secrets staged for another session would be typed into pages they were not meant for
+  try {
+    server.sessionService.secrets.set(request.params.name, request.body.value);
+    return reply.code(204).send();
+  } catch (e: unknown) {
+    return reply.code(400).send({ success: false, message: getErrors(e) });
+  }
+};
+
+export const handleListSecrets = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  return reply.send({
+    secrets: server.sessionService.secrets.list().map(({ name, updatedAt }) => ({
+      name,
+      updatedAt: new Date(updatedAt).toISOString(),
+    })),
+  });
+};
+
+export const handleDeleteSecret = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string; name: string } }>,
+  reply: FastifyReply,
+) => {
+  const { name } = request.params;
+  if (!server.sessionService.secrets.delete(name)) {
+    return reply.code(404).send({ success: false, message: `Secret ${name} not found` });
+  }
+  return reply.code(204).send();
+};
+
+export const handleSetResolution = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string }; Body: ResolutionRequest }>,
+  reply: FastifyReply,
+) => {
+  try {
+    await server.sessionService.resize(request.body.width, request.body.height);
+    return reply.code(204).send();
+  } catch (e: unknown) {
+    server.log.error({ err: e }, "Failed to resize the session");
+    return reply.code(500).send({ success: false, message: getErrors(e) });
+  }
+};
+
+export const handleDisconnectViewer = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string; viewerId: string } }>,
+  reply: FastifyReply,
+) => {
+  const { viewerId } = request.params;
+  if (!server.viewerService.disconnect(viewerId, "Disconnected by server")) {
+    return reply.code(404).send({ success: false, message: `Viewer ${viewerId} not connected` });
+  }
+  return reply.code(204).send();
+};
+
+export const handlePauseSession = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  server.sessionService.pause();
+  return reply.code(204).send();
+};
+
+export const handleResumeSession = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Params: { sessionId: string } }>,
+  reply: FastifyReply,
+) => {
+  server.sessionService.resume();
+  return reply.code(204).send();
+};
+
+export const handleStartMaintenance = async (
+  server: FastifyInstance,
+  request: FastifyRequest<{ Body: MaintenanceRequest }>,
+  reply: FastifyReply,
+) => {
+  try {
+    return reply.send(server.maintenance.start(request.body));
+  } catch (e: unknown) {
+    return reply.code(400).send({ success: false, message: getErrors(e) });
+  }
+};
+
+export const handleEndMaintenance = async (
+  server: FastifyInstance,
+  request: FastifyRequest,
+  reply: FastifyReply,
+) => {
+  server.maintenance.end();
+  return reply.code(204).send();
+};
@@ -7,37 +7,204 @@ import {
   handleGetSessions,
   handleGetSessionStream,
   handleGetSessionLiveDetails,
+  handleGrantControl,
+  handleRevokeControl,
+  handleBlankStream,
+  handleResumeStream,
+  handleGetStreamQuality,
+  handleGetLiveScreenshot,
+  handleGetThumbnail,
+  handleSetStreamQuality,
+  handleListViewers,
+  handleGetLiveViewStats,
+  handleGetLiveViewConnections,
+  handleSetBandwidthLimit,
+  handleSetResolution,
+  handleSetSecret,
+  handleListSecrets,
+  handleDeleteSecret,
+  handleDisconnectViewer,
+  handlePauseSession,
+  handleResumeSession,
+  handleStartMaintenance,
+  handleEndMaintenance,
+  requireActiveSession,
 } from "./sessions.controller.js";
 import { handleScrape, handleScreenshot, handlePDF } from "../actions/actions.controller.js";
 import { $ref } from "../../plugins/schemas.js";
 import {
+  BandwidthLimitRequest,
+  ControlGrantRequest,
   CreateSessionRequest,
+  FeatureFlagUpdate,
+  MaintenanceRequest,
   RecordedEvents,
+  ResolutionRequest,
+  SecretRequest,
   SessionStreamRequest,
+  StreamQualityRequest,
+  LiveScreenshotQuery,
   SessionsScrapeRequest,
   SessionsScreenshotRequest,
   SessionsPDFRequest,
 } from "./sessions.schema.js";
 import { BrowserEventType, EmitEvent } from "../../types/enums.js";
+import { getBuildInfo } from "../../utils/build-info.js";
+import { runSelfTest } from "../../utils/self-test.js";
+import { isFeatureFlag } from "../../services/feature-flag.service.js";
 
 async function routes(server: FastifyInstance) {
+  const activeSessionOnly = requireActiveSession(server);
+
   server.get(
     "/health",
     {
+      config: { skipAuth: true },
       schema: {
         operationId: "health",
-        description: "Check if the server and browser are running",
+        description:
+          "Check if the server and browser are running, and whether new sessions are refused for maintenance",
         tags: ["Health"],
         summary: "Check if the server and browser are running",
       },
     },
     async (request: FastifyRequest, reply: FastifyReply) => {
+      const maintenance = server.maintenance.status();
       if (!server.cdpService.isRunning()) {
-        return reply.status(503).send({ status: "service_unavailable" });
+        return reply.status(503).send({ status: "service_unavailable", maintenance });
       }
-      return reply.send({ status: "ok" });
+      return reply.send({ status: "ok", maintenance });
+    },
+  );
+
+  server.get(
+    "/selftest",
+    {
+      schema: {
+        operationId: "self_test",
+        description:
+          "Check that the API and CDP ports are listening. With probe=true, also check that the addresses advertised to clients are reachable",
+        tags: ["Health"],
+        summary: "Run the self-test",
+      },
+    },
+    async (request: FastifyRequest<{ Querystring: { probe?: string } }>, reply: FastifyReply) => {
+      const result = await runSelfTest({ probe: request.query.probe === "true" });
+      return reply.code(result.ok ? 200 : 503).send(result);
+    },
+  );
+
+  server.get(
+    "/buildinfo",
+    {
+      schema: {
+        operationId: "build_info",
+        description: "Get the version, git SHA, build date and enabled features of this build",
+        tags: ["Health"],
+        summary: "Get build information",
+      },
+    },
+    async (request: FastifyRequest, reply: FastifyReply) => {
+      return reply.send(getBuildInfo());
+    },
+  );
+
+  server.get(
+    "/capabilities",
+    {
+      schema: {
+        operationId: "get_capabilities",
+        description: "List the feature flags of this deployment and whether they are enabled",
+        tags: ["Health"],
+        summary: "Get capabilities",
+        response: {
+          200: $ref("CapabilitiesResponse"),
+        },
+      },
+    },
+    async (request: FastifyRequest, reply: FastifyReply) => {
+      return reply.send({ featureFlags: server.featureFlags.list() });
     },
   );
+
+  server.put(
+    "/feature-flags/:name",
+    {
+      schema: {
+        operationId: "update_feature_flag",
+        description: "Enable or disable a feature flag at runtime",
+        tags: ["Health"],
+        summary: "Update a feature flag",
+        body: $ref("FeatureFlagUpdate"),
+        response: {
+          200: $ref("CapabilitiesResponse"),
+        },
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { name: string }; Body: FeatureFlagUpdate }>,
+      reply: FastifyReply,
+    ) => {
+      const { name } = request.params;
+      if (!isFeatureFlag(name)) {
+        return reply.code(404).send({ success: false, message: `Unknown feature flag ${name}` });
+      }
+      server.featureFlags.set(name, request.body.enabled);
+      return reply.send({ featureFlags: server.featureFlags.list() });
+    },
+  );
+
+  server.get(
+    "/maintenance",
+    {
+      schema: {
+        operationId: "get_maintenance",
+        description: "Get whether new sessions are refused for maintenance, and until when",
+        tags: ["Health"],
+        summary: "Get maintenance status",
+        response: {
+          200: $ref("MaintenanceStatus"),
+        },
+      },
+    },
+    async (request: FastifyRequest, reply: FastifyReply) => {
+      return reply.send(server.maintenance.status());
+    },
+  );
+
+  server.put(
+    "/maintenance",
+    {
+      schema: {
+        operationId: "start_maintenance",
+        description:
+          "Refuse new sessions with a maintenance error and a Retry-After header for the given duration, and notify viewers of running sessions. Replaces any maintenance in progress.",
+        tags: ["Health"],
+        summary: "Start maintenance",
+        body: $ref("MaintenanceRequest"),
+        response: {
+          200: $ref("MaintenanceStatus"),
+        },
+      },
+    },
+    async (request: FastifyRequest<{ Body: MaintenanceRequest }>, reply: FastifyReply) =>
+      handleStartMaintenance(server, request, reply),
+  );
+
+  server.delete(
+    "/maintenance",
+    {
+      schema: {
+        operationId: "end_maintenance",
+        description: "End maintenance early and accept new sessions again",
+        tags: ["Health"],
+        summary: "End maintenance",
+      },
+    },
+    async (request: FastifyRequest, reply: FastifyReply) =>
+      handleEndMaintenance(server, request, reply),
+  );
+
   server.post(
     "/sessions",
     {
@@ -163,6 +330,9 @@ async function routes(server: FastifyInstance) {
   server.post(
     "/events",
     {
+      // Sent by the recorder extension inside the browser, which has no API key. Anyone else
+      // could inject events into the recording, so only this host is let through without one.
+      config: { skipAuthFromLoopback: true },
       schema: {
         operationId: "receive_events",
         description: "Receive recorded events from the browser",
@@ -172,6 +342,14 @@ async function routes(server: FastifyInstance) {
       },
     },
     async (request: FastifyRequest<{ Body: RecordedEvents }>, reply: FastifyReply) => {
+      if (!server.sessionService.isRecordingAllowed()) {
+        return reply.send({ status: "consent_required" });
+      }
+      if (server.sessionService.isPaused()) {
+        return reply.send({ status: "paused" });
+      }
+
+      server.sessionService.markRecordingStarted();
       server.cdpService.getInstrumentationLogger().record({
         type: BrowserEventType.Recording,
         timestamp: new Date().toISOString(),
@@ -200,6 +378,348 @@ async function routes(server: FastifyInstance) {
       handleGetSessionLiveDetails(server, request, reply),
   );
 
+  server.post(
+    "/sessions/:sessionId/control",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "grant_session_control",
+        description:
+          "Give a live viewer exclusive control of the session for a limited time, after which control reverts to all viewers",
+        tags: ["Sessions"],
+        summary: "Grant temporary control to a viewer",
+        body: $ref("ControlGrantRequest"),
+        response: {
+          200: $ref("ControlGrantResponse"),
+        },
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string }; Body: ControlGrantRequest }>,
+      reply: FastifyReply,
+    ) => handleGrantControl(server, request, reply),
+  );
+
+  server.delete(
+    "/sessions/:sessionId/control",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "revoke_session_control",
+        description: "Revoke an active control grant so all viewers can control the session again",
+        tags: ["Sessions"],
+        summary: "Revoke a control grant",
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleRevokeControl(server, request, reply),
+  );
+
+  server.post(
+    "/sessions/:sessionId/display/resolution",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "set_session_resolution",
+        description:
+          "Change the viewport size of the session's pages. Connected viewers keep their connection and their stream switches to the new size.",
+        tags: ["Sessions"],
+        summary: "Change the session resolution",
+        body: $ref("ResolutionRequest"),
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string }; Body: ResolutionRequest }>,
+      reply: FastifyReply,
+    ) => handleSetResolution(server, request, reply),
+  );
+
+  server.post(
+    "/sessions/:sessionId/pause",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "pause_session",
+        description:
+          "Pause the session: live view frames, viewer input and recorded events are dropped until it is resumed, while viewers stay connected",
+        tags: ["Sessions"],
+        summary: "Pause a session",
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handlePauseSession(server, request, reply),
+  );
+
+  server.post(
+    "/sessions/:sessionId/resume",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "resume_session",
+        description: "Resume a paused session",
+        tags: ["Sessions"],
+        summary: "Resume a session",
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleResumeSession(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/viewers",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "list_session_viewers",
+        description: "List the live view connections of the session",
+        tags: ["Sessions"],
+        summary: "List live viewers",
+        response: {
+          200: $ref("MultipleViewers"),
+        },
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleListViewers(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/live-view/stats",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "get_live_view_stats",
+        description:
+          "Get per-connection live view quality: frames and bytes sent, bitrate, dropped frames and heartbeat round trips",
+        tags: ["Sessions"],
+        summary: "Get live view stats",
+        response: {
+          200: $ref("LiveViewStats"),
+        },
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleGetLiveViewStats(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/live-view/connections",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "get_live_view_connections",
+        description:
+          "Get the lifecycle of the session's live view connections, including connections closed within LIVE_VIEW_HISTORY_RETENTION_MS and rejected viewers, to analyze a session that failed to stream",
+        tags: ["Sessions"],
+        summary: "Get live view connection history",
+        response: {
+          200: $ref("LiveViewConnectionHistory"),
+        },
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleGetLiveViewConnections(server, request, reply),
+  );
+
+  server.put(
+    "/sessions/:sessionId/viewers/:viewerId/bandwidth",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "set_viewer_bandwidth_limit",
+        description:
+          "Cap the live view frame bitrate of a viewer, overriding the maxBitrateKbps claim of its token. Frames over the cap are dropped and the latest frame is sent once the cap allows.",
+        tags: ["Sessions"],
+        summary: "Limit a viewer's bandwidth",
+        body: $ref("BandwidthLimitRequest"),
+      },
+    },
+    async (
+      request: FastifyRequest<{
+        Params: { sessionId: string; viewerId: string };
+        Body: BandwidthLimitRequest;
+      }>,
+      reply: FastifyReply,
+    ) => handleSetBandwidthLimit(server, request, reply),
+  );
+
+  server.put(
+    "/sessions/:sessionId/secrets/:name",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "set_session_secret",
+        description:
+          "Stage a named secret, e.g. a password, for the active session. Viewers can have it typed or pasted into the page with a pasteSecret message without ever receiving the value. Secrets are dropped when the session ends.",
+        tags: ["Sessions"],
+        summary: "Stage a session secret",
+        body: $ref("SecretRequest"),
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string; name: string }; Body: SecretRequest }>,
+      reply: FastifyReply,
+    ) => handleSetSecret(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/secrets",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "list_session_secrets",
+        description: "List the names of the secrets staged for the session, without their values",
+        tags: ["Sessions"],
+        summary: "List session secrets",
+        response: {
+          200: $ref("SecretList"),
+        },
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleListSecrets(server, request, reply),
+  );
+
+  server.delete(
+    "/sessions/:sessionId/secrets/:name",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "delete_session_secret",
+        description: "Remove a staged secret from the session",
+        tags: ["Sessions"],
+        summary: "Delete a session secret",
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string; name: string } }>,
+      reply: FastifyReply,
+    ) => handleDeleteSecret(server, request, reply),
+  );
+
+  server.delete(
+    "/sessions/:sessionId/viewers/:viewerId",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "disconnect_session_viewer",
+        description: "Close every live view connection of a viewer",
+        tags: ["Sessions"],
+        summary: "Disconnect a live viewer",
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string; viewerId: string } }>,
+      reply: FastifyReply,
+    ) => handleDisconnectViewer(server, request, reply),
+  );
+
+  server.post(
+    "/sessions/:sessionId/live-view/blank",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "blank_session_stream",
+        description:
+          "Blank the live view for all viewers without disconnecting them, e.g. while sensitive data is on screen",
+        tags: ["Sessions"],
+        summary: "Blank the live view",
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleBlankStream(server, request, reply),
+  );
+
+  server.delete(
+    "/sessions/:sessionId/live-view/blank",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "resume_session_stream",
+        description: "Resume a blanked live view, sending viewers the current frame right away",
+        tags: ["Sessions"],
+        summary: "Resume the live view",
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleResumeStream(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/live-view/quality",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "get_session_stream_quality",
+        description: "Get the quality preset and limits of the live view stream",
+        tags: ["Sessions"],
+        summary: "Get the live view quality",
+        response: {
+          200: $ref("StreamQuality"),
+        },
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleGetStreamQuality(server, request, reply),
+  );
+
+  server.put(
+    "/sessions/:sessionId/live-view/quality",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "set_session_stream_quality",
+        description:
+          "Trade fidelity for latency and bandwidth: set the JPEG quality, frame rate and bitrate of the live view for all viewers, with a preset or custom values. Connected viewers switch right away, except those that picked a quality of their own with a quality message. Bandwidth limits set per viewer still apply.",
+        tags: ["Sessions"],
+        summary: "Set the live view quality",
+        body: $ref("StreamQualityRequest"),
+        response: {
+          200: $ref("StreamQuality"),
+        },
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string }; Body: StreamQualityRequest }>,
+      reply: FastifyReply,
+    ) => handleSetStreamQuality(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/screenshot",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "get_session_live_screenshot",
+        description:
+          "Capture what a page of the live session shows right now as a PNG or JPEG image, e.g. for monitoring, without opening a live view connection. The page is not navigated, activated or otherwise changed. Returns 409 while the stream is blanked or the session paused.",
+        tags: ["Sessions"],
+        summary: "Get a screenshot of the live session",
+        querystring: $ref("LiveScreenshotQuery"),
+      },
+    },
+    async (
+      request: FastifyRequest<{ Params: { sessionId: string }; Querystring: LiveScreenshotQuery }>,
+      reply: FastifyReply,
+    ) => handleGetLiveScreenshot(server, request, reply),
+  );
+
+  server.get(
+    "/sessions/:sessionId/thumbnail",
+    {
+      preHandler: activeSessionOnly,
+      schema: {
+        operationId: "get_session_thumbnail",
+        description:
+          "Latest small JPEG preview of the session, captured every THUMBNAIL_INTERVAL_MS when that is set. Cheaper than a screenshot for session lists, since the image is already captured. Each capture is also published as a session.thumbnail event. Returns 409 while the stream is blanked or the session paused.",
+        tags: ["Sessions"],
+        summary: "Get the session thumbnail",
+      },
+    },
+    async (request: FastifyRequest<{ Params: { sessionId: string } }>, reply: FastifyReply) =>
+      handleGetThumbnail(server, request, reply),
+  );
+
   server.post(
     "/sessions/scrape",
     {
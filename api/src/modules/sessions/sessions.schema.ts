@@ -6,6 +6,7 @@ import {
   PDFRequestBody,
 } from "../actions/actions.schema.js";
 import { SessionContextSchema } from "../../services/context/types.js";
+import { SESSION_STREAM_PRESETS, STREAM_QUALITY_PRESETS } from "../../utils/stream-quality.js";
 
 const deviceConfigSchema = z
   .object({
@@ -63,6 +64,24 @@ const CreateSession = z.object({
     .boolean()
     .optional()
     .describe("Launch the browser in fullscreen mode, covering the full screen with no Chrome UI."),
+  screenContent: z
+    .boolean()
+    .optional()
+    .describe(
+      "Stream the live view as lossless PNG frames to keep small text sharp, at the cost of bandwidth.",
+    ),
+  streamPreset: z
+    .enum(SESSION_STREAM_PRESETS)
+    .optional()
+    .describe(
+      "Live view preset setting the frame format, quality, frame rate and bitrate together: sharp-text, smooth-motion, low-bandwidth or archival. screenContent takes precedence over the preset's frame format.",
+    ),
+  clipboardSync: z
+    .boolean()
+    .optional()
+    .describe(
+      "Keep the clipboard of the session and of live viewers in sync in both directions, instead of only on explicit copy and paste.",
+    ),
   // Specific to hosted steel
   logSinkUrl: z.string().optional().describe("Deprecated: Log sink URL to use for the session"),
   extensions: z.array(z.string()).optional().describe("Extensions to use for the session"),
@@ -124,6 +143,18 @@ const SessionDetails = z.object({
   solveCaptcha: z.boolean().optional().describe("Indicates if captcha solving is enabled"),
   isSelenium: z.boolean().optional().describe("Indicates if Selenium is used in the session"),
   deviceConfig: deviceConfigSchema,
+  screenContent: z
+    .boolean()
+    .optional()
+    .describe("Indicates if the live view streams lossless frames for text legibility"),
+  streamPreset: z
+    .enum(SESSION_STREAM_PRESETS)
+    .optional()
+    .describe("Live view preset the session was created with"),
+  clipboardSync: z
+    .boolean()
+    .optional()
+    .describe("Indicates if the clipboard is kept in sync with live viewers"),
 });
 
 const ReleaseSession = SessionDetails.merge(
@@ -148,6 +179,23 @@ const SessionStreamQuery = z.object({
   interactive: z.boolean().optional().default(true).describe("Make the browser iframe interactive"),
   pageId: z.string().optional().describe("Page ID to connect to"),
   pageIndex: z.string().optional().describe("Page index (or tab index) to connect to"),
+  token: z
+    .string()
+    .optional()
+    .describe("Live view token, the page is only served to credentials allowed to view the session"),
+});
+
+const LiveScreenshotQuery = z.object({
+  format: z.enum(["png", "jpeg"]).optional().default("png").describe("Image format"),
+  quality: z
+    .number()
+    .int()
+    .min(1)
+    .max(100)
+    .optional()
+    .default(80)
+    .describe("JPEG quality, unused for PNG"),
+  pageId: z.string().optional().describe("Page to capture, the primary page if not given"),
 });
 
 const SessionLiveDetailsResponse = z.object({
@@ -160,6 +208,7 @@ const SessionLiveDetailsResponse = z.object({
       url: z.string(),
       title: z.string(),
       favicon: z.string().nullable(),
+      viewerCount: z.number().describe("Number of viewers watching the page"),
     }),
   ),
   browserState: z.object({
@@ -171,9 +220,209 @@ const SessionLiveDetailsResponse = z.object({
       height: z.number(),
     }),
     pageCount: z.number(),
+    viewerCount: z.number().describe("Number of viewers connected to the session"),
+  }),
+});
+
+const ControlGrantRequest = z.object({
+  viewerId: z.string().describe("Viewer to give exclusive control to"),
+  durationSeconds: z
+    .number()
+    .int()
+    .positive()
+    .max(3600)
+    .optional()
+    .default(120)
+    .describe("Number of seconds before control reverts to all viewers"),
+});
+
+const ControlGrantResponse = z.object({
+  viewerId: z.string().describe("Viewer holding control"),
+  expiresAt: z.string().datetime().describe("Timestamp when control reverts"),
+});
+
+const BandwidthLimitRequest = z.object({
+  maxBitrateKbps: z
+    .number()
+    .positive()
+    .nullable()
+    .describe("Maximum frame bitrate sent to each of the viewer's connections, null to remove"),
+});
+
+const StreamQualityRequest = z.object({
+  preset: z
+    .enum(STREAM_QUALITY_PRESETS)
+    .describe("low, medium or high, or custom to start from high and set the values below"),
+  quality: z.number().int().min(10).max(100).optional().describe("Highest JPEG quality"),
+  maxFps: z
+    .number()
+    .positive()
+    .max(60)
+    .nullable()
+    .optional()
+    .describe("Frames per second sent to each viewer connection, null for no cap"),
+  maxBitrateKbps: z
+    .number()
+    .positive()
+    .nullable()
+    .optional()
+    .describe("Frame bitrate of each viewer connection, null for no cap"),
+});
+
+const StreamQuality = z.object({
+  preset: z.enum(STREAM_QUALITY_PRESETS),
+  quality: z.number().describe("Highest JPEG quality"),
+  maxFps: z.number().nullable().describe("Frames per second sent to each viewer connection"),
+  maxBitrateKbps: z.number().nullable().describe("Frame bitrate of each viewer connection"),
+});
+
+const ResolutionRequest = z.object({
+  width: z.number().int().min(320).max(3840).describe("Viewport width in CSS pixels"),
+  height: z.number().int().min(240).max(2160).describe("Viewport height in CSS pixels"),
+});
+
+const SecretRequest = z.object({
+  value: z
+    .string()
+    .min(1)
+    .max(4096)
+    .describe("Secret value. It is never returned by the API, sent to viewers or logged."),
+});
+
+const SecretList = z.object({
+  secrets: z.array(
+    z.object({
+      name: z.string().describe("Name viewers use to inject the secret"),
+      updatedAt: z.string().datetime().describe("When the secret was last staged"),
+    }),
+  ),
+});
+
+const ViewerDetails = z.object({
+  connectionId: z.string().describe("Unique id of the viewer's connection"),
+  viewerId: z.string().describe("Id shared by all connections of the same viewer"),
+  pageId: z.string().nullable().describe("Page the connection is watching"),
+  state: z.enum(["active", "closing"]).describe("State of the connection"),
+  connectedAt: z.string().datetime().describe("Timestamp when the connection was opened"),
+  lastActiveAt: z.string().datetime().describe("Timestamp of the last message from the viewer"),
+  viewOnly: z.boolean().describe("Whether the connection can only watch the session"),
+  dryRun: z
+    .boolean()
+    .describe("Whether the connection's input is only acknowledged, never dispatched"),
+  hasControl: z.boolean().describe("Whether the viewer may currently send input"),
+  health: z.object({
+    reconnects: z.number().describe("Connections the viewer opened beyond the first one"),
+    pings: z.number().describe("Heartbeat pings sent to the viewer"),
+    missedPongs: z.number().describe("Heartbeat pings the viewer did not answer"),
+    deadlineExpirations: z
+      .number()
+      .describe("Connections closed because too many consecutive pings went unanswered"),
+    rttMs: z
+      .object({ p50: z.number(), p95: z.number(), max: z.number() })
+      .nullable()
+      .describe("Heartbeat round-trip time distribution of recent pings"),
   }),
 });
 
+const MultipleViewers = z.object({
+  viewers: z.array(ViewerDetails),
+});
+
+const LiveViewStats = z.object({
+  connections: z.array(
+    z.object({
+      connectionId: z.string().describe("Unique id of the viewer's connection"),
+      viewerId: z.string().describe("Id shared by all connections of the same viewer"),
+      pageId: z.string().nullable().describe("Page the connection is watching"),
+      framesSent: z.number().describe("Screencast frames sent to the connection"),
+      framesDropped: z
+        .number()
+        .describe("Changed frames not sent because the stream was paused or the link saturated"),
+      bytesSent: z.number().describe("Bytes of frame data sent to the connection"),
+      bitrateKbps: z.number().describe("Bitrate of frames sent over the last 5 seconds"),
+      rttMs: z
+        .object({ p50: z.number(), p95: z.number(), max: z.number() })
+        .nullable()
+        .describe("Heartbeat round-trip time distribution of recent pings"),
+      missedPongs: z.number().describe("Heartbeat pings the viewer did not answer"),
+    }),
+  ),
+});
+
+const LiveViewConnectionHistory = z.object({
+  connections: z.array(
+    z.object({
+      connectionId: z.string().describe("Unique id of the viewer's connection"),
+      viewerId: z.string().describe("Id shared by all connections of the same viewer"),
+      pageId: z.string().nullable().describe("Page the connection first attached to"),
+      openedAt: z.string().datetime().describe("Timestamp when the connection was attached"),
+      closedAt: z
+        .string()
+        .datetime()
+        .nullable()
+        .describe("Timestamp when the connection closed, null while open"),
+      closeCode: z.number().nullable().describe("WebSocket close code"),
+      closeReason: z.string().nullable().describe("WebSocket close reason"),
+      timeline: z
+        .array(
+          z.object({
+            at: z.string().datetime(),
+            event: z
+              .string()
+              .describe("connected, firstFrame, inputDropped, heartbeatTimeout or disconnected"),
+            detail: z.record(z.unknown()).optional(),
+          }),
+        )
+        .describe("Lifecycle events of the connection, oldest first"),
+    }),
+  ),
+  rejections: z.array(
+    z.object({
+      at: z.string().datetime(),
+      viewerId: z.string(),
+      reason: z.string().describe("Why the viewer was turned away, e.g. session_full"),
+    }),
+  ),
+});
+
+const FeatureFlagState = z.object({
+  name: z.string().describe("Name of the feature flag"),
+  description: z.string().describe("What the flag gates"),
+  enabled: z.boolean().describe("Whether the feature is enabled"),
+  source: z
+    .enum(["default", "file", "env", "api"])
+    .describe("Where the current value of the flag comes from"),
+});
+
+const CapabilitiesResponse = z.object({
+  featureFlags: z.array(FeatureFlagState),
+});
+
+const FeatureFlagUpdate = z.object({
+  enabled: z.boolean().describe("Whether the feature should be enabled"),
+});
+
+const MaintenanceRequest = z.object({
+  durationMs: z
+    .number()
+    .int()
+    .positive()
+    .max(24 * 60 * 60 * 1000)
+    .describe("How long new sessions are refused. Maintenance ends on its own afterwards."),
+  message: z
+    .string()
+    .max(1024)
+    .optional()
+    .describe("Notice shown to viewers of running sessions and returned to refused requests"),
+});
+
+const MaintenanceStatus = z.object({
+  active: z.boolean().describe("Whether new sessions are currently refused"),
+  message: z.string().optional(),
+  startedAt: z.string().datetime().optional(),
+  until: z.string().datetime().optional().describe("When maintenance ends on its own"),
+});
+
 const SessionStreamResponse = z.string().describe("HTML content for the session streamer view");
 
 const MultipleSessions = z.object({
@@ -195,6 +444,15 @@ export type CreateSessionRequest = FastifyRequest<{ Body: CreateSessionBody }>;
 export type SessionDetails = z.infer<typeof SessionDetails>;
 export type MultipleSessions = z.infer<typeof MultipleSessions>;
 
+export type ControlGrantRequest = z.infer<typeof ControlGrantRequest>;
+export type BandwidthLimitRequest = z.infer<typeof BandwidthLimitRequest>;
+export type SecretRequest = z.infer<typeof SecretRequest>;
+export type ResolutionRequest = z.infer<typeof ResolutionRequest>;
+export type StreamQualityRequest = z.infer<typeof StreamQualityRequest>;
+export type LiveScreenshotQuery = z.infer<typeof LiveScreenshotQuery>;
+export type FeatureFlagUpdate = z.infer<typeof FeatureFlagUpdate>;
+export type MaintenanceRequest = z.infer<typeof MaintenanceRequest>;
+
 export type SessionStreamQuery = z.infer<typeof SessionStreamQuery>;
 export type SessionStreamRequest = FastifyRequest<{ Querystring: SessionStreamQuery }>;
 
@@ -208,6 +466,22 @@ export const browserSchemas = {
   SessionStreamQuery,
   SessionStreamResponse,
   SessionLiveDetailsResponse,
+  ControlGrantRequest,
+  ControlGrantResponse,
+  BandwidthLimitRequest,
+  ResolutionRequest,
+  StreamQualityRequest,
+  StreamQuality,
+  LiveScreenshotQuery,
+  SecretRequest,
+  SecretList,
+  MultipleViewers,
+  LiveViewStats,
+  LiveViewConnectionHistory,
+  CapabilitiesResponse,
+  FeatureFlagUpdate,
+  MaintenanceRequest,
+  MaintenanceStatus,
 };
 
 export default browserSchemas;
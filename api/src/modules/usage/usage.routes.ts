@@ -0,0 +1,33 @@
+import { FastifyInstance, FastifyReply, FastifyRequest } from "fastify";
+import { $ref } from "../../plugins/schemas.js";
+import { formatUsageCsv } from "../../services/usage.service.js";
+import { UsageQuery } from "./usage.schema.js";
+
+async function routes(server: FastifyInstance) {
+  server.get(
+    "/usage",
+    {
+      schema: {
+        operationId: "get_usage",
+        description:
+          "Daily usage totals in UTC: sessions, live view connections and minutes, frame bytes, recordings and input events. Days older than USAGE_RETENTION_DAYS are not kept.",
+        tags: ["Metrics"],
+        summary: "Get daily usage",
+        querystring: $ref("UsageQuery"),
+        response: {
+          200: $ref("UsageSummary"),
+        },
+      },
+    },
+    async (request: FastifyRequest<{ Querystring: UsageQuery }>, reply: FastifyReply) => {
+      const { from, to, format } = request.query;
+      const days = server.usage.summary(from, to);
+      if (format === "csv") {
+        return reply.type("text/csv; charset=utf-8").send(formatUsageCsv(days));
+      }
+      return reply.send({ days });
+    },
+  );
+}
+
+export default routes;
@@ -0,0 +1,35 @@
+import { z } from "zod";
+
+const date = z
+  .string()
+  .regex(/^\d{4}-\d{2}-\d{2}$/)
+  .describe("UTC day, YYYY-MM-DD");
+
+const UsageQuery = z.object({
+  from: date.optional().describe("First day to include, YYYY-MM-DD"),
+  to: date.optional().describe("Last day to include, YYYY-MM-DD"),
+  format: z.enum(["json", "csv"]).optional().default("json").describe("Response format"),
+});
+
+const DailyUsage = z.object({
+  date,
+  sessions: z.number().describe("Sessions started"),
+  viewerConnections: z.number().describe("Live view connections opened"),
+  viewerMinutes: z.number().describe("Time live view connections were open, summed"),
+  frameBytes: z.number().describe("Frame data sent to live viewers"),
+  recordings: z.number().describe("Sessions whose recording started"),
+  inputEvents: z.number().describe("Viewer input messages dispatched to the browser"),
+});
+
+const UsageSummary = z.object({
+  days: z.array(DailyUsage).describe("Days with activity, oldest first"),
+});
+
+export type UsageQuery = z.infer<typeof UsageQuery>;
+
+export const usageSchemas = {
+  UsageQuery,
+  UsageSummary,
+};
+
+export default usageSchemas;
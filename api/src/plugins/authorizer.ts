@@ -0,0 +1,118 @@
+import { FastifyInstance, FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { env } from "../env.js";
+import { isLoopbackRequest } from "../utils/url.js";
+import {
+  Authorizer,
+  ChainAuthorizer,
+  HttpAuthorizer,
+  JwtAuthorizer,
+  NoneAuthorizer,
+  StaticTokenAuthorizer,
+} from "../services/authorizer.service.js";
+
+declare module "fastify" {
+  interface FastifyContextConfig {
+    /** Lets requests to the route through without an API key, e.g. for health checks */
+    skipAuth?: boolean;
+    /** Lets requests from this host through without an API key, e.g. from the browser itself */
+    skipAuthFromLoopback?: boolean;
+  }
+}
+
+export interface AuthorizerPluginOptions {
+  /** Replaces the authorizers configured through the environment */
+  authorizer?: Authorizer;
+}
+
+const AUTHORIZER_KINDS = ["none", "token", "jwt", "http"];
+
+/**
+ * Builds the authorizer from AUTHORIZER, or when it is unset from whichever of API_KEY, the live
+ * view JWT settings and AUTHORIZER_URL are configured.
+ */
+function createAuthorizer(fastify: FastifyInstance): Authorizer {
+  const apiKeys = (env.API_KEY ?? "")
+    .split(",")
+    .map((key) => key.trim())
+    .filter(Boolean);
+  const jwtOptions = {
+    secret: env.LIVE_VIEW_JWT_SECRET,
+    jwksUrl: env.LIVE_VIEW_JWT_JWKS_URL,
+    audience: env.LIVE_VIEW_JWT_AUDIENCE,
+    issuer: env.LIVE_VIEW_JWT_ISSUER,
+  };
+
+  let kinds = env.AUTHORIZER;
+  if (kinds.length === 0) {
+    kinds = [
+      ...(apiKeys.length > 0 ? ["token"] : []),
+      ...(jwtOptions.secret || jwtOptions.jwksUrl ? ["jwt"] : []),
+      ...(env.AUTHORIZER_URL ? ["http"] : []),
+    ];
+  }
+  const unknownKinds = kinds.filter((kind) => !AUTHORIZER_KINDS.includes(kind));
+  if (unknownKinds.length > 0) {
+    throw new Error(`Unknown AUTHORIZER ${unknownKinds.join(",")}`);
+  }
+
+  const authorizers: Authorizer[] = [];
+  for (const kind of kinds) {
+    switch (kind) {
+      case "none":
+        return new NoneAuthorizer();
+      case "token":
+        if (apiKeys.length === 0) {
+          throw new Error("The token authorizer requires API_KEY");
+        }
+        authorizers.push(new StaticTokenAuthorizer(apiKeys));
+        break;
+      case "jwt":
+        if (!jwtOptions.secret && !jwtOptions.jwksUrl) {
+          throw new Error(
+            "The jwt authorizer requires LIVE_VIEW_JWT_SECRET or LIVE_VIEW_JWT_JWKS_URL",
+          );
+        }
+        authorizers.push(new JwtAuthorizer(jwtOptions));
+        break;
+      case "http":
+        if (!env.AUTHORIZER_URL) {
+          throw new Error("The http authorizer requires AUTHORIZER_URL");
+        }
+        authorizers.push(
+          new HttpAuthorizer(fastify.log, {
+            url: env.AUTHORIZER_URL,
+            timeoutMs: env.AUTHORIZER_TIMEOUT_MS,
+            cacheMs: env.AUTHORIZER_CACHE_MS,
+          }),
+        );
+        break;
+    }
+  }
+  return authorizers.length > 0 ? new ChainAuthorizer(authorizers) : new NoneAuthorizer();
+}
+
+const authorizerPlugin: FastifyPluginAsync<AuthorizerPluginOptions> = async (fastify, options) => {
+  const authorizer = options.authorizer ?? createAuthorizer(fastify);
+  fastify.decorate("authorizer", authorizer);
+  if (authorizer instanceof NoneAuthorizer) {
+    return;
+  }
+
+  fastify.log.info({ authorizer: authorizer.name }, "Authorization enabled");
+
+  fastify.addHook("onRequest", async (request, reply) => {
+    if (request.method === "OPTIONS" || request.routeOptions.config?.skipAuth) {
+      return;
+    }
+    if (request.routeOptions.config?.skipAuthFromLoopback && isLoopbackRequest(request.raw)) {
+      return;
+    }
+    const decision = await authorizer.checkAdmin(request.raw);
+    if (!decision.allowed) {
+      return reply.code(401).send({ success: false, message: decision.reason ?? "Unauthorized" });
+    }
+  });
+};
+
+export default fp(authorizerPlugin);
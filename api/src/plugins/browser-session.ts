@@ -8,8 +8,10 @@ const browserSessionPlugin: FastifyPluginAsync = async (fastify, _options) => {
     seleniumService: fastify.seleniumService,
     fileService: fastify.fileService,
     logger: fastify.log,
+    eventBus: fastify.eventBus,
   });
   fastify.decorate("sessionService", sessionService);
+  await sessionService.cleanUpScratch();
 };
 
 export default fp(browserSessionPlugin, "5.x");
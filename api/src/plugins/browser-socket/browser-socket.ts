@@ -1,8 +1,18 @@
 import { type FastifyInstance, type FastifyPluginAsync } from "fastify";
 import fp from "fastify-plugin";
 import { WebSocketServer } from "ws";
+import { env } from "../../env.js";
 import { WebSocketRegistryService } from "../../services/websocket-registry.service.js";
-import { WebSocketHandler, WebSocketHandlerContext } from "../../types/websocket.js";
+import { Gauge } from "../../services/metrics.service.js";
+import { ScreencastService } from "../../services/screencast.service.js";
+import { getTargetId } from "../../utils/browser.js";
+import { WorkQueue } from "../../utils/work-queue.js";
+import { redactUrl } from "../../utils/url.js";
+import {
+  WebSocketHandler,
+  WebSocketHandlerContext,
+  WebSocketHandlerMatch,
+} from "../../types/websocket.js";
 import { defaultHandlers } from "./handlers/index.js";
 
 export interface BrowserSocketOptions {
@@ -10,7 +20,14 @@ export interface BrowserSocketOptions {
 }
 
 // WebSocket server instance
-const wss = new WebSocketServer({ noServer: true });
+const wss = new WebSocketServer({
+  noServer: true,
+  // Screencast frames are already compressed images, so only compress when bandwidth matters
+  // more than the CPU cost
+  perMessageDeflate: env.WEBSOCKET_COMPRESSION
+    ? { threshold: 1024, zlibDeflateOptions: { level: 1 } }
+    : false,
+});
 
 const browserWebSocket: FastifyPluginAsync<BrowserSocketOptions> = async (
   fastify: FastifyInstance,
@@ -36,26 +53,83 @@ const browserWebSocket: FastifyPluginAsync<BrowserSocketOptions> = async (
 
   fastify.decorate("webSocketRegistry", registry);
 
+  // Shared by all live view connections so a burst of input cannot flood the browser
+  const inputQueue = new WorkQueue({
+    concurrency: env.LIVE_VIEW_INPUT_CONCURRENCY,
+    maxQueued: env.LIVE_VIEW_INPUT_QUEUE_SIZE,
+    timeoutMs: env.LIVE_VIEW_INPUT_TIMEOUT_MS,
+  });
+  fastify.decorate("inputQueue", inputQueue);
+  fastify.metrics.register(
+    new Gauge("steel_live_view_input_queue_depth", "Viewer input waiting to be dispatched", () =>
+      inputQueue.queued,
+    ),
+  );
+  fastify.metrics.register(
+    new Gauge("steel_live_view_input_active", "Viewer input being dispatched", () =>
+      inputQueue.active,
+    ),
+  );
+
+  // Viewers of the same page share one screencast of it, captured with a CDP session of the
+  // server's own, as the connection of any one viewer ends when it leaves
+  const screencasts = new ScreencastService(
+    async (pageId) => {
+      const pages = await fastify.cdpService.getAllPages();
+      const page = pages.find((page) => getTargetId(page) === pageId);
+      if (!page) {
+        throw new Error(`Page ${pageId} not found`);
+      }
+      return page.target().createCDPSession();
+    },
+    () => fastify.featureFlags.isEnabled("liveViewIdleThrottle"),
+  );
+  fastify.decorate("screencasts", screencasts);
+  fastify.metrics.register(
+    new Gauge("steel_live_view_screencasts", "Page screencasts shared by live viewers", () =>
+      screencasts.active,
+    ),
+  );
+
   fastify.server.on("upgrade", async (request, socket, head) => {
     fastify.log.info("Upgrading browser socket...");
+
     const url = request.url ?? "";
-    const params = Object.fromEntries(
-      new URL(url || "", `http://${request.headers.host}`).searchParams.entries(),
-    );
+    let params: Record<string, string>;
+    let match: WebSocketHandlerMatch | undefined;
+    try {
+      params = Object.fromEntries(
+        new URL(url || "", `http://${request.headers.host}`).searchParams.entries(),
+      );
+      match = registry.match(url);
+    } catch (err) {
+      fastify.log.warn({ err }, "Rejecting WebSocket upgrade with a malformed URL");
+      socket.write("HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n");
+      socket.destroy();
+      return;
+    }
+
+    if (!match?.handler.authorizesUpgrade) {
+      const decision = await fastify.authorizer.checkAdmin(request);
+      if (!decision.allowed) {
+        fastify.log.warn({ reason: decision.reason }, "Rejecting unauthorized WebSocket upgrade");
+        socket.write("HTTP/1.1 401 Unauthorized\r\nConnection: close\r\n\r\n");
+        socket.destroy();
+        return;
+      }
+    }
 
     const context: WebSocketHandlerContext = {
       fastify,
       wss,
-      params,
+      params: { ...params, ...match?.params },
     };
 
-    const handler = registry.matchHandler(url);
-
-    if (handler) {
+    if (match) {
       try {
-        await handler.handler(request, socket, head, context);
+        await match.handler.handler(request, socket, head, context);
       } catch (err) {
-        fastify.log.error({ err }, `WebSocket handler error for ${url}`);
+        fastify.log.error({ err }, `WebSocket handler error for ${redactUrl(url)}`);
         socket.destroy();
       }
     } else {
@@ -1,28 +1,140 @@
+import fs from "fs";
 import { IncomingMessage } from "http";
+import path from "path";
 import puppeteer, { Browser, CDPSession, Page } from "puppeteer-core";
 import { Duplex } from "stream";
-import WebSocket, { Server } from "ws";
+import { v4 as uuidv4 } from "uuid";
+import WebSocket from "ws";
 
 import { env } from "../../env.js";
-import { SessionService } from "../../services/session.service.js";
+import { EmitEvent } from "../../types/enums.js";
 import {
+  ClipboardSyncEvent,
+  ClipboardWriteEvent,
   CloseTabEvent,
+  FileUploadChunkEvent,
+  FileUploadEndEvent,
+  FileUploadStartEvent,
+  GestureEvent,
   GetSelectedTextEvent,
+  GrantControlEvent,
+  KeyboardLayoutEvent,
+  KeyComboEvent,
   KeyEvent,
   MouseEvent,
   NavigationEvent,
+  NetworkChangedEvent,
   PageInfo,
+  PasteSecretEvent,
+  StreamQualityEvent,
+  TextInputEvent,
+  TouchEvent,
+  WindowEvent,
 } from "../../types/casting.js";
-import { getPageFavicon, getPageTitle, navigatePage } from "../../utils/casting.js";
+import { WebSocketHandlerContext } from "../../types/websocket.js";
+import { DLP_DENIED_MESSAGE } from "../../services/dlp.service.js";
+import { BusEvents } from "../../services/event-bus.service.js";
+import { FileService } from "../../services/file.service.js";
+import { ScreencastSubscription } from "../../services/screencast.service.js";
+import { getTargetId } from "../../utils/browser.js";
+import { getBuildInfo } from "../../utils/build-info.js";
+import { JwtClaims } from "../../utils/jwt.js";
+import { verifyViewerToken } from "../../utils/viewer-token.js";
+import { tracer } from "../../telemetry/tracer.js";
+import { WorkQueueFullError, WorkQueueTimeoutError } from "../../utils/work-queue.js";
+import { withTimeout } from "../../utils/timeout.js";
+import { TokenBucket } from "../../utils/token-bucket.js";
+import {
+  captureClipboard,
+  isCopyCausedBy,
+  parseClipboardCapture,
+  writePageClipboard,
+} from "../../utils/clipboard-capture.js";
+import { parseBinaryCastMessage, parseCastMessage } from "../../utils/cast-message.js";
+import { captureCursor, parseCursorCapture } from "../../utils/cursor-capture.js";
+import { watchNativeDialogs } from "../../utils/native-dialog.js";
+import { parseKeyCombo } from "../../utils/keymap.js";
+import {
+  getSessionStreamSettings,
+  isSessionStreamPreset,
+  resolveStreamQuality,
+  StreamQuality,
+} from "../../utils/stream-quality.js";
+import { isKeyboardLayout, KeyboardLayout } from "../../utils/keyboard-layouts.js";
+import { FileUploadError, FileUploadReceiver, ReceivedFile } from "../../utils/file-upload.js";
+import {
+  AdaptiveQuality,
+  ClipboardWriteError,
+  dropFilesIntoPage,
+  ensurePageFocus,
+  gestureToWheelSteps,
+  getPageFavicon,
+  getPageSelection,
+  getPageTitle,
+  getScreencastSettings,
+  getTypingTimeoutMs,
+  getViewportSize,
+  MouseMoveCoalescer,
+  navigatePage,
+  pasteIntoPage,
+  performWindowAction,
+  pressKeyCombo,
+  toCdpTouchEvent,
+  typeIntoPage,
+} from "../../utils/casting.js";
+
+const INPUT_EVENT_TYPES = new Set([
+  "mouseEvent",
+  "touch",
+  "gesture",
+  "keyEvent",
+  "keyCombo",
+  "textInput",
+  "pasteSecret",
+  "fileUploadStart",
+  "fileUploadChunk",
+  "fileUploadEnd",
+  "fileUploadCancel",
+  "navigation",
+  "closeTab",
+  "clipboardWrite",
+  "clipboardSync",
+  "grantControl",
+  "recordingConsent",
+  "window",
+  "pauseSession",
+  "resumeSession",
+]);
+
+// Pause between the wheel events of a gesture, about one frame
+const GESTURE_STEP_INTERVAL_MS = 16;
+
+// Clipboard writes of the page are only handed to a viewer whose input could have caused them
+const CLIPBOARD_INPUT_WINDOW_MS = 2000;
+
+const liveViewTracer = tracer.factory("live-view");
+
+// A coalesced move keeps the times of the message it came from
+type MouseMove = { event: MouseEvent["event"]; receivedAt: number; clientTs?: number };
 
 export async function handleCastSession(
   request: IncomingMessage,
   socket: Duplex,
   head: Buffer,
-  wss: Server,
-  sessionService: SessionService,
-  params: Record<string, string> | undefined,
+  context: WebSocketHandlerContext,
 ): Promise<void> {
+  const { wss, params } = context;
+  const {
+    sessionService,
+    cdpService,
+    viewerService,
+    featureFlags,
+    eventBus,
+    inputQueue,
+    screencasts,
+    authorizer,
+    dlp,
+  } = context.fastify;
   const id = request.url?.split("/sessions/")[1].split("/cast")[0];
 
   if (!id) {
@@ -39,8 +151,98 @@ export async function handleCastSession(
   }
 
   const queryParams = new URLSearchParams(request.url?.split("?")[1] || "");
-  const requestedPageId = params?.pageId || queryParams.get("pageId") || null;
+
+  // Browsers cannot set headers on WebSocket requests, so the token may also be passed as a
+  // query parameter
+  const token =
+    params?.token ||
+    queryParams.get("token") ||
+    request.headers.authorization?.replace(/^Bearer\s+/i, "") ||
+    null;
+  // The live view page is served with a token of its own, only issued once the page request passed
+  // the same upgrade check as a socket, and capped at what the credential it carried allows. Its
+  // sockets therefore never need the admin API key, nor the JWT the page was opened with.
+  const viewerTokenClaims = token ? await verifyViewerToken(token) : null;
+  const upgradeDecision = viewerTokenClaims
+    ? { allowed: true, claims: viewerTokenClaims }
+    : await authorizer.checkUpgrade(request, { sessionId: session.id, token });
+  if (!upgradeDecision.allowed) {
+    context.fastify.log.warn(
+      { reason: upgradeDecision.reason },
+      "Refusing unauthorized cast connection",
+    );
+    socket.write("HTTP/1.1 401 Unauthorized\r\nConnection: close\r\n\r\n");
+    socket.destroy();
+    return;
+  }
+  const tokenClaims: JwtClaims | null = upgradeDecision.claims ?? null;
+
+  // Clients that know which session they expect must never be attached to a different one
+  const requestedSessionIds = [
+    params?.sessionId || queryParams.get("sessionId"),
+    tokenClaims?.sessionId as string | undefined,
+  ];
+  if (requestedSessionIds.some((requested) => requested && requested !== session.id)) {
+    context.fastify.log.warn(
+      { requestedSessionIds, activeSessionId: session.id },
+      "Refusing cast connection for a session that is not active",
+    );
+    socket.destroy();
+    return;
+  }
+  const sessionId = session.id;
+  // Viewers are identified by what the server issued them, the subject of their token or the
+  // connection they resume. An id a client picked itself could claim another viewer's control
+  // grant, so one that differs is refused.
+  const tokenViewerId =
+    typeof tokenClaims?.sub === "string" && tokenClaims.sub ? tokenClaims.sub : null;
+  const requestedViewerId = params?.viewerId || queryParams.get("viewerId");
+  if (requestedViewerId && requestedViewerId !== tokenViewerId) {
+    context.fastify.log.warn("Refusing cast connection with a viewer id its token does not carry");
+    socket.write("HTTP/1.1 403 Forbidden\r\nConnection: close\r\n\r\n");
+    socket.destroy();
+    return;
+  }
+  // A viewer whose socket dropped presents the resume token of its previous connection to pick up
+  // where it left off, as the same viewer on the same page with the same settings
+  const resumeToken = params?.resumeToken || queryParams.get("resumeToken");
+  const resumed = resumeToken ? viewerService.resume(resumeToken, sessionId) : null;
+  if (resumeToken && !resumed) {
+    context.fastify.log.info("Cast resume token is unknown or expired, connecting as new");
+  }
+  const requestedPageId =
+    params?.pageId || queryParams.get("pageId") || resumed?.pageId || null;
   const requestedPageIndex = params?.pageIndex || queryParams.get("pageIndex") || null;
+  const connectionId = uuidv4();
+  const viewerId = resumed?.viewerId || tokenViewerId || connectionId;
+  // View-only connections can watch (and copy from) the session but never drive it
+  const viewOnly =
+    !!resumed?.viewOnly ||
+    (params?.mode || queryParams.get("mode")) === "view" ||
+    tokenClaims?.permission === "view";
+  // Dry-run connections have their input validated and acknowledged but never dispatched, so
+  // clients can check their event streams and coordinates against the live page
+  const dryRun = (params?.dryRun || queryParams.get("dryRun")) === "true";
+  // Key events are read in the viewer's own layout, so viewers with different keyboards can type
+  // into the same session. Viewers can switch it later with a keyboardLayout message.
+  const requestedLayout = params?.keyboardLayout || queryParams.get("keyboardLayout");
+  const resumedLayout = resumed?.keyboardLayout;
+  let keyboardLayout: KeyboardLayout = isKeyboardLayout(requestedLayout)
+    ? requestedLayout
+    : isKeyboardLayout(resumedLayout)
+      ? resumedLayout
+      : "us";
+  // Tokens may cap the frame bitrate, e.g. for free-tier viewers. A limit set through the API
+  // takes precedence.
+  const tokenBitrateKbps =
+    typeof tokenClaims?.maxBitrateKbps === "number" && tokenClaims.maxBitrateKbps > 0
+      ? tokenClaims.maxBitrateKbps
+      : null;
+  // Tokens may also pick a stream preset for their viewer, e.g. low-bandwidth for mobile clients
+  const tokenStreamPreset = tokenClaims?.streamPreset;
+  const tokenStreamSettings = isSessionStreamPreset(tokenStreamPreset)
+    ? getSessionStreamSettings(tokenStreamPreset)
+    : null;
 
   const tabDiscoveryMode =
     queryParams.get("tabInfo") === "true" || (!requestedPageId && !requestedPageIndex);
@@ -49,37 +251,469 @@ export async function handleCastSession(
   const defaultDimensions = isMobile ? { width: 508, height: 1074 } : { width: 1920, height: 1080 };
   const { height, width } =
     (session.dimensions as { width: number; height: number }) ?? defaultDimensions;
+  const screencastSettings = getScreencastSettings(
+    tokenStreamSettings?.screenContent ?? session.screenContent,
+  );
+
+  // Viewers that already have a connection may open more, e.g. one per tab, and a resumed
+  // connection takes the place it had. Viewer ids are issued by the server, so a client cannot
+  // share the place of another viewer. The place is held from here, as setting up the connection
+  // takes a while, until the connection registers or its socket closes.
+  if (!viewerService.reserve(connectionId, viewerId, resumed ? 0 : env.MAX_VIEWERS)) {
+    eventBus.publish("viewer.rejected", {
+      viewerId,
+      sessionId: session.id,
+      reason: "session_full",
+    });
+    wss.handleUpgrade(request, socket, head, (ws) => {
+      ws.send(
+        JSON.stringify({
+          type: "error",
+          code: "session_full",
+          message: `The session already has the maximum of ${env.MAX_VIEWERS} viewers`,
+          maxViewers: env.MAX_VIEWERS,
+          seq: 1,
+          ts: Date.now(),
+        }),
+      );
+      ws.close(1013, "session_full");
+    });
+    return;
+  }
+
+  socket.once("close", () => viewerService.releaseReservation(connectionId));
 
   wss.handleUpgrade(request, socket, head, async (ws) => {
+    // Every message to the viewer is numbered and stamped with its send time, so the viewer's
+    // timeline of the connection can be lined up with the server's when an incident is analyzed
+    let sentMessages = 0;
+    const sendMessage = (message: Record<string, unknown>) => {
+      sentMessages += 1;
+      ws.send(JSON.stringify({ ...message, seq: sentMessages, ts: Date.now() }));
+    };
+
+    // Covers attaching to the browser and page up to the first screencast request
+    const connectSpan = liveViewTracer.startSpan("liveView.connect", {
+      attributes: { "steel.session.id": sessionId, "liveView.viewer.id": viewerId },
+    });
+    let connectSpanEnded = false;
+    const endConnectSpan = (error?: unknown) => {
+      if (connectSpanEnded) {
+        return;
+      }
+      connectSpanEnded = true;
+      if (error instanceof Error) {
+        connectSpan.recordException(error);
+      }
+      connectSpan.end();
+    };
+
     let browser: Browser | null = null;
     let targetPage: Page | null = null;
     let targetClient: CDPSession | null = null;
     let targetPageId: string | null = null;
+    // Frames come from the page's screencast, shared with the other viewers of the page
+    let screencast: ScreencastSubscription | null = null;
 
     const activePages = new Map<string, Page>();
+    const adaptiveQuality = new AdaptiveQuality();
+    // Uploads are spooled with the session's other temporary files, so they go when it ends
+    const uploads = new FileUploadReceiver({
+      maxBytes: env.LIVE_VIEW_MAX_UPLOAD_BYTES,
+      directory: await sessionService.scratch.directory(sessionId).catch((err) => {
+        console.error("Error creating the session scratch directory:", err);
+        return undefined;
+      }),
+    });
+    // Where in the page each upload in progress should be dropped once it is saved
+    const uploadDrops = new Map<number, { x: number; y: number }>();
 
     let heartbeatInterval: NodeJS.Timeout | null = null;
+    let cursorInterval: NodeJS.Timeout | null = null;
+    let egressBucket: TokenBucket | null = null;
+    let frameBucket: TokenBucket | null = null;
+    let egressRetryTimer: NodeJS.Timeout | null = null;
+    let lastInputAt = 0;
+    // Moves are coalesced instead, since their cost is bounded that way
+    const inputBucket =
+      env.LIVE_VIEW_INPUT_RATE_LIMIT > 0
+        ? new TokenBucket(env.LIVE_VIEW_INPUT_RATE_LIMIT, env.LIVE_VIEW_INPUT_RATE_LIMIT * 2)
+        : null;
+    let connectionOpen = false;
+    // Token this connection can be resumed with after its socket drops
+    let nextResumeToken: string | null = null;
+    let unsubscribePaused: (() => void) | null = null;
+    let unsubscribeResumed: (() => void) | null = null;
+    let unsubscribeResized: (() => void) | null = null;
+
+    const handleRecordingStarted = (payload: { sessionId: string }) => {
+      if (ws.readyState === WebSocket.OPEN) {
+        sendMessage({ type: "recordingStarted", sessionId: payload.sessionId });
+      }
+    };
+
+    // Input coordinates are clamped to the page's actual viewport, refreshed whenever it resizes
+    const viewport = { width, height };
+    let screencastQuality = screencastSettings.quality;
+    // A quality the viewer picked with a quality message or its token wins over the session's
+    let connectionQuality: StreamQuality | null =
+      resumed?.streamQuality ?? tokenStreamSettings?.quality ?? null;
+    const streamQuality = () => connectionQuality ?? viewerService.getStreamQuality();
+
+    // Adaptive quality moves below the quality of the stream preset, never above it
+    const wantedQuality = (quality = screencastQuality) =>
+      screencastSettings.format === "jpeg"
+        ? Math.min(quality ?? 100, streamQuality().quality)
+        : quality;
+
+    const setScreencastQuality = async (quality = screencastQuality) => {
+      screencastQuality = quality;
+      await screencast?.setQuality(wantedQuality(quality));
+    };
+
+    const refreshViewport = async () => {
+      const client = targetClient;
+      if (!client) {
+        return;
+      }
+
+      Object.assign(viewport, await getViewportSize(client));
+      if (ws.readyState === WebSocket.OPEN) {
+        sendMessage({ type: "displayInfo", pageId: targetPageId, ...viewport });
+      }
+
+      // A screencast that keeps its old size would scale every frame of the resized page
+      await screencast?.fitViewport(viewport);
+    };
+
+    // Viewers are told before the stream resizes, so they can hold the last frame until one of the
+    // new size arrives
+    const handleStreamResized = (size: { width: number; height: number }) => {
+      if (ws.readyState === WebSocket.OPEN) {
+        sendMessage({ type: "streamResized", pageId: targetPageId, ...size });
+      }
+    };
+
+    // Latest captured frame, kept so a resumed stream can show the current page right away
+    let latestFrame: string | null = null;
+    let firstFrameSent = false;
+
+    const isRateLimited = (bytes: number) => {
+      const { maxFps } = streamQuality();
+      if (!maxFps) {
+        frameBucket = null;
+      } else if (frameBucket) {
+        frameBucket.setRate(maxFps, 1);
+      } else {
+        frameBucket = new TokenBucket(maxFps, 1);
+      }
+      // Checked first so a frame held back by the frame rate does not use up the bitrate
+      if (frameBucket && frameBucket.msUntilAvailable() > 0) {
+        return true;
+      }
+
+      const maxBitrateKbps =
+        viewerService.getBandwidthLimit(viewerId) ??
+        tokenBitrateKbps ??
+        streamQuality().maxBitrateKbps;
+      if (!maxBitrateKbps) {
+        egressBucket = null;
+        frameBucket?.tryConsume(1);
+        return false;
+      }
+
+      const bytesPerSecond = (maxBitrateKbps * 1000) / 8;
+      if (egressBucket) {
+        egressBucket.setRate(bytesPerSecond);
+      } else {
+        egressBucket = new TokenBucket(bytesPerSecond);
+      }
+      if (!egressBucket.tryConsume(bytes)) {
+        return true;
+      }
+      frameBucket?.tryConsume(1);
+      return false;
+    };
+
+    const sendFrame = async (data: string) => {
+      if (ws.readyState !== WebSocket.OPEN || !targetPage) {
+        return;
+      }
+      if (egressRetryTimer) {
+        clearTimeout(egressRetryTimer);
+        egressRetryTimer = null;
+      }
+
+      // Get page metadata
+      const title = await getPageTitle(targetPage);
+      const favicon = await getPageFavicon(targetPage);
+
+      // Send frame data
+      sendMessage({
+        pageId: targetPageId,
+        url: targetPage.url(),
+        title,
+        favicon,
+        format: screencastSettings.format,
+        data,
+      });
+      eventBus.publish("media.frameSent", { connectionId, bytes: data.length });
+      if (!firstFrameSent) {
+        firstFrameSent = true;
+        eventBus.publish("media.firstFrame", { connectionId, viewerId, sessionId });
+      }
+    };
+
+    // A frame dropped by the bandwidth or frame rate cap may be the last one before the page
+    // goes static, so the latest frame is sent once the caps allow it unless a newer frame goes
+    // out first
+    const scheduleLatestFrame = () => {
+      if (egressRetryTimer || (!egressBucket && !frameBucket)) {
+        return;
+      }
+
+      egressRetryTimer = setTimeout(() => {
+        egressRetryTimer = null;
+        if (!latestFrame || viewerService.isBlanked() || sessionService.isPaused()) {
+          return;
+        }
+        if (isRateLimited(latestFrame.length)) {
+          scheduleLatestFrame();
+          return;
+        }
+        sendFrame(latestFrame).catch((err) => {
+          console.error("Error sending frame held back by the bandwidth limit:", err);
+        });
+      }, Math.max(egressBucket?.msUntilAvailable() ?? 0, frameBucket?.msUntilAvailable() ?? 0));
+    };
+
+    const handleFrame = async (data: string, changed: boolean) => {
+      latestFrame = data;
+
+      // Lower the JPEG quality while the viewer's link cannot keep up, and raise it again once it
+      // can. Other viewers of the page keep getting frames of the quality they can take.
+      if (
+        screencastSettings.format === "jpeg" &&
+        featureFlags.isEnabled("liveViewAdaptiveQuality")
+      ) {
+        const quality = adaptiveQuality.observe(ws.bufferedAmount);
+        if (quality !== null) {
+          await setScreencastQuality(quality);
+        }
+      }
+
+      // Identical frames carry nothing new for the viewer, a blanked or paused stream shows
+      // nothing, frames queued behind a saturated link would only arrive stale, and a viewer with
+      // a bandwidth cap only gets frames as fast as the cap allows
+      const dropReason = !changed
+        ? "unchanged"
+        : viewerService.isBlanked()
+          ? "blanked"
+          : sessionService.isPaused()
+            ? "paused"
+            : adaptiveQuality.isSaturated(ws.bufferedAmount)
+              ? "saturated"
+              : isRateLimited(data.length)
+                ? "rate_limited"
+                : null;
+      if (dropReason) {
+        eventBus.publish("media.frameDropped", { connectionId, reason: dropReason });
+        if (dropReason === "rate_limited") {
+          scheduleLatestFrame();
+        }
+      } else {
+        await sendFrame(data);
+      }
+    };
+
+    const sendStreamQuality = () => {
+      if (ws.readyState === WebSocket.OPEN) {
+        sendMessage({ type: "streamQuality", pageId: targetPageId, ...streamQuality() });
+      }
+    };
+
+    const applyStreamQuality = async () => {
+      screencast?.wake();
+      await setScreencastQuality();
+    };
+
+    const handleStreamQualityChanged = () => {
+      if (connectionQuality) {
+        return;
+      }
+      sendStreamQuality();
+      applyStreamQuality().catch((err) => {
+        console.error("Error applying the stream quality:", err);
+      });
+    };
+
+    const handleStreamResumed = () => {
+      screencast?.wake();
+      if (latestFrame) {
+        sendFrame(latestFrame).catch((err) => {
+          console.error("Error sending frame after resuming stream:", err);
+        });
+      }
+    };
+
+    const handleSessionPaused = () => {
+      if (ws.readyState === WebSocket.OPEN) {
+        sendMessage({ type: "sessionPaused", sessionId });
+      }
+    };
+
+    const handleSessionResumed = () => {
+      if (ws.readyState === WebSocket.OPEN) {
+        sendMessage({ type: "sessionResumed", sessionId });
+      }
+      handleStreamResumed();
+    };
+
+    const setDeviceMetrics = async (
+      client: CDPSession,
+      size: { width: number; height: number },
+    ) => {
+      await client.send("Page.setDeviceMetricsOverride", {
+        screenHeight: size.height,
+        screenWidth: size.width,
+        width: size.width,
+        height: size.height,
+        mobile: isMobile,
+        screenOrientation: isMobile
+          ? { angle: 0, type: "portraitPrimary" }
+          : { angle: 90, type: "landscapePrimary" },
+        deviceScaleFactor: isMobile ? 3 : 1,
+      });
+    };
+
+    // The resized page reports its new viewport, which resizes the stream
+    const handleSessionResized = ({
+      sessionId: resizedSessionId,
+      ...size
+    }: BusEvents["session.resized"]) => {
+      const client = targetClient;
+      if (resizedSessionId !== sessionId || !client) {
+        return;
+      }
+      setDeviceMetrics(client, size)
+        .then(refreshViewport)
+        .catch((err) => {
+          console.error("Error resizing the page:", err);
+        });
+    };
+
+    const dispatchMouseEvent = async (event: MouseEvent["event"]) => {
+      const client = targetClient;
+      if (!client) {
+        return;
+      }
+      await inputQueue.run(() =>
+        client.send("Input.dispatchMouseEvent", {
+          type: event.type,
+          x: event.x,
+          y: event.y,
+          button: event.button,
+          buttons: event.button === "none" ? 0 : 1,
+          clickCount: event.clickCount || 1,
+          modifiers: event.modifiers || 0,
+          deltaX: event.deltaX,
+          deltaY: event.deltaY,
+        }),
+      );
+      if (targetPageId) {
+        viewerService.setPointer(targetPageId, event.x, event.y);
+      }
+    };
+
+    // A fast mouse sends far more moves than the browser needs, only the latest one matters
+    const mouseMoves = new MouseMoveCoalescer<MouseMove>(
+      async ({ event, receivedAt, clientTs }) => {
+        const startedAt = performance.now();
+        await dispatchMouseEvent(event);
+        eventBus.publish("input.dispatched", {
+          connectionId,
+          viewerId,
+          type: "mouseEvent",
+          durationSeconds: (performance.now() - startedAt) / 1000,
+          receivedAt,
+          clientTs,
+        });
+      },
+      env.LIVE_VIEW_MOUSE_MOVE_INTERVAL_MS,
+      (err, { receivedAt, clientTs }) => {
+        if (err instanceof WorkQueueFullError || err instanceof WorkQueueTimeoutError) {
+          eventBus.publish("input.dropped", {
+            connectionId,
+            viewerId,
+            type: "mouseEvent",
+            reason: err instanceof WorkQueueFullError ? "queue_full" : "timeout",
+            receivedAt,
+            clientTs,
+          });
+          return;
+        }
+        console.error("Error dispatching a mouse move:", err);
+      },
+    );
+
+    const handleSessionCleanup = (code?: number, reason?: string) => {
+      mouseMoves.cancel();
+      uploadDrops.clear();
+      uploads.cancelAll().catch((err) => {
+        console.error("Error discarding unfinished uploads:", err);
+      });
+      viewerService.unregister(connectionId);
+      if (nextResumeToken) {
+        viewerService.releaseResumeToken(nextResumeToken, env.LIVE_VIEW_RESUME_GRACE_MS);
+        nextResumeToken = null;
+      }
+      viewerService.removeListener("streamResumed", handleStreamResumed);
+      viewerService.removeListener("streamQualityChanged", handleStreamQualityChanged);
+      cdpService.removeListener(EmitEvent.RecordingStarted, handleRecordingStarted);
+      unsubscribePaused?.();
+      unsubscribeResumed?.();
+      unsubscribeResized?.();
+
+      if (connectionOpen) {
+        connectionOpen = false;
+        eventBus.publish("viewer.disconnected", {
+          connectionId,
+          viewerId,
+          sessionId,
+          code,
+          reason,
+        });
+      }
 
-    const handleSessionCleanup = () => {
       if (heartbeatInterval) {
         clearInterval(heartbeatInterval);
         heartbeatInterval = null;
       }
 
+      if (cursorInterval) {
+        clearInterval(cursorInterval);
+        cursorInterval = null;
+      }
+
+      if (egressRetryTimer) {
+        clearTimeout(egressRetryTimer);
+        egressRetryTimer = null;
+      }
+
       if (targetPage) {
         targetPage.removeAllListeners("framenavigated");
       }
 
-      // Clean up screencast
+      // Leave the screencast, which stops once the page's last viewer is gone
+      if (screencast) {
+        screencast.unsubscribe().catch((err) => {
+          console.error("Error leaving the screencast:", err);
+        });
+        screencast = null;
+      }
+
       if (targetClient) {
         try {
-          targetClient.send("Page.stopScreencast").catch((err) => {
-            // Ignore errors about closed targets
-            if (!err.message?.includes("Target closed")) {
-              console.error("Error stopping screencast:", err);
-            }
-          });
-
           targetClient.detach().catch((err) => {
             // Ignore errors about closed targets
             if (!err.message?.includes("Target closed")) {
@@ -115,6 +749,23 @@ export async function handleCastSession(
       }
     };
 
+    const sendUploadFailure = (pageId: string | null, uploadId: number, error: unknown) => {
+      if (!(error instanceof FileUploadError)) {
+        console.error("Failed to receive an uploaded file:", error);
+      }
+      if (ws.readyState !== WebSocket.OPEN) {
+        return;
+      }
+      sendMessage({
+        type: "fileUploadResponse",
+        pageId,
+        uploadId,
+        success: false,
+        code: error instanceof FileUploadError ? error.code : undefined,
+        error: error instanceof Error ? error.message : "Unknown error",
+      });
+    };
+
     const sendTabList = async () => {
       try {
         if (ws.readyState !== WebSocket.OPEN || !tabDiscoveryMode) return;
@@ -130,13 +781,11 @@ export async function handleCastSession(
           });
         }
 
-        ws.send(
-          JSON.stringify({
-            type: "tabList",
-            tabs: tabList,
-            firstTabId: tabList.length > 0 ? tabList[0].id : null,
-          }),
-        );
+        sendMessage({
+          type: "tabList",
+          tabs: tabList,
+          firstTabId: tabList.length > 0 ? tabList[0].id : null,
+        });
       } catch (error) {
         console.error("Error sending tab list:", error);
       }
@@ -150,8 +799,7 @@ export async function handleCastSession(
       if (requestedPageId) {
         for (const page of pages) {
           try {
-            //@ts-expect-error
-            const pageId = page.target()._targetId;
+            const pageId = getTargetId(page);
             if (pageId === requestedPageId) {
               return { page, pageId };
             }
@@ -163,8 +811,7 @@ export async function handleCastSession(
         const index = parseInt(requestedPageIndex, 10);
         if (index >= 0 && index < pages.length) {
           const page = pages[index];
-          //@ts-expect-error
-          const pageId = page.target()._targetId;
+          const pageId = getTargetId(page);
           return { page, pageId };
         }
       }
@@ -179,6 +826,7 @@ export async function handleCastSession(
 
       if (!browser) {
         console.error("Failed to connect to browser");
+        endConnectSpan(new Error("Failed to connect to browser"));
         socket.destroy();
         return;
       }
@@ -187,8 +835,7 @@ export async function handleCastSession(
 
       if (tabDiscoveryMode) {
         for (const page of pages) {
-          //@ts-expect-error
-          const pageId = page.target()._targetId;
+          const pageId = getTargetId(page);
           activePages.set(pageId, page);
         }
 
@@ -200,8 +847,7 @@ export async function handleCastSession(
           if (target.type() === "page") {
             try {
               const page = await target.asPage();
-              //@ts-expect-error
-              const pageId = target._targetId;
+              const pageId = getTargetId(target);
               activePages.set(pageId, page);
               await sendTabList();
             } catch (err) {
@@ -213,18 +859,16 @@ export async function handleCastSession(
         browser.on("targetdestroyed", async (target) => {
           if (target.type() === "page") {
             try {
-              //@ts-expect-error
-              const pageId = target._targetId;
+              const pageId = getTargetId(target);
+              viewerService.clearPointer(pageId);
               if (activePages.has(pageId)) {
                 activePages.delete(pageId);
 
                 if (ws.readyState === WebSocket.OPEN) {
-                  ws.send(
-                    JSON.stringify({
-                      type: "tabClosed",
-                      pageId,
-                    }),
-                  );
+                  sendMessage({
+                    type: "tabClosed",
+                    pageId,
+                  });
 
                   await sendTabList();
                 }
@@ -247,7 +891,7 @@ export async function handleCastSession(
           } else {
             handleSessionCleanup();
           }
-        }, 30000);
+        }, env.LIVE_VIEW_PING_INTERVAL_MS);
 
         ws.on("close", () => {
           handleSessionCleanup();
@@ -258,6 +902,7 @@ export async function handleCastSession(
           handleSessionCleanup();
         });
 
+        endConnectSpan();
         return;
       } else {
         const targetResult = await findTargetPage(pages);
@@ -268,6 +913,7 @@ export async function handleCastSession(
               requestedPageId ? `pageId=${requestedPageId}` : `pageIndex=${requestedPageIndex}`
             }`,
           );
+          endConnectSpan(new Error("Target page not found"));
           socket.destroy();
           return;
         }
@@ -280,62 +926,491 @@ export async function handleCastSession(
         // Setup screencast for the target page
         targetClient = await targetPage.target().createCDPSession();
 
-        ws.on("message", async (message) => {
+        viewerService.register({
+          connectionId,
+          viewerId,
+          pageId: targetPageId,
+          viewOnly,
+          dryRun,
+          send: (payload) => {
+            if (ws.readyState === WebSocket.OPEN) {
+              sendMessage(payload);
+            }
+          },
+          close: (reason) => ws.close(1000, reason),
+        });
+        connectionOpen = true;
+        eventBus.publish("viewer.connected", {
+          connectionId,
+          viewerId,
+          sessionId,
+          pageId: targetPageId,
+          ...(resumed ? { resumedFrom: resumed.connectionId } : {}),
+        });
+        nextResumeToken = viewerService.issueResumeToken({
+          sessionId,
+          viewerId,
+          connectionId,
+          pageId: targetPageId,
+          viewOnly,
+          keyboardLayout,
+          streamQuality: connectionQuality,
+        });
+        const { version, gitSha } = getBuildInfo();
+        sendMessage({
+          type: "viewerInfo",
+          viewerId,
+          connectionId,
+          resumed: !!resumed,
+          resumeToken: nextResumeToken,
+          resumeGraceMs: env.LIVE_VIEW_RESUME_GRACE_MS,
+          mode: viewOnly ? "view" : "control",
+          dryRun,
+          build: { version, gitSha },
+        });
+
+        viewerService.on("streamResumed", handleStreamResumed);
+        viewerService.on("streamQualityChanged", handleStreamQualityChanged);
+        if (viewerService.isBlanked()) {
+          sendMessage({ type: "streamBlanked" });
+        }
+
+        cdpService.on(EmitEvent.RecordingStarted, handleRecordingStarted);
+        if (!sessionService.isRecordingAllowed()) {
+          sendMessage({ type: "recordingConsentRequired", sessionId: session.id });
+        }
+
+        unsubscribePaused = eventBus.subscribe("session.paused", handleSessionPaused);
+        unsubscribeResumed = eventBus.subscribe("session.resumed", handleSessionResumed);
+        unsubscribeResized = eventBus.subscribe("session.resized", handleSessionResized);
+        if (sessionService.isPaused()) {
+          handleSessionPaused();
+        }
+
+        // Viewers joining during maintenance get the notice the others were sent
+        const maintenance = context.fastify.maintenance.status();
+        if (maintenance.active) {
+          sendMessage({ type: "maintenance", ...maintenance });
+        }
+
+        if (session.clipboardSync) {
+          sendMessage({ type: "clipboardSyncEnabled", sessionId });
+          const clipboard = viewerService.getClipboard(sessionId);
+          if (clipboard) {
+            sendMessage({ type: "clipboard", pageId: targetPageId, ...clipboard });
+          }
+        }
+
+        ws.on("message", async (message, isBinary) => {
+          // Viewer input usually causes repaints, so stop throttling capture right away
+          screencast?.wake();
+          viewerService.touch(connectionId);
+          const receivedAt = Date.now();
+
+          // Spans from receiving a message until its input has been dispatched to the browser
+          const span = liveViewTracer.startSpan("liveView.message", {
+            attributes: {
+              "steel.session.id": sessionId,
+              "liveView.viewer.id": viewerId,
+              "liveView.connection.id": connectionId,
+            },
+          });
+
+          let messageType = "unknown";
+          let clientTs: number | undefined;
           try {
-            const data:
-              | MouseEvent
-              | KeyEvent
-              | NavigationEvent
-              | CloseTabEvent
-              | GetSelectedTextEvent = JSON.parse(message.toString());
+            const data = isBinary
+              ? parseBinaryCastMessage(message as Buffer, viewport)
+              : parseCastMessage(message.toString(), viewport, keyboardLayout);
+            if (!data) {
+              console.warn("Dropping malformed cast message");
+              span.setAttribute("liveView.message.dropped", true);
+              if (dryRun) {
+                sendMessage({
+                  type: "inputAck",
+                  dryRun: true,
+                  accepted: false,
+                  error: "Malformed or out-of-range message",
+                });
+              }
+              return;
+            }
             const { type } = data;
+            messageType = type;
+            clientTs = data.ts;
+            span.setAttribute("liveView.message.type", type);
 
             if (!targetClient || !targetPage) {
               console.error("No target page or client available for input handling");
               return;
             }
 
+            // Input from a connection opened for an earlier session must not reach the pages of
+            // the session that replaced it
+            if (INPUT_EVENT_TYPES.has(type) && sessionService.activeSession.id !== sessionId) {
+              context.fastify.log.warn(
+                {
+                  connectionId,
+                  viewerId,
+                  sessionId,
+                  activeSessionId: sessionService.activeSession.id,
+                },
+                "Refusing cast input for a session that is no longer active",
+              );
+              ws.close(1008, "Session is no longer active");
+              return;
+            }
+
+            const messageDecision = await authorizer.checkMessage({
+              sessionId,
+              viewerId,
+              connectionId,
+              type,
+              claims: tokenClaims,
+            });
+            if (!messageDecision.allowed) {
+              sendMessage({
+                type: "error",
+                code: "forbidden",
+                message: messageDecision.reason ?? `Not allowed to send ${type} messages`,
+              });
+              return;
+            }
+
+            // While another viewer holds a control grant, only non-input messages are processed.
+            // Pausing affects every viewer and the recording, so only the grant holder may do it
+            // here, anyone else goes through the admin API. Dry-run connections are told why input
+            // is refused, so they learn what they may actually do.
+            const inputRefusal = !INPUT_EVENT_TYPES.has(type)
+              ? null
+              : viewOnly
+                ? "The connection is view-only"
+                : !viewerService.canControl(viewerId)
+                  ? "Another viewer holds control of the session"
+                  : (type === "pauseSession" || type === "resumeSession") &&
+                      viewerService.getControlGrant()?.viewerId !== viewerId
+                    ? "Only the viewer holding control can pause or resume the session"
+                    : null;
+            if (inputRefusal) {
+              if (dryRun) {
+                sendMessage({
+                  type: "inputAck",
+                  dryRun: true,
+                  accepted: false,
+                  error: inputRefusal,
+                  message: data,
+                });
+              } else if (type === "pauseSession" || type === "resumeSession") {
+                sendMessage({ type: "error", code: "forbidden", message: inputRefusal });
+              }
+              return;
+            }
+
+            // Echo input back the way it would be dispatched, after validation and clamping
+            if (dryRun && INPUT_EVENT_TYPES.has(type)) {
+              context.fastify.log.debug(
+                { connectionId, viewerId, message: data },
+                "Acknowledging dry-run cast input",
+              );
+              sendMessage({ type: "inputAck", dryRun: true, accepted: true, message: data });
+              return;
+            }
+
+            // A paused session drops all input until it is resumed
+            if (
+              INPUT_EVENT_TYPES.has(type) &&
+              type !== "pauseSession" &&
+              type !== "resumeSession" &&
+              sessionService.isPaused()
+            ) {
+              return;
+            }
+
+            const isMouseMove = data.type === "mouseEvent" && data.event.type === "mouseMoved";
+            // Upload chunks are already paced by the server's acknowledgements, and dropping one
+            // would leave the viewer waiting for an acknowledgement that never comes
+            if (
+              INPUT_EVENT_TYPES.has(type) &&
+              !isMouseMove &&
+              type !== "fileUploadChunk" &&
+              inputBucket?.tryConsume(1) === false
+            ) {
+              eventBus.publish("input.dropped", {
+                connectionId,
+                viewerId,
+                type,
+                reason: "rate_limited",
+                receivedAt,
+                clientTs,
+              });
+              return;
+            }
+
+            const inputStartedAt = performance.now();
+            // Only input that passed every gate can cause a copy the viewer is handed. It is
+            // recorded before dispatch, as the copy may be reported before the dispatch returns.
+            if (INPUT_EVENT_TYPES.has(type)) {
+              lastInputAt = receivedAt;
+            }
+
             switch (type) {
               case "mouseEvent": {
                 const { event } = data as MouseEvent;
-                await targetClient.send("Input.dispatchMouseEvent", {
-                  type: event.type,
-                  x: event.x,
-                  y: event.y,
-                  button: event.button,
-                  buttons: event.button === "none" ? 0 : 1,
-                  clickCount: event.clickCount || 1,
-                  modifiers: event.modifiers || 0,
-                  deltaX: event.deltaX,
-                  deltaY: event.deltaY,
-                });
+                if (event.type === "mouseMoved") {
+                  mouseMoves.push({ event, receivedAt, clientTs });
+                  break;
+                }
+                // Moves still waiting go first, so the click lands where the pointer was
+                await mouseMoves.flush();
+                await dispatchMouseEvent(event);
+                break;
+              }
+              case "touch": {
+                const { event } = data as TouchEvent;
+                const client = targetClient;
+                await inputQueue.run(() =>
+                  client.send("Input.dispatchTouchEvent", toCdpTouchEvent(event)),
+                );
+                const [firstTouch] = event.touchPoints;
+                if (targetPageId && firstTouch) {
+                  viewerService.setPointer(targetPageId, firstTouch.x, firstTouch.y);
+                }
+                break;
+              }
+              case "gesture": {
+                const { event } = data as GestureEvent;
+                const client = targetClient;
+                const steps = gestureToWheelSteps(event);
+                for (const [index, step] of steps.entries()) {
+                  if (index > 0) {
+                    await new Promise((resolve) => setTimeout(resolve, GESTURE_STEP_INTERVAL_MS));
+                  }
+                  await inputQueue.run(() =>
+                    client.send("Input.dispatchMouseEvent", {
+                      type: "mouseWheel",
+                      button: "none",
+                      ...step,
+                    }),
+                  );
+                }
+                if (targetPageId) {
+                  viewerService.setPointer(targetPageId, event.x, event.y);
+                }
                 break;
               }
               case "keyEvent": {
                 const { event } = data as KeyEvent;
-                await targetClient.send("Input.dispatchKeyEvent", {
-                  type: event.type,
-                  text: event.text,
-                  unmodifiedText: event.text ? event.text.toLowerCase() : undefined,
-                  code: event.code,
-                  key: event.key,
-                  windowsVirtualKeyCode: event.keyCode,
-                  nativeVirtualKeyCode: event.keyCode,
-                  modifiers: event.modifiers || 0,
-                  autoRepeat: false,
-                  isKeypad: false,
-                  isSystemKey: false,
-                });
+                // Keystrokes are silently dropped when another tab or dialog holds focus
+                if (env.LIVE_VIEW_ENSURE_FOCUS && event.type === "keyDown") {
+                  await ensurePageFocus(targetPage);
+                }
+                const client = targetClient;
+                await inputQueue.run(() =>
+                  client.send("Input.dispatchKeyEvent", {
+                    type: event.type,
+                    text: event.text,
+                    unmodifiedText: event.text ? event.text.toLowerCase() : undefined,
+                    code: event.code,
+                    key: event.key,
+                    windowsVirtualKeyCode: event.keyCode,
+                    nativeVirtualKeyCode: event.keyCode,
+                    modifiers: event.modifiers || 0,
+                    autoRepeat: false,
+                    isKeypad: false,
+                    isSystemKey: false,
+                  }),
+                );
+                break;
+              }
+              case "keyboardLayout": {
+                keyboardLayout = (data as KeyboardLayoutEvent).layout;
+                if (nextResumeToken) {
+                  viewerService.updateResumeState(nextResumeToken, { keyboardLayout });
+                }
+                break;
+              }
+              case "keyCombo": {
+                const { combo } = data as KeyComboEvent;
+                if (env.LIVE_VIEW_ENSURE_FOCUS) {
+                  await ensurePageFocus(targetPage);
+                }
+                // Validated when the message was parsed
+                const keys = parseKeyCombo(combo)!;
+                const client = targetClient;
+                await inputQueue.run(() => pressKeyCombo(client, keys));
+                break;
+              }
+              case "textInput": {
+                const { text } = data as TextInputEvent;
+                if (env.LIVE_VIEW_ENSURE_FOCUS) {
+                  await ensurePageFocus(targetPage);
+                }
+                // Inserted as a whole, like an IME commit, since most of Unicode has no key
+                const client = targetClient;
+                await inputQueue.run(() => client.send("Input.insertText", { text }));
+                break;
+              }
+              case "pasteSecret": {
+                const { pageId, name, mode } = data as PasteSecretEvent;
+                const secret = sessionService.secrets.get(name);
+                if (!secret) {
+                  sendMessage({
+                    type: "pasteSecretResponse",
+                    pageId,
+                    name,
+                    success: false,
+                    code: "unknown_secret",
+                    error: `No secret named ${name}`,
+                  });
+                  break;
+                }
+
+                try {
+                  const page = targetPage;
+                  // Queued and bounded like other input, a hung page must not stall the socket
+                  const result = await inputQueue.run(async () => {
+                    if (env.LIVE_VIEW_ENSURE_FOCUS) {
+                      await ensurePageFocus(page);
+                    }
+                    return mode === "paste" ? pasteIntoPage(page, { text: secret }) : null;
+                  });
+                  if (result === "notEditable") {
+                    throw new ClipboardWriteError(
+                      "not_editable",
+                      "No editable element is focused",
+                    );
+                  }
+                  // Password fields often refuse pastes, typing always works. It is cancelled
+                  // once its budget runs out, so it never outlives its slot in the queue.
+                  if (result !== "pasted") {
+                    await inputQueue.run(
+                      (signal) => typeIntoPage(page, secret, { delayMs: 10, signal }),
+                      { timeoutMs: getTypingTimeoutMs(secret, 10, env.LIVE_VIEW_INPUT_TIMEOUT_MS) },
+                    );
+                  }
+                  sendMessage({ type: "pasteSecretResponse", pageId, name, success: true });
+                } catch (error) {
+                  // Only known errors are passed on, others could contain the value
+                  context.fastify.log.warn({ connectionId, name }, "Failed to inject a secret");
+                  sendMessage({
+                    type: "pasteSecretResponse",
+                    pageId,
+                    name,
+                    success: false,
+                    code: error instanceof ClipboardWriteError ? error.code : undefined,
+                    error:
+                      error instanceof ClipboardWriteError
+                        ? error.message
+                        : "Failed to inject the secret",
+                  });
+                }
+                break;
+              }
+              case "fileUploadStart": {
+                const { pageId, uploadId, name, size, mimeType, x, y } =
+                  data as FileUploadStartEvent;
+                try {
+                  await uploads.start({ uploadId, name, size, mimeType });
+                  if (x !== undefined && y !== undefined) {
+                    uploadDrops.set(uploadId, { x, y });
+                  }
+                  sendMessage({ type: "fileUploadProgress", pageId, uploadId, received: 0 });
+                } catch (error) {
+                  sendUploadFailure(pageId, uploadId, error);
+                }
+                break;
+              }
+              case "fileUploadChunk": {
+                const { uploadId, data: chunk } = data as FileUploadChunkEvent;
+                try {
+                  const received = await uploads.write(uploadId, chunk);
+                  // Viewers wait for the acknowledgement before sending more, which keeps large
+                  // files from flooding the connection
+                  sendMessage({
+                    type: "fileUploadProgress",
+                    pageId: targetPageId,
+                    uploadId,
+                    received,
+                  });
+                } catch (error) {
+                  uploadDrops.delete(uploadId);
+                  sendUploadFailure(targetPageId, uploadId, error);
+                }
+                break;
+              }
+              case "fileUploadCancel": {
+                const { uploadId } = data as FileUploadEndEvent;
+                uploadDrops.delete(uploadId);
+                await uploads.cancel(uploadId);
+                break;
+              }
+              case "fileUploadEnd": {
+                const { pageId, uploadId } = data as FileUploadEndEvent;
+                const client = targetClient;
+                const drop = uploadDrops.get(uploadId);
+                uploadDrops.delete(uploadId);
+                let file: ReceivedFile | null = null;
+                try {
+                  file = await uploads.finish(uploadId);
+                  const decision = await dlp.checkFile(
+                    {
+                      action: "upload",
+                      sessionId,
+                      viewerId,
+                      fileName: file.name,
+                      mimeType: file.mimeType,
+                    },
+                    fs.createReadStream(file.tempPath),
+                  );
+                  if (!decision.allowed) {
+                    throw new FileUploadError("dlp_denied", decision.reason ?? DLP_DENIED_MESSAGE);
+                  }
+
+                  const saved = await FileService.getInstance().saveFile({
+                    filePath: path.posix.join("uploads", file.name),
+                    stream: fs.createReadStream(file.tempPath),
+                  });
+                  if (drop) {
+                    await withTimeout(
+                      dropFilesIntoPage(client, { ...drop, files: [saved.path] }),
+                      env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                      "Dropping the file",
+                    );
+                  }
+                  sendMessage({
+                    type: "fileUploadResponse",
+                    pageId,
+                    uploadId,
+                    success: true,
+                    path: saved.path,
+                    size: saved.size,
+                    dropped: !!drop,
+                  });
+                } catch (error) {
+                  sendUploadFailure(pageId, uploadId, error);
+                } finally {
+                  if (file) {
+                    await fs.promises.rm(file.tempPath, { force: true });
+                  }
+                }
                 break;
               }
               case "navigation": {
                 const { event } = data as NavigationEvent;
-                await navigatePage(event, targetPage);
+                await withTimeout(
+                  navigatePage(event, targetPage),
+                  env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                  "Navigation",
+                );
                 break;
               }
               case "closeTab": {
                 const { pageId } = data as CloseTabEvent;
-                await targetPage?.close();
+                await withTimeout(
+                  targetPage.close(),
+                  env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                  "Closing the tab",
+                );
                 if (activePages.has(pageId)) {
                   activePages.delete(pageId);
                 }
@@ -343,29 +1418,259 @@ export async function handleCastSession(
               }
               case "getSelectedText": {
                 try {
-                  const selectedText = await targetPage.evaluate(() => {
-                    const selection = window.getSelection();
-                    return selection ? selection.toString() : "";
-                  });
+                  const { pageId, formats } = data as GetSelectedTextEvent;
+                  const selection = await withTimeout(
+                    getPageSelection(targetPage, formats),
+                    env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                    "Reading the selection",
+                  );
 
-                  // Send the selected text back to the client
-                  ws.send(
-                    JSON.stringify({
-                      type: "selectedTextResponse",
-                      pageId: (data as GetSelectedTextEvent).pageId,
-                      text: selectedText,
-                    }),
+                  const decision = await dlp.checkClipboard(
+                    { action: "copy", sessionId, viewerId },
+                    selection,
                   );
-                } catch (error) {
-                  console.error("Failed to get selected text:", error);
-                  ws.send(
-                    JSON.stringify({
+                  if (!decision.allowed) {
+                    sendMessage({
                       type: "selectedTextResponse",
-                      pageId: (data as GetSelectedTextEvent).pageId,
+                      pageId,
                       text: "",
-                      error: error instanceof Error ? error.message : "Unknown error",
-                    }),
+                      code: "dlp_denied",
+                      error: decision.reason ?? DLP_DENIED_MESSAGE,
+                    });
+                    break;
+                  }
+
+                  // Send the selected text back to the client
+                  sendMessage({
+                    type: "selectedTextResponse",
+                    pageId,
+                    ...selection,
+                  });
+                } catch (error) {
+                  console.error("Failed to get selected text:", error);
+                  sendMessage({
+                    type: "selectedTextResponse",
+                    pageId: (data as GetSelectedTextEvent).pageId,
+                    text: "",
+                    error: error instanceof Error ? error.message : "Unknown error",
+                  });
+                }
+                break;
+              }
+              case "clipboardWrite": {
+                const { pageId, event } = data as ClipboardWriteEvent;
+                try {
+                  const decision = await dlp.checkClipboard(
+                    { action: "paste", sessionId, viewerId },
+                    { text: event.text, html: event.html },
+                  );
+                  if (!decision.allowed) {
+                    throw new ClipboardWriteError(
+                      "dlp_denied",
+                      decision.reason ?? DLP_DENIED_MESSAGE,
+                    );
+                  }
+                  if (env.LIVE_VIEW_ENSURE_FOCUS) {
+                    await ensurePageFocus(targetPage);
+                  }
+                  const result =
+                    event.mode === "type"
+                      ? null
+                      : await withTimeout(
+                          pasteIntoPage(targetPage, { text: event.text, html: event.html }),
+                          env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                          "Paste",
+                        );
+
+                  if (result === "notEditable") {
+                    throw new ClipboardWriteError("not_editable", "No editable element is focused");
+                  }
+
+                  // Paste-hostile fields still accept the content as simulated typing
+                  if (
+                    (result === "blocked" || result === "notApplied") &&
+                    !featureFlags.isEnabled("liveViewTypingFallback")
+                  ) {
+                    throw result === "blocked"
+                      ? new ClipboardWriteError("paste_blocked", "The page blocked the paste")
+                      : new ClipboardWriteError(
+                          "paste_not_applied",
+                          "The pasted content did not reach the focused element",
+                        );
+                  }
+                  if (result !== "pasted") {
+                    const page = targetPage;
+                    const delayMs = Math.min(Math.max(event.delayMs ?? 10, 0), 1000);
+                    // The budget grows with the text, and running out of it cancels the typing
+                    // rather than leaving it running after its slot in the queue was released
+                    await inputQueue.run(
+                      (signal) =>
+                        typeIntoPage(page, event.text, {
+                          delayMs,
+                          signal,
+                          onProgress: (typed, total) => {
+                            if (ws.readyState !== WebSocket.OPEN) {
+                              return false;
+                            }
+                            sendMessage({ type: "clipboardTypeProgress", pageId, typed, total });
+                          },
+                        }),
+                      {
+                        timeoutMs: getTypingTimeoutMs(
+                          event.text,
+                          delayMs,
+                          env.LIVE_VIEW_INPUT_TIMEOUT_MS,
+                        ),
+                      },
+                    );
+                  }
+
+                  sendMessage({ type: "clipboardWriteResponse", pageId, success: true });
+                } catch (error) {
+                  console.error("Failed to paste clipboard content:", error);
+                  sendMessage({
+                    type: "clipboardWriteResponse",
+                    pageId,
+                    success: false,
+                    code: error instanceof ClipboardWriteError ? error.code : undefined,
+                    error: error instanceof Error ? error.message : "Unknown error",
+                  });
+                }
+                break;
+              }
+              case "grantControl": {
+                const { viewerId: granteeId, durationMs } = data as GrantControlEvent;
+                try {
+                  viewerService.handOffControl(viewerId, granteeId, durationMs);
+                } catch (error) {
+                  sendMessage({
+                    type: "controlGrantError",
+                    viewerId: granteeId,
+                    error: error instanceof Error ? error.message : "Unknown error",
+                  });
+                }
+                break;
+              }
+              case "clipboardSync": {
+                const { pageId, text, html } = data as ClipboardSyncEvent;
+                if (!session.clipboardSync) {
+                  console.warn("Ignoring clipboard sync for a session without clipboard sync");
+                  break;
+                }
+                const decision = await dlp.checkClipboard(
+                  { action: "paste", sessionId, viewerId },
+                  { text, html },
+                );
+                if (!decision.allowed) {
+                  sendMessage({
+                    type: "error",
+                    code: "dlp_denied",
+                    message: decision.reason ?? DLP_DENIED_MESSAGE,
+                  });
+                  break;
+                }
+                if (!viewerService.updateClipboard(sessionId, { text, html })) {
+                  break;
+                }
+
+                const written = await withTimeout(
+                  writePageClipboard(targetClient, { text, html }),
+                  env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                  "Clipboard sync",
+                );
+                if (!written) {
+                  console.warn("The page refused the synced clipboard content");
+                }
+                viewerService.broadcast({ type: "clipboard", pageId, text, html }, connectionId);
+                break;
+              }
+              case "recordingConsent": {
+                sessionService.acknowledgeRecording(viewerId);
+                break;
+              }
+              case "pauseSession": {
+                sessionService.pause();
+                break;
+              }
+              case "networkChanged": {
+                // The new link's capacity is unknown, so start low and let adaptive quality
+                // raise it again. The ack lets the viewer tell a live socket from a dead one
+                // without waiting for the heartbeat.
+                const { pageId, connectionType } = data as NetworkChangedEvent;
+                if (
+                  screencastSettings.format === "jpeg" &&
+                  featureFlags.isEnabled("liveViewAdaptiveQuality")
+                ) {
+                  const quality = adaptiveQuality.degrade();
+                  if (quality !== null) {
+                    await withTimeout(
+                      setScreencastQuality(quality),
+                      env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                      "Restarting the screencast",
+                    );
+                  }
+                }
+                context.fastify.log.info(
+                  { connectionId, viewerId, connectionType },
+                  "Cast viewer network changed",
+                );
+                sendMessage({ type: "networkChangedAck", pageId });
+                break;
+              }
+              case "resumeSession": {
+                sessionService.resume();
+                break;
+              }
+              case "quality": {
+                const { preset, quality, maxFps, maxBitrateKbps } = data as StreamQualityEvent;
+                connectionQuality = resolveStreamQuality({
+                  preset,
+                  quality,
+                  maxFps,
+                  maxBitrateKbps,
+                });
+                context.fastify.log.info(
+                  { connectionId, viewerId, quality: connectionQuality },
+                  "Cast viewer changed the stream quality",
+                );
+                if (nextResumeToken) {
+                  viewerService.updateResumeState(nextResumeToken, {
+                    streamQuality: connectionQuality,
+                  });
+                }
+                sendStreamQuality();
+                await applyStreamQuality();
+                break;
+              }
+              case "window": {
+                const { pageId, event } = data as WindowEvent;
+                try {
+                  if (!featureFlags.isEnabled("liveViewWindowActions")) {
+                    throw new Error("Window actions are disabled");
+                  }
+                  if (!browser) {
+                    throw new Error("Browser is not connected");
+                  }
+                  const activePageId = await withTimeout(
+                    performWindowAction(event.action, browser, targetPage, targetClient),
+                    env.LIVE_VIEW_COMMAND_TIMEOUT_MS,
+                    "Window action",
                   );
+                  sendMessage({
+                    type: "windowResponse",
+                    pageId,
+                    action: event.action,
+                    activePageId,
+                    success: true,
+                  });
+                } catch (error) {
+                  sendMessage({
+                    type: "windowResponse",
+                    pageId,
+                    action: event.action,
+                    success: false,
+                    error: error instanceof Error ? error.message : "Unknown error",
+                  });
                 }
                 break;
               }
@@ -373,73 +1678,165 @@ export async function handleCastSession(
               default:
                 console.warn("Unknown event type:", type);
             }
+
+            // Coalesced moves report their dispatch once it happens
+            if (INPUT_EVENT_TYPES.has(type) && !isMouseMove) {
+              eventBus.publish("input.dispatched", {
+                connectionId,
+                viewerId,
+                type,
+                durationSeconds: (performance.now() - inputStartedAt) / 1000,
+                receivedAt,
+                clientTs,
+              });
+              context.fastify.log.debug(
+                { audit: "viewer_input", connectionId, viewerId, type, receivedAt, clientTs },
+                "Dispatched viewer input",
+              );
+            }
           } catch (err) {
+            // Input shed by the dispatch queue under load is expected, not an error
+            if (err instanceof WorkQueueFullError || err instanceof WorkQueueTimeoutError) {
+              eventBus.publish("input.dropped", {
+                connectionId,
+                viewerId,
+                type: messageType,
+                reason: err instanceof WorkQueueFullError ? "queue_full" : "timeout",
+                receivedAt,
+                clientTs,
+              });
+              return;
+            }
             console.error("Error handling WebSocket message:", err);
+            span.recordException(err as Error);
+          } finally {
+            span.end();
           }
         });
 
-        // Setup device metrics and start screencast
-        await targetClient.send("Page.setDeviceMetricsOverride", {
-          screenHeight: height,
-          screenWidth: width,
-          width,
-          height,
-          mobile: isMobile,
-          screenOrientation: isMobile
-            ? { angle: 0, type: "portraitPrimary" }
-            : { angle: 90, type: "landscapePrimary" },
-          deviceScaleFactor: isMobile ? 3 : 1,
-        });
-
-        await targetClient.send("Page.startScreencast", {
-          format: "jpeg",
-          quality: 75,
-          maxWidth: width,
-          maxHeight: height,
-        });
+        // Setup device metrics and join the page's screencast
+        await setDeviceMetrics(targetClient, { width, height });
 
-        // Handle screencast frames
-        targetClient.on("Page.screencastFrame", async ({ data, sessionId }) => {
-          try {
-            // Acknowledge the frame right away to free up memory
-            await targetClient?.send("Page.screencastFrameAck", { sessionId });
+        const subscription = await screencasts.subscribe(
+          targetPageId,
+          screencastSettings,
+          { width, height },
+          {
+            onFrame: (data, changed) => {
+              handleFrame(data, changed).catch((err) => {
+                console.error("Error in Page.screencastFrame handler:", err);
+              });
+            },
+            onResize: handleStreamResized,
+          },
+          wantedQuality(),
+        );
+        screencast = subscription;
+        endConnectSpan();
+        // The socket may have closed while the screencast was starting, before its close handler
+        // is set up, and the screencast must not be kept running for it
+        if (ws.readyState !== WebSocket.OPEN) {
+          handleSessionCleanup();
+          return;
+        }
 
+        // Dialogs outside the page are not part of the screencast and leave it looking frozen,
+        // so tell viewers what the page is waiting for
+        await watchNativeDialogs(targetClient, {
+          onOpened: (dialog) => {
+            screencast?.wake();
             if (ws.readyState === WebSocket.OPEN) {
-              // Get page metadata
-              const title = await getPageTitle(targetPage!);
-              const favicon = await getPageFavicon(targetPage!);
-
-              // Send frame data
-              ws.send(
-                JSON.stringify({
-                  pageId: targetPageId,
-                  url: targetPage?.url(),
-                  title,
-                  favicon,
-                  data,
-                }),
-              );
+              sendMessage({ type: "nativeDialog", pageId: targetPageId, ...dialog });
             }
-          } catch (err) {
-            console.error("Error in Page.screencastFrame handler:", err);
+          },
+          onClosed: () => {
+            if (ws.readyState === WebSocket.OPEN) {
+              sendMessage({ type: "nativeDialogClosed", pageId: targetPageId });
+            }
+          },
+        });
+
+        // Send what the page copies, e.g. on Ctrl+C or a copy button, back to the viewer so it can
+        // land in their local clipboard. With clipboard sync every copy goes to all viewers.
+        const clipboardBinding = `__steelClipboard${connectionId.replace(/-/g, "")}`;
+        targetClient.on("Runtime.bindingCalled", ({ name, payload }) => {
+          const content = name === clipboardBinding ? parseClipboardCapture(payload) : null;
+          const causedByViewer = isCopyCausedBy(
+            { viewOnly, lastInputAt },
+            CLIPBOARD_INPUT_WINDOW_MS,
+          );
+          if (!content || (!session.clipboardSync && !causedByViewer)) {
+            return;
+          }
+
+          // With clipboard sync the copy goes to every viewer, not only this one
+          dlp
+            .checkClipboard(
+              { action: "copy", sessionId, viewerId: session.clipboardSync ? undefined : viewerId },
+              content,
+            )
+            .then((decision) => {
+              if (!decision.allowed) {
+                if (causedByViewer && ws.readyState === WebSocket.OPEN) {
+                  sendMessage({
+                    type: "error",
+                    code: "dlp_denied",
+                    message: decision.reason ?? DLP_DENIED_MESSAGE,
+                  });
+                }
+                return;
+              }
+
+              if (session.clipboardSync) {
+                // Every connection on the page captures the same copy, only the first one sends it
+                if (viewerService.updateClipboard(sessionId, content)) {
+                  viewerService.broadcast({ type: "clipboard", pageId: targetPageId, ...content });
+                }
+              } else if (ws.readyState === WebSocket.OPEN) {
+                sendMessage({ type: "clipboard", pageId: targetPageId, ...content });
+              }
+            })
+            .catch((err) => {
+              console.error("Error checking the page clipboard:", err);
+            });
+        });
+        await captureClipboard(targetClient, clipboardBinding).catch((err) => {
+          console.error("Error capturing the page clipboard:", err);
+        });
+
+        // Frames never contain the mouse cursor, so the page reports where it is and which cursor
+        // it shows there, for viewers to draw it themselves
+        const cursorBinding = `__steelCursor${connectionId.replace(/-/g, "")}`;
+        targetClient.on("Runtime.bindingCalled", ({ name, payload }) => {
+          const state = name === cursorBinding ? parseCursorCapture(payload) : null;
+          if (state && targetPageId) {
+            viewerService.setPointer(targetPageId, state.x, state.y, state.cursor);
           }
         });
+        await captureCursor(targetClient, cursorBinding).catch((err) => {
+          console.error("Error capturing the page cursor:", err);
+        });
+
+        await refreshViewport();
+        targetClient.on("Page.frameResized", () => {
+          refreshViewport().catch((err) => {
+            console.error("Error refreshing viewport size:", err);
+          });
+        });
 
         // Cleanup when target is destroyed
         browser.on("targetdestroyed", async (target) => {
           if (target.type() === "page") {
             try {
-              //@ts-expect-error
-              const pageId = target._targetId;
+              const pageId = getTargetId(target);
+              viewerService.clearPointer(pageId);
 
               if (pageId === targetPageId) {
                 if (ws.readyState === WebSocket.OPEN) {
-                  ws.send(
-                    JSON.stringify({
-                      type: "targetClosed",
-                      pageId: targetPageId,
-                    }),
-                  );
+                  sendMessage({
+                    type: "targetClosed",
+                    pageId: targetPageId,
+                  });
                 }
 
                 // Cleanup and close connection
@@ -452,23 +1849,58 @@ export async function handleCastSession(
           }
         });
 
-        // Setup heartbeat to detect dead connections
+        // Setup heartbeat to detect dead connections, tracking round trips and missed pongs
+        let pingSentAt: number | null = null;
+        ws.on("pong", () => {
+          if (pingSentAt !== null) {
+            viewerService.recordPong(viewerId, connectionId, Date.now() - pingSentAt);
+            pingSentAt = null;
+          }
+        });
         heartbeatInterval = setInterval(() => {
-          if (ws.readyState === WebSocket.OPEN) {
-            try {
-              ws.ping();
-            } catch (err) {
-              console.error("Error sending ping:", err);
-              handleSessionCleanup();
-            }
-          } else {
+          if (ws.readyState !== WebSocket.OPEN) {
             handleSessionCleanup();
+            return;
           }
-        }, 30000);
+
+          // The previous ping is still unanswered
+          if (
+            pingSentAt !== null &&
+            viewerService.recordMissedPong(viewerId, connectionId) >= env.LIVE_VIEW_MAX_MISSED_PONGS
+          ) {
+            console.warn(`Closing cast connection ${connectionId} after missed pongs`);
+            viewerService.recordDeadlineExpired(viewerId, connectionId);
+            eventBus.publish("viewer.heartbeatTimeout", { connectionId, viewerId });
+            ws.terminate();
+            handleSessionCleanup();
+            return;
+          }
+
+          try {
+            pingSentAt = Date.now();
+            viewerService.recordPing(viewerId);
+            ws.ping();
+          } catch (err) {
+            console.error("Error sending ping:", err);
+            handleSessionCleanup();
+          }
+        }, env.LIVE_VIEW_PING_INTERVAL_MS);
+
+        // Report where the page's mouse actually is and its cursor, so clients drawing a predicted
+        // cursor can correct drift and see moves made by other viewers or automation
+        let reportedPointer: { x: number; y: number; cursor?: string } | null = null;
+        cursorInterval = setInterval(() => {
+          const pointer = targetPageId ? viewerService.getPointer(targetPageId) : null;
+          if (!pointer || pointer === reportedPointer || ws.readyState !== WebSocket.OPEN) {
+            return;
+          }
+          reportedPointer = pointer;
+          sendMessage({ type: "cursorPosition", pageId: targetPageId, ...pointer });
+        }, 200);
 
         // Cleanup on WebSocket closure
-        ws.on("close", () => {
-          handleSessionCleanup();
+        ws.on("close", (code, reason) => {
+          handleSessionCleanup(code, reason.toString());
         });
 
         // Handle errors
@@ -479,6 +1911,7 @@ export async function handleCastSession(
       }
     } catch (err) {
       console.error("Error in cast session:", err);
+      endConnectSpan(err);
       handleSessionCleanup();
       socket.destroy();
     }
@@ -5,6 +5,7 @@ import { handleCastSession } from "../casting.handler.js";
 
 export const castHandler: WebSocketHandler = {
   path: "/v1/sessions/cast",
+  authorizesUpgrade: true,
   handler: async (
     request: IncomingMessage,
     socket: Duplex,
@@ -12,13 +13,15 @@ export const castHandler: WebSocketHandler = {
     context: WebSocketHandlerContext,
   ) => {
     context.fastify.log.info("Connecting to cast...");
-    await handleCastSession(
-      request,
-      socket,
-      head,
-      context.wss,
-      context.fastify.sessionService,
-      context.params,
-    );
+    await handleCastSession(request, socket, head, context);
   },
 };
+
+/**
+ * Same as castHandler, but bound to a session: the connection is refused unless the session
+ * in the path is the active one.
+ */
+export const sessionCastHandler: WebSocketHandler = {
+  ...castHandler,
+  path: "/v1/sessions/:sessionId/cast",
+};
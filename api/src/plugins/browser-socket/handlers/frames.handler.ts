@@ -0,0 +1,139 @@
+import { IncomingMessage } from "http";
+import { CDPSession, Page } from "puppeteer-core";
+import { Duplex } from "stream";
+import { WebSocket } from "ws";
+import { WebSocketHandler, WebSocketHandlerContext } from "../../../types/websocket.js";
+import { getTargetId } from "../../../utils/browser.js";
+import { parseFrameSamplingOptions } from "../../../utils/frame-sampling.js";
+
+/**
+ * Sends frames of a page at a fixed sample rate to programmatic consumers, e.g. agents verifying
+ * what a page shows. Unlike the live view, frames are captured on demand rather than streamed, so
+ * a consumer only pays for the frames it asked for. A sample is skipped while the previous frame
+ * is still being sent, so a slow consumer gets fewer frames instead of stale ones. While the
+ * stream is blanked or the session paused, nothing is captured and the consumer is told why.
+ */
+async function handleFramesWebSocket(context: WebSocketHandlerContext, ws: WebSocket) {
+  const { fastify, params } = context;
+  const { rate, format, quality } = parseFrameSamplingOptions(params);
+  const intervalMs = 1000 / rate;
+
+  let timer: NodeJS.Timeout | null = null;
+  let client: CDPSession | null = null;
+  let page: Page | null = null;
+  let sentFrames = 0;
+  let closed = false;
+
+  ws.on("error", (err) => {
+    fastify.log.error({ err }, "Frames WebSocket error");
+  });
+
+  ws.on("close", () => {
+    fastify.log.info("Frames WebSocket connection closed");
+    closed = true;
+    if (timer) {
+      clearTimeout(timer);
+      timer = null;
+    }
+    client?.detach().catch(() => {});
+  });
+
+  try {
+    const pages = await fastify.cdpService.getAllPages();
+    page = params.pageId
+      ? (pages.find((candidate) => getTargetId(candidate) === params.pageId) ?? null)
+      : await fastify.cdpService.getPrimaryPage();
+    if (!page) {
+      ws.close(1008, "Page not found");
+      return;
+    }
+    client = await page.target().createCDPSession();
+  } catch (err) {
+    fastify.log.error({ err }, "Failed to attach to the page for frame sampling");
+    ws.close(1011, "Failed to attach to the page");
+    return;
+  }
+  if (closed) {
+    client.detach().catch(() => {});
+    return;
+  }
+
+  const pageId = getTargetId(page);
+  const sample = async () => {
+    timer = null;
+    const startedAt = Date.now();
+    // Blanking and pausing hide the page from live viewers, programmatic consumers included
+    const dropReason = fastify.viewerService.isBlanked()
+      ? "blanked"
+      : fastify.sessionService.isPaused()
+        ? "paused"
+        : null;
+    try {
+      if (dropReason) {
+        if (ws.readyState === WebSocket.OPEN) {
+          ws.send(
+            JSON.stringify({ type: "frameDropped", pageId, reason: dropReason, ts: startedAt }),
+          );
+        }
+      } else if (ws.bufferedAmount === 0) {
+        const { data } = await client!.send("Page.captureScreenshot", {
+          format,
+          ...(format === "jpeg" ? { quality } : {}),
+        });
+        if (ws.readyState === WebSocket.OPEN) {
+          sentFrames += 1;
+          ws.send(
+            JSON.stringify({
+              type: "frame",
+              pageId,
+              url: page!.url(),
+              format,
+              data,
+              seq: sentFrames,
+              ts: startedAt,
+            }),
+          );
+        }
+      }
+    } catch (err) {
+      fastify.log.warn({ err, pageId }, "Failed to capture a sampled frame");
+      if (page!.isClosed()) {
+        ws.close(1001, "Page closed");
+        return;
+      }
+    }
+    if (!closed) {
+      timer = setTimeout(sample, Math.max(0, intervalMs - (Date.now() - startedAt)));
+    }
+  };
+  await sample();
+}
+
+export const framesHandler: WebSocketHandler = {
+  path: "/v1/sessions/:sessionId/frames",
+  handler: (
+    request: IncomingMessage,
+    socket: Duplex,
+    head: Buffer,
+    context: WebSocketHandlerContext,
+  ) => {
+    // Frames of a session that has since been replaced must not reach its consumers
+    if (context.params.sessionId !== context.fastify.sessionService.activeSession?.id) {
+      context.fastify.log.warn(
+        { sessionId: context.params.sessionId },
+        "Refusing frames connection for a session that is not active",
+      );
+      socket.write("HTTP/1.1 404 Not Found\r\nConnection: close\r\n\r\n");
+      socket.destroy();
+      return;
+    }
+
+    context.fastify.log.info("Connecting to frames...");
+    context.wss.handleUpgrade(request, socket, head, (ws) => {
+      handleFramesWebSocket(context, ws).catch((err) => {
+        context.fastify.log.error({ err }, "Frames WebSocket handler error");
+        ws.close(1011, "Internal error");
+      });
+    });
+  },
+};
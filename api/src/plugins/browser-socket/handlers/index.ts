@@ -1,17 +1,21 @@
 export { logsHandler } from "./logs.handler.js";
-export { castHandler } from "./cast.handler.js";
+export { castHandler, sessionCastHandler } from "./cast.handler.js";
+export { framesHandler } from "./frames.handler.js";
 export { pageIdHandler } from "./pageId.handler.js";
 export { recordingHandler } from "./recording.handler.js";
 
 import { WebSocketHandler } from "../../../types/websocket.js";
 import { logsHandler } from "./logs.handler.js";
-import { castHandler } from "./cast.handler.js";
+import { castHandler, sessionCastHandler } from "./cast.handler.js";
+import { framesHandler } from "./frames.handler.js";
 import { pageIdHandler } from "./pageId.handler.js";
 import { recordingHandler } from "./recording.handler.js";
 
 export const defaultHandlers: WebSocketHandler[] = [
   logsHandler,
   castHandler,
+  sessionCastHandler,
+  framesHandler,
   pageIdHandler,
   recordingHandler,
 ];
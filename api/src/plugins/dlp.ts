@@ -0,0 +1,20 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { env } from "../env.js";
+import { DlpService } from "../services/dlp.service.js";
+
+const dlpPlugin: FastifyPluginAsync = async (fastify, _options) => {
+  const dlp = new DlpService(fastify.log, fastify.eventBus, {
+    url: env.DLP_URL,
+    payload: env.DLP_PAYLOAD,
+    maxContentBytes: env.DLP_MAX_CONTENT_BYTES,
+    timeoutMs: env.DLP_TIMEOUT_MS,
+    failOpen: env.DLP_FAIL_OPEN,
+  });
+  if (dlp.isEnabled()) {
+    fastify.log.info({ payload: env.DLP_PAYLOAD }, "Data loss prevention checks enabled");
+  }
+  fastify.decorate("dlp", dlp);
+};
+
+export default fp(dlpPlugin, "5.x");
@@ -0,0 +1,19 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { EventBus } from "../services/event-bus.service.js";
+
+const eventBusPlugin: FastifyPluginAsync = async (fastify, _options) => {
+  const eventBus = new EventBus(fastify.log);
+
+  // Audit log of which live viewer connections were attached to which session
+  eventBus.subscribe("viewer.connected", (event) => {
+    fastify.log.info(event, "Cast connection attached to session page");
+  });
+  eventBus.subscribe("viewer.rejected", (event) => {
+    fastify.log.warn(event, "Rejecting cast viewer");
+  });
+
+  fastify.decorate("eventBus", eventBus);
+};
+
+export default fp(eventBusPlugin, "5.x");
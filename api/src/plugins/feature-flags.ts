@@ -0,0 +1,16 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { env } from "../env.js";
+import { FeatureFlagService } from "../services/feature-flag.service.js";
+
+const featureFlagsPlugin: FastifyPluginAsync = async (fastify, _options) => {
+  fastify.decorate(
+    "featureFlags",
+    new FeatureFlagService(fastify.log, {
+      file: env.FEATURE_FLAGS_FILE,
+      env: env.FEATURE_FLAGS,
+    }),
+  );
+};
+
+export default fp(featureFlagsPlugin, "5.x");
@@ -0,0 +1,9 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { MaintenanceService } from "../services/maintenance.service.js";
+
+const maintenancePlugin: FastifyPluginAsync = async (fastify, _options) => {
+  fastify.decorate("maintenance", new MaintenanceService(fastify.log, fastify.eventBus));
+};
+
+export default fp(maintenancePlugin, "5.x");
@@ -0,0 +1,46 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { Gauge, MetricsService } from "../services/metrics.service.js";
+
+const metricsPlugin: FastifyPluginAsync = async (fastify, _options) => {
+  const metrics = new MetricsService();
+  metrics.register(
+    new Gauge("steel_live_view_viewers", "Distinct live viewers connected", () =>
+      fastify.viewerService.count(),
+    ),
+  );
+
+  const { eventBus } = fastify;
+  eventBus.subscribe("viewer.connected", () => {
+    metrics.liveViewConnections.inc();
+    metrics.liveViewConnectionEvents.inc({ state: "open" });
+  });
+  eventBus.subscribe("viewer.disconnected", () => {
+    metrics.liveViewConnections.dec();
+    metrics.liveViewConnectionEvents.inc({ state: "closed" });
+  });
+  eventBus.subscribe("viewer.rejected", () => {
+    metrics.liveViewConnectionEvents.inc({ state: "rejected" });
+  });
+  eventBus.subscribe("viewer.heartbeatTimeout", () => {
+    metrics.liveViewConnectionEvents.inc({ state: "heartbeat_timeout" });
+  });
+  eventBus.subscribe("media.frameSent", ({ bytes }) => {
+    metrics.liveViewFramesSent.inc();
+    metrics.liveViewFrameBytes.inc({}, bytes);
+  });
+  eventBus.subscribe("media.frameDropped", ({ reason }) => {
+    metrics.liveViewFramesDropped.inc({ reason });
+  });
+  eventBus.subscribe("input.dropped", ({ reason }) => {
+    metrics.liveViewInputDropped.inc({ reason });
+  });
+  eventBus.subscribe("input.dispatched", ({ type, durationSeconds }) => {
+    metrics.liveViewInputEvents.inc({ type });
+    metrics.liveViewInputLatency.observe(durationSeconds, { type });
+  });
+
+  fastify.decorate("metrics", metrics);
+};
+
+export default fp(metricsPlugin, "5.x");
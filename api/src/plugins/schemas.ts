@@ -11,6 +11,7 @@ import seleniumSchemas from "../modules/selenium/selenium.schema.js";
 import scalarTheme from "./scalar-theme.js";
 import { buildJsonSchemas } from "../utils/schema.js";
 import filesSchemas from "../modules/files/files.schema.js";
+import usageSchemas from "../modules/usage/usage.schema.js";
 import { getBaseUrl } from "../utils/url.js";
 
 const SCHEMAS = {
@@ -20,6 +21,7 @@ const SCHEMAS = {
   ...cdpSchemas,
   ...seleniumSchemas,
   ...filesSchemas,
+  ...usageSchemas,
 };
 
 export const { schemas, $ref } = buildJsonSchemas(SCHEMAS);
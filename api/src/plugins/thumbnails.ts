@@ -0,0 +1,63 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { env } from "../env.js";
+import { ThumbnailService } from "../services/thumbnail.service.js";
+import { getTargetId } from "../utils/browser.js";
+
+const THUMBNAIL_QUALITY = 60;
+
+const thumbnailsPlugin: FastifyPluginAsync = async (fastify, _options) => {
+  const { cdpService, sessionService, viewerService } = fastify;
+
+  const thumbnails = new ThumbnailService(
+    async () => {
+      const session = sessionService.activeSession;
+      if (session.status !== "live" || !cdpService.isRunning()) {
+        return null;
+      }
+      // What blanking or a pause hides from viewers must not leak through previews
+      if (viewerService.isBlanked() || sessionService.isPaused()) {
+        return null;
+      }
+
+      const page = await cdpService.getPrimaryPage();
+      const client = await page.target().createCDPSession();
+      try {
+        // The clip is in page coordinates, so it follows the scroll position to show what a
+        // viewer would see
+        const { cssVisualViewport } = await client.send("Page.getLayoutMetrics");
+        const { pageX, pageY, clientWidth, clientHeight } = cssVisualViewport;
+        const { data } = await client.send("Page.captureScreenshot", {
+          format: "jpeg",
+          quality: THUMBNAIL_QUALITY,
+          clip: {
+            x: pageX,
+            y: pageY,
+            width: clientWidth,
+            height: clientHeight,
+            scale: Math.min(1, env.THUMBNAIL_WIDTH / clientWidth),
+          },
+        });
+        return {
+          sessionId: session.id,
+          pageId: getTargetId(page),
+          data: Buffer.from(data, "base64"),
+        };
+      } finally {
+        await client.detach().catch(() => {});
+      }
+    },
+    fastify.log,
+    fastify.eventBus,
+  );
+  if (env.THUMBNAIL_INTERVAL_MS > 0) {
+    thumbnails.start(env.THUMBNAIL_INTERVAL_MS);
+  }
+  fastify.decorate("thumbnails", thumbnails);
+
+  fastify.addHook("onClose", async () => {
+    thumbnails.stop();
+  });
+};
+
+export default fp(thumbnailsPlugin, "5.x");
@@ -0,0 +1,46 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { env } from "../env.js";
+import { UsageService } from "../services/usage.service.js";
+
+// Exports run shortly after midnight UTC, once the day before is complete
+const EXPORT_DELAY_MS = 60_000;
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+const usagePlugin: FastifyPluginAsync = async (fastify, _options) => {
+  const usage = new UsageService(env.USAGE_RETENTION_DAYS);
+  const detach = usage.attach(fastify.eventBus);
+  fastify.decorate("usage", usage);
+
+  let exportTimer: NodeJS.Timeout | null = null;
+  let closed = false;
+  const scheduleExport = (directory: string) => {
+    if (closed) {
+      return;
+    }
+    const now = Date.now();
+    const nextRun = (Math.floor(now / DAY_MS) + 1) * DAY_MS + EXPORT_DELAY_MS;
+    exportTimer = setTimeout(() => {
+      const date = new Date(nextRun - DAY_MS).toISOString().slice(0, 10);
+      usage
+        .export(date, directory, env.USAGE_EXPORT_FORMAT)
+        .then((file) => fastify.log.info({ file, date }, "Exported daily usage"))
+        .catch((err) => fastify.log.error({ err, date }, "Failed to export daily usage"))
+        .finally(() => scheduleExport(directory));
+    }, nextRun - now);
+    exportTimer.unref();
+  };
+  if (env.USAGE_EXPORT_DIR) {
+    scheduleExport(env.USAGE_EXPORT_DIR);
+  }
+
+  fastify.addHook("onClose", async () => {
+    closed = true;
+    if (exportTimer) {
+      clearTimeout(exportTimer);
+    }
+    detach();
+  });
+};
+
+export default fp(usagePlugin, "5.x");
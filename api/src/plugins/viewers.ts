@@ -0,0 +1,37 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { env } from "../env.js";
+import { ConnectionHistoryService } from "../services/connection-history.service.js";
+import { ViewerService } from "../services/viewer.service.js";
+
+const viewersPlugin: FastifyPluginAsync = async (fastify, _options) => {
+  const viewerService = new ViewerService(fastify.log);
+  fastify.eventBus.subscribe("media.frameSent", ({ connectionId, bytes }) => {
+    viewerService.recordFrameSent(connectionId, bytes);
+  });
+  fastify.eventBus.subscribe("media.frameDropped", ({ connectionId, reason }) => {
+    // Unchanged frames are skipped on purpose and carry nothing the viewer missed
+    if (reason !== "unchanged") {
+      viewerService.recordFrameDropped(connectionId);
+    }
+  });
+  // Pointers, caps, blanking and grants of a session are dropped as soon as it ends, rather than
+  // lingering until the next one starts
+  fastify.eventBus.subscribe("session.ended", () => {
+    viewerService.resetSession();
+  });
+  // Tell everyone watching a session about maintenance, so it does not come as a surprise
+  fastify.eventBus.subscribe("maintenance.started", ({ message, until }) => {
+    viewerService.broadcast({ type: "maintenance", active: true, message, until });
+  });
+  fastify.eventBus.subscribe("maintenance.ended", () => {
+    viewerService.broadcast({ type: "maintenance", active: false });
+  });
+  fastify.decorate("viewerService", viewerService);
+
+  const connectionHistory = new ConnectionHistoryService(env.LIVE_VIEW_HISTORY_RETENTION_MS);
+  connectionHistory.attach(fastify.eventBus);
+  fastify.decorate("connectionHistory", connectionHistory);
+};
+
+export default fp(viewersPlugin, "5.x");
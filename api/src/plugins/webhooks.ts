@@ -0,0 +1,26 @@
+import { FastifyPluginAsync } from "fastify";
+import fp from "fastify-plugin";
+import { env } from "../env.js";
+import { BusTopic } from "../services/event-bus.service.js";
+import { WEBHOOK_EVENTS, WebhookService } from "../services/webhook.service.js";
+
+const webhooksPlugin: FastifyPluginAsync = async (fastify, _options) => {
+  if (env.WEBHOOK_URLS.length === 0) {
+    return;
+  }
+
+  const isKnownEvent = (event: string): event is BusTopic =>
+    WEBHOOK_EVENTS.includes(event as BusTopic);
+  const unknownEvents = env.WEBHOOK_EVENTS.filter((event) => !isKnownEvent(event));
+  if (unknownEvents.length > 0) {
+    fastify.log.warn({ unknownEvents }, "Ignoring unknown webhook events");
+  }
+
+  new WebhookService(fastify.log, {
+    urls: env.WEBHOOK_URLS,
+    events: env.WEBHOOK_EVENTS.filter(isKnownEvent),
+    secret: env.WEBHOOK_SECRET,
+  }).attach(fastify.eventBus);
+};
+
+export default fp(webhooksPlugin, "5.x");
@@ -0,0 +1,243 @@
+import { createHmac } from "crypto";
+import { IncomingMessage } from "http";
+import { afterEach, describe, expect, it, vi } from "vitest";
+import {
+  ChainAuthorizer,
+  HttpAuthorizer,
+  JwtAuthorizer,
+  StaticTokenAuthorizer,
+} from "./authorizer.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+const request = (url: string, headers: Record<string, string> = {}) =>
+  ({ method: "GET", url, headers }) as unknown as IncomingMessage;
+
+// Far enough in the future for tokens that are verified against the real clock
+const exp = 4_000_000_000;
+
+const encode = (value: object) => Buffer.from(JSON.stringify(value)).toString("base64url");
+
+const signHs256 = (claims: object, secret: string) => {
+  const input = `${encode({ alg: "HS256", typ: "JWT" })}.${encode(claims)}`;
+  return `${input}.${createHmac("sha256", secret).update(input).digest("base64url")}`;
+};
+
+const messageContext = {
+  sessionId: "s1",
+  viewerId: "v1",
+  connectionId: "c1",
+  type: "mouseEvent",
+  claims: null,
+};
+
+describe("StaticTokenAuthorizer", () => {
+  const authorizer = new StaticTokenAuthorizer(["key-1", "key-2"]);
+
+  it("accepts any configured key from a header, bearer token or query parameter", async () => {
+    await expect(
+      authorizer.checkAdmin(request("/v1/sessions", { "x-api-key": "key-1" })),
+    ).resolves.toMatchObject({ allowed: true });
+    await expect(
+      authorizer.checkAdmin(request("/v1/sessions", { authorization: "Bearer key-2" })),
+    ).resolves.toMatchObject({ allowed: true });
+    await expect(
+      authorizer.checkAdmin(request("/v1/sessions/debug?apiKey=key-1")),
+    ).resolves.toMatchObject({ allowed: true });
+  });
+
+  it("does not take the key from the query string of live view sockets", async () => {
+    const context = { sessionId: "s1", token: null };
+
+    await expect(
+      authorizer.checkUpgrade(request("/v1/sessions/cast?apiKey=key-1"), context),
+    ).resolves.toMatchObject({ allowed: false });
+    await expect(
+      authorizer.checkUpgrade(request("/v1/sessions/cast", { "x-api-key": "key-1" }), context),
+    ).resolves.toMatchObject({ allowed: true });
+  });
+
+  it("takes the key from the query string of the live view page", async () => {
+    await expect(
+      authorizer.checkUpgrade(request("/v1/sessions/debug?apiKey=key-1"), {
+        sessionId: "s1",
+        token: null,
+        page: true,
+      }),
+    ).resolves.toMatchObject({ allowed: true });
+  });
+
+  it("rejects missing and unknown keys", async () => {
+    await expect(authorizer.checkAdmin(request("/v1/sessions"))).resolves.toEqual({
+      allowed: false,
+      reason: "Invalid or missing API key",
+    });
+    await expect(
+      authorizer.checkAdmin(request("/v1/sessions", { "x-api-key": "key-3" })),
+    ).resolves.toMatchObject({ allowed: false });
+  });
+});
+
+describe("JwtAuthorizer", () => {
+  const authorizer = new JwtAuthorizer({ secret: "secret" });
+
+  it("grants the claims of a valid token", async () => {
+    const token = signHs256({ sessionId: "s1", permission: "view", exp }, "secret");
+
+    await expect(
+      authorizer.checkUpgrade(request("/v1/sessions/cast"), { sessionId: "s1", token }),
+    ).resolves.toEqual({ allowed: true, claims: { sessionId: "s1", permission: "view", exp } });
+  });
+
+  it("rejects missing and invalid tokens", async () => {
+    const token = signHs256({ sessionId: "s1", exp }, "other");
+
+    await expect(
+      authorizer.checkUpgrade(request("/v1/sessions/cast"), { sessionId: "s1", token }),
+    ).resolves.toMatchObject({ allowed: false });
+    await expect(
+      authorizer.checkUpgrade(request("/v1/sessions/cast"), { sessionId: "s1", token: null }),
+    ).resolves.toMatchObject({ allowed: false });
+  });
+});
+
+describe("HttpAuthorizer", () => {
+  afterEach(() => {
+    vi.unstubAllGlobals();
+  });
+
+  it("asks the policy service and returns its decision", async () => {
+    const fetchMock = vi.fn().mockResolvedValue({
+      ok: true,
+      json: async () => ({ allowed: true, claims: { permission: "view" } }),
+    });
+    vi.stubGlobal("fetch", fetchMock);
+    const authorizer = new HttpAuthorizer(createLogger() as any, {
+      url: "https://policy.example.com/check",
+    });
+
+    await expect(
+      authorizer.checkUpgrade(
+        request("/v1/sessions/cast?pageId=p1&apiKey=key", {
+          authorization: "Bearer abc",
+          cookie: "secret",
+        }),
+        { sessionId: "s1", token: "abc" },
+      ),
+    ).resolves.toEqual({ allowed: true, claims: { permission: "view" } });
+
+    const [url, init] = fetchMock.mock.calls[0];
+    expect(url).toBe("https://policy.example.com/check");
+    expect(JSON.parse(init.body)).toEqual({
+      action: "upgrade",
+      sessionId: "s1",
+      token: "abc",
+      request: {
+        method: "GET",
+        url: "/v1/sessions/cast?pageId=p1&apiKey=[REDACTED]",
+        headers: { authorization: "Bearer abc" },
+      },
+    });
+  });
+
+  it("denies when the policy service fails", async () => {
+    vi.stubGlobal("fetch", vi.fn().mockResolvedValue({ ok: false, status: 500 }));
+    const failing = new HttpAuthorizer(createLogger() as any, { url: "https://policy" });
+    await expect(failing.checkAdmin(request("/v1/sessions"))).resolves.toMatchObject({
+      allowed: false,
+    });
+
+    vi.stubGlobal("fetch", vi.fn().mockRejectedValue(new Error("ECONNREFUSED")));
+    const unreachable = new HttpAuthorizer(createLogger() as any, { url: "https://policy" });
+    await expect(unreachable.checkAdmin(request("/v1/sessions"))).resolves.toEqual({
+      allowed: false,
+      reason: "Authorization service unavailable",
+    });
+  });
+
+  it("reuses message decisions per connection and message type", async () => {
+    const fetchMock = vi.fn().mockResolvedValue({
+      ok: true,
+      json: async () => ({ allowed: false, reason: "Read only" }),
+    });
+    vi.stubGlobal("fetch", fetchMock);
+    const authorizer = new HttpAuthorizer(createLogger() as any, {
+      url: "https://policy",
+      cacheMs: 1000,
+    });
+
+    await expect(authorizer.checkMessage(messageContext, 0)).resolves.toEqual({
+      allowed: false,
+      reason: "Read only",
+    });
+    await authorizer.checkMessage(messageContext, 500);
+    expect(fetchMock).toHaveBeenCalledTimes(1);
+
+    await authorizer.checkMessage({ ...messageContext, type: "keyEvent" }, 500);
+    await authorizer.checkMessage(messageContext, 1000);
+    expect(fetchMock).toHaveBeenCalledTimes(3);
+  });
+});
+
+describe("ChainAuthorizer", () => {
+  it("requires every authorizer to allow messages", async () => {
+    const allow = (claims?: Record<string, unknown>) => ({
+      name: "allow",
+      checkUpgrade: vi.fn().mockResolvedValue({ allowed: true, claims }),
+      checkMessage: vi.fn().mockResolvedValue({ allowed: true }),
+      checkAdmin: vi.fn().mockResolvedValue({ allowed: true }),
+    });
+    const deny = {
+      ...allow(),
+      name: "deny",
+      checkMessage: vi.fn().mockResolvedValue({ allowed: false, reason: "No input" }),
+    };
+    const last = allow();
+    const chain = new ChainAuthorizer([allow({ sessionId: "s1" }), deny, last]);
+
+    expect(chain.name).toBe("allow,deny,allow");
+    await expect(chain.checkMessage(messageContext)).resolves.toEqual({
+      allowed: false,
+      reason: "No input",
+    });
+    expect(last.checkMessage).not.toHaveBeenCalled();
+  });
+
+  it("accepts an upgrade any authorizer allows, with its claims", async () => {
+    const viewerToken = signHs256({ sessionId: "s1", permission: "view", exp }, "secret");
+    const chain = new ChainAuthorizer([
+      new StaticTokenAuthorizer(["key-1"]),
+      new JwtAuthorizer({ secret: "secret" }),
+    ]);
+
+    await expect(
+      chain.checkUpgrade(request("/v1/sessions/cast"), { sessionId: "s1", token: viewerToken }),
+    ).resolves.toEqual({ allowed: true, claims: { sessionId: "s1", permission: "view", exp } });
+    await expect(
+      chain.checkUpgrade(request("/v1/sessions/cast", { "x-api-key": "key-1" }), {
+        sessionId: "s1",
+        token: null,
+      }),
+    ).resolves.toEqual({ allowed: true });
+    await expect(
+      chain.checkUpgrade(request("/v1/sessions/cast"), { sessionId: "s1", token: "nope" }),
+    ).resolves.toEqual({
+      allowed: false,
+      reason: "Invalid or missing API key; Malformed token",
+    });
+  });
+});
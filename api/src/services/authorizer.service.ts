@@ -0,0 +1,328 @@
+import { timingSafeEqual } from "crypto";
+import { FastifyBaseLogger } from "fastify";
+import { IncomingMessage } from "http";
+import { JwtClaims, JwtVerifyOptions, verifyJwt } from "../utils/jwt.js";
+import { redactUrl } from "../utils/url.js";
+
+export interface AuthorizationDecision {
+  allowed: boolean;
+  /** Why the request was refused, reported to the client */
+  reason?: string;
+  /** Claims of the verified credential, e.g. permission, sessionId or maxBitrateKbps */
+  claims?: JwtClaims;
+}
+
+export interface UpgradeContext {
+  /** Session the live view connection would attach to */
+  sessionId: string;
+  /** Token passed in the path, the token query parameter or a bearer header */
+  token: string | null;
+  /**
+   * Set when the request is for the live view page rather than one of its sockets. The page is
+   * opened by browsers like other pages, so it may carry an API key in its URL.
+   */
+  page?: boolean;
+}
+
+export interface MessageContext {
+  sessionId: string;
+  viewerId: string;
+  connectionId: string;
+  /** Type of the cast message, e.g. mouseEvent or navigation */
+  type: string;
+  /** Claims granted when the connection was upgraded */
+  claims: JwtClaims | null;
+}
+
+/**
+ * Decides who may use the server. checkAdmin guards the HTTP API and WebSocket connections with
+ * full browser access (CDP, logs, recordings), checkUpgrade guards live view connections and
+ * checkMessage every message sent over one. Implementations that have no opinion on a check
+ * allow it.
+ */
+export interface Authorizer {
+  readonly name: string;
+  checkUpgrade(request: IncomingMessage, context: UpgradeContext): Promise<AuthorizationDecision>;
+  checkMessage(context: MessageContext): Promise<AuthorizationDecision>;
+  checkAdmin(request: IncomingMessage): Promise<AuthorizationDecision>;
+}
+
+const ALLOWED: AuthorizationDecision = { allowed: true };
+
+export class NoneAuthorizer implements Authorizer {
+  public readonly name = "none";
+
+  public async checkUpgrade(): Promise<AuthorizationDecision> {
+    return ALLOWED;
+  }
+
+  public async checkMessage(): Promise<AuthorizationDecision> {
+    return ALLOWED;
+  }
+
+  public async checkAdmin(): Promise<AuthorizationDecision> {
+    return ALLOWED;
+  }
+}
+
+/**
+ * Reads the API key from the X-API-Key header, a bearer token, or the apiKey query parameter.
+ * The query parameter exists for browsers opening the live view page, which cannot set headers.
+ * Live view sockets use the viewer token the page is served with instead, so the query parameter
+ * is not accepted for them.
+ */
+function getApiKey(request: IncomingMessage, allowQuery = true): string | null {
+  const header = request.headers["x-api-key"];
+  if (typeof header === "string" && header) {
+    return header;
+  }
+
+  const authorization = request.headers.authorization;
+  if (authorization?.toLowerCase().startsWith("bearer ")) {
+    return authorization.slice("bearer ".length).trim();
+  }
+
+  if (!allowQuery) {
+    return null;
+  }
+  const query = new URLSearchParams(request.url?.split("?")[1] || "");
+  return query.get("apiKey");
+}
+
+/**
+ * Requires one of a set of static API keys on every request and connection.
+ */
+export class StaticTokenAuthorizer implements Authorizer {
+  public readonly name = "token";
+  private readonly keys: Buffer[];
+
+  constructor(keys: string[]) {
+    this.keys = keys.map((key) => Buffer.from(key));
+  }
+
+  public async checkUpgrade(
+    request: IncomingMessage,
+    context: UpgradeContext,
+  ): Promise<AuthorizationDecision> {
+    return this.check(getApiKey(request, !!context.page));
+  }
+
+  public async checkMessage(): Promise<AuthorizationDecision> {
+    return ALLOWED;
+  }
+
+  public async checkAdmin(request: IncomingMessage): Promise<AuthorizationDecision> {
+    return this.check(getApiKey(request));
+  }
+
+  private check(key: string | null): AuthorizationDecision {
+    const candidate = Buffer.from(key ?? "");
+    const valid =
+      !!key &&
+      this.keys.some(
+        (apiKey) => apiKey.length === candidate.length && timingSafeEqual(apiKey, candidate),
+      );
+    return valid ? ALLOWED : { allowed: false, reason: "Invalid or missing API key" };
+  }
+}
+
+/**
+ * Requires a valid JWT for live view connections. Its claims are handed to the connection, which
+ * applies the sessionId, permission and maxBitrateKbps claims. Tokens only authorize live view,
+ * so admin checks are left to other authorizers.
+ */
+export class JwtAuthorizer implements Authorizer {
+  public readonly name = "jwt";
+
+  constructor(private readonly options: JwtVerifyOptions) {}
+
+  public async checkUpgrade(
+    _request: IncomingMessage,
+    context: UpgradeContext,
+  ): Promise<AuthorizationDecision> {
+    try {
+      return { allowed: true, claims: await verifyJwt(context.token ?? "", this.options) };
+    } catch (err) {
+      return { allowed: false, reason: err instanceof Error ? err.message : "Invalid token" };
+    }
+  }
+
+  public async checkMessage(): Promise<AuthorizationDecision> {
+    return ALLOWED;
+  }
+
+  public async checkAdmin(): Promise<AuthorizationDecision> {
+    return ALLOWED;
+  }
+}
+
+export interface HttpAuthorizerOptions {
+  url: string;
+  timeoutMs?: number;
+  /** How long message decisions are reused for the same connection and message type */
+  cacheMs?: number;
+}
+
+// Request headers the policy service may base its decision on
+const FORWARDED_HEADERS = [
+  "authorization",
+  "x-api-key",
+  "host",
+  "origin",
+  "user-agent",
+  "x-forwarded-for",
+];
+const MAX_CACHED_DECISIONS = 10_000;
+
+/**
+ * Asks an external policy service. Each check is POSTed as JSON with an action of "upgrade",
+ * "message" or "admin", and the service answers with { allowed, reason?, claims? }. Errors and
+ * timeouts deny, so an unreachable policy service never opens the server up. Message decisions
+ * are cached briefly, since viewers send dozens of messages a second.
+ */
+export class HttpAuthorizer implements Authorizer {
+  public readonly name = "http";
+  private logger: FastifyBaseLogger;
+  private messageDecisions = new Map<
+    string,
+    { decision: Promise<AuthorizationDecision>; expiresAt: number }
+  >();
+
+  constructor(
+    logger: FastifyBaseLogger,
+    private readonly options: HttpAuthorizerOptions,
+  ) {
+    this.logger = logger.child({ component: "HttpAuthorizer" });
+  }
+
+  public async checkUpgrade(
+    request: IncomingMessage,
+    context: UpgradeContext,
+  ): Promise<AuthorizationDecision> {
+    return this.ask({ action: "upgrade", ...context, request: this.describeRequest(request) });
+  }
+
+  public async checkMessage(
+    context: MessageContext,
+    now: number = Date.now(),
+  ): Promise<AuthorizationDecision> {
+    const key = `${context.connectionId}:${context.type}`;
+    const cached = this.messageDecisions.get(key);
+    if (cached && cached.expiresAt > now) {
+      return cached.decision;
+    }
+
+    if (this.messageDecisions.size >= MAX_CACHED_DECISIONS) {
+      for (const [cachedKey, entry] of this.messageDecisions) {
+        if (entry.expiresAt <= now) {
+          this.messageDecisions.delete(cachedKey);
+        }
+      }
+    }
+    const decision = this.ask({ action: "message", ...context });
+    this.messageDecisions.set(key, { decision, expiresAt: now + (this.options.cacheMs ?? 5000) });
+    return decision;
+  }
+
+  public async checkAdmin(request: IncomingMessage): Promise<AuthorizationDecision> {
+    return this.ask({ action: "admin", request: this.describeRequest(request) });
+  }
+
+  private describeRequest(request: IncomingMessage) {
+    const headers: Record<string, string> = {};
+    for (const name of FORWARDED_HEADERS) {
+      const value = request.headers[name];
+      if (value !== undefined) {
+        headers[name] = Array.isArray(value) ? value.join(", ") : value;
+      }
+    }
+    // Credentials in the query string stay here, the headers above are forwarded on purpose
+    return { method: request.method, url: redactUrl(request.url ?? ""), headers };
+  }
+
+  private async ask(body: Record<string, unknown>): Promise<AuthorizationDecision> {
+    try {
+      const response = await fetch(this.options.url, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body),
+        signal: AbortSignal.timeout(this.options.timeoutMs ?? 2000),
+      });
+      if (!response.ok) {
+        this.logger.warn({ status: response.status, action: body.action }, "Policy service error");
+        return { allowed: false, reason: "Authorization failed" };
+      }
+
+      const { allowed, reason, claims } = (await response.json()) as Record<string, unknown>;
+      return {
+        allowed: allowed === true,
+        ...(typeof reason === "string" ? { reason } : {}),
+        ...(claims && typeof claims === "object" ? { claims: claims as JwtClaims } : {}),
+      };
+    } catch (err) {
+      this.logger.warn({ err, action: body.action }, "Policy service unreachable");
+      return { allowed: false, reason: "Authorization service unavailable" };
+    }
+  }
+}
+
+/**
+ * Combines authorizers: an admin or message check passes only if every authorizer allows it, and
+ * the claims they grant are merged, later authorizers overriding earlier ones. Live view upgrades
+ * are different, each authorizer accepts a credential of its own (an API key, a viewer JWT), so
+ * the first one to allow the upgrade decides and its claims apply.
+ */
+export class ChainAuthorizer implements Authorizer {
+  public readonly name: string;
+
+  constructor(private readonly authorizers: Authorizer[]) {
+    this.name = authorizers.length ? authorizers.map(({ name }) => name).join(",") : "none";
+  }
+
+  public checkUpgrade(
+    request: IncomingMessage,
+    context: UpgradeContext,
+  ): Promise<AuthorizationDecision> {
+    return this.any((authorizer) => authorizer.checkUpgrade(request, context));
+  }
+
+  public checkMessage(context: MessageContext): Promise<AuthorizationDecision> {
+    return this.all((authorizer) => authorizer.checkMessage(context));
+  }
+
+  public checkAdmin(request: IncomingMessage): Promise<AuthorizationDecision> {
+    return this.all((authorizer) => authorizer.checkAdmin(request));
+  }
+
+  private async all(
+    check: (authorizer: Authorizer) => Promise<AuthorizationDecision>,
+  ): Promise<AuthorizationDecision> {
+    let claims: JwtClaims | undefined;
+    for (const authorizer of this.authorizers) {
+      const decision = await check(authorizer);
+      if (!decision.allowed) {
+        return decision;
+      }
+      if (decision.claims) {
+        claims = { ...claims, ...decision.claims };
+      }
+    }
+    return claims ? { allowed: true, claims } : ALLOWED;
+  }
+
+  private async any(
+    check: (authorizer: Authorizer) => Promise<AuthorizationDecision>,
+  ): Promise<AuthorizationDecision> {
+    const reasons: string[] = [];
+    for (const authorizer of this.authorizers) {
+      const decision = await check(authorizer);
+      if (decision.allowed) {
+        return decision;
+      }
+      if (decision.reason) {
+        reasons.push(decision.reason);
+      }
+    }
+    return { allowed: false, reason: reasons.length ? reasons.join("; ") : "Unauthorized" };
+  }
+}
@@ -448,6 +448,39 @@ export class CDPService extends EventEmitter {
     }
   }
 
+  /**
+   * Resizes the windows of the browser's pages. Unlike a device metrics override, the size holds
+   * without a CDP session and applies to pages nobody is watching.
+   */
+  @traceable
+  public async resizeWindows(width: number, height: number): Promise<void> {
+    if (!this.browserInstance) {
+      throw new Error("Browser instance not initialized");
+    }
+
+    const pages = await this.browserInstance.pages();
+    const session = await this.browserInstance.target().createCDPSession();
+    try {
+      const windowIds = new Set<number>();
+      for (const page of pages) {
+        const { windowId } = await session.send("Browser.getWindowForTarget", {
+          targetId: this.getTargetId(page),
+        });
+        windowIds.add(windowId);
+      }
+      for (const windowId of windowIds) {
+        // Maximized and fullscreen windows ignore a new size
+        await session.send("Browser.setWindowBounds", {
+          windowId,
+          bounds: { windowState: "normal" },
+        });
+        await session.send("Browser.setWindowBounds", { windowId, bounds: { width, height } });
+      }
+    } finally {
+      await session.detach().catch(() => {});
+    }
+  }
+
   public async createPage(): Promise<Page> {
     if (!this.browserInstance) {
       throw new Error("Browser instance not initialized");
@@ -0,0 +1,78 @@
+import { describe, expect, it, vi } from "vitest";
+import { ConnectionHistoryService } from "./connection-history.service.js";
+import { EventBus } from "./event-bus.service.js";
+
+const connected = { connectionId: "c1", viewerId: "v1", sessionId: "s1", pageId: "p1" };
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+describe("ConnectionHistoryService", () => {
+  it("records the lifecycle of a connection", () => {
+    const history = new ConnectionHistoryService(60_000);
+    history.recordConnected(connected, 1000);
+    history.recordDisconnected({ ...connected, code: 1006, reason: "" }, 5000);
+
+    const [record] = history.list("s1", 6000).connections;
+    expect(record).toMatchObject({
+      connectionId: "c1",
+      openedAt: 1000,
+      closedAt: 5000,
+      closeCode: 1006,
+      closeReason: null,
+    });
+    expect(record.timeline.map((entry) => entry.event)).toEqual(["connected", "disconnected"]);
+  });
+
+  it("forgets closed connections and rejections after the retention window", () => {
+    const history = new ConnectionHistoryService(60_000);
+    history.recordConnected(connected, 0);
+    history.recordConnected({ ...connected, connectionId: "c2" }, 0);
+    history.recordDisconnected(connected, 1000);
+    history.recordRejected({ viewerId: "v2", sessionId: "s1", reason: "session_full" }, 1000);
+
+    expect(history.list("s1", 30_000).rejections).toHaveLength(1);
+
+    const { connections, rejections } = history.list("s1", 62_000);
+    expect(connections.map((record) => record.connectionId)).toEqual(["c2"]);
+    expect(rejections).toHaveLength(0);
+  });
+
+  it("only lists connections of the requested session", () => {
+    const history = new ConnectionHistoryService(60_000);
+    history.recordConnected(connected, 0);
+    history.recordConnected({ ...connected, connectionId: "c2", sessionId: "s2" }, 0);
+
+    expect(history.list("s2", 0).connections.map((record) => record.connectionId)).toEqual(["c2"]);
+  });
+
+  it("records when dropped input was sent and received", () => {
+    const history = new ConnectionHistoryService(60_000);
+    const bus = new EventBus(createLogger() as any);
+    history.attach(bus);
+    history.recordConnected(connected);
+
+    const dropped = { connectionId: "c1", viewerId: "v1", type: "keyEvent", reason: "timeout" };
+    bus.publish("input.dropped", { ...dropped, receivedAt: 2000, clientTs: 1950 });
+    bus.publish("input.dropped", { ...dropped, receivedAt: 3000 });
+
+    const [record] = history.list("s1").connections;
+    expect(record.timeline.slice(1).map((entry) => entry.detail)).toEqual([
+      { type: "keyEvent", reason: "timeout", receivedAt: 2000, clientTs: 1950 },
+      { type: "keyEvent", reason: "timeout", receivedAt: 3000 },
+    ]);
+  });
+});
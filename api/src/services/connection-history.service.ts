@@ -0,0 +1,137 @@
+import { BusEvents, EventBus } from "./event-bus.service.js";
+
+export interface ConnectionTimelineEntry {
+  at: number;
+  event: string;
+  detail?: Record<string, unknown>;
+}
+
+export interface ConnectionRecord {
+  connectionId: string;
+  viewerId: string;
+  sessionId: string;
+  pageId: string | null;
+  openedAt: number;
+  closedAt: number | null;
+  closeCode: number | null;
+  closeReason: string | null;
+  timeline: ConnectionTimelineEntry[];
+}
+
+export interface RejectionRecord {
+  at: number;
+  viewerId: string;
+  sessionId: string;
+  reason: string;
+}
+
+// Bounds memory for connections that drop a lot of input
+const MAX_TIMELINE_ENTRIES = 100;
+const MAX_REJECTIONS = 100;
+
+/**
+ * Keeps the lifecycle of live view connections, including closed ones for a retention window,
+ * so a session that failed to stream can be analyzed after its viewers are gone.
+ */
+export class ConnectionHistoryService {
+  private connections = new Map<string, ConnectionRecord>();
+  private rejections: RejectionRecord[] = [];
+
+  constructor(private readonly retentionMs: number) {}
+
+  public attach(bus: EventBus): () => void {
+    const unsubscribes = [
+      bus.subscribe("viewer.connected", (event) => this.recordConnected(event)),
+      bus.subscribe("viewer.disconnected", (event) => this.recordDisconnected(event)),
+      bus.subscribe("viewer.rejected", (event) => this.recordRejected(event)),
+      bus.subscribe("viewer.heartbeatTimeout", ({ connectionId }) =>
+        this.addEntry(connectionId, "heartbeatTimeout"),
+      ),
+      bus.subscribe("media.firstFrame", ({ connectionId }) =>
+        this.addEntry(connectionId, "firstFrame"),
+      ),
+      bus.subscribe("input.dropped", ({ connectionId, type, reason, receivedAt, clientTs }) =>
+        this.addEntry(connectionId, "inputDropped", {
+          type,
+          reason,
+          receivedAt,
+          ...(clientTs !== undefined ? { clientTs } : {}),
+        }),
+      ),
+    ];
+    return () => unsubscribes.forEach((unsubscribe) => unsubscribe());
+  }
+
+  public recordConnected(event: BusEvents["viewer.connected"], now: number = Date.now()): void {
+    this.prune(now);
+    this.connections.set(event.connectionId, {
+      ...event,
+      openedAt: now,
+      closedAt: null,
+      closeCode: null,
+      closeReason: null,
+      timeline: [{ at: now, event: "connected", detail: { pageId: event.pageId } }],
+    });
+  }
+
+  public recordDisconnected(
+    event: BusEvents["viewer.disconnected"],
+    now: number = Date.now(),
+  ): void {
+    const record = this.connections.get(event.connectionId);
+    if (!record) {
+      return;
+    }
+    record.closedAt = now;
+    record.closeCode = event.code ?? null;
+    record.closeReason = event.reason || null;
+    this.addEntry(event.connectionId, "disconnected", { code: event.code }, now);
+  }
+
+  public recordRejected(event: BusEvents["viewer.rejected"], now: number = Date.now()): void {
+    this.prune(now);
+    this.rejections.push({ at: now, ...event });
+    if (this.rejections.length > MAX_REJECTIONS) {
+      this.rejections.shift();
+    }
+  }
+
+  /**
+   * @returns open connections and connections closed within the retention window, oldest first
+   */
+  public list(
+    sessionId?: string,
+    now: number = Date.now(),
+  ): { connections: ConnectionRecord[]; rejections: RejectionRecord[] } {
+    this.prune(now);
+    const matches = (record: { sessionId: string }) => !sessionId || record.sessionId === sessionId;
+    return {
+      connections: Array.from(this.connections.values()).filter(matches),
+      rejections: this.rejections.filter(matches),
+    };
+  }
+
+  private addEntry(
+    connectionId: string,
+    event: string,
+    detail?: Record<string, unknown>,
+    now: number = Date.now(),
+  ): void {
+    const record = this.connections.get(connectionId);
+    if (!record || record.timeline.length >= MAX_TIMELINE_ENTRIES) {
+      return;
+    }
+    record.timeline.push(detail ? { at: now, event, detail } : { at: now, event });
+  }
+
+  private prune(now: number): void {
+    for (const [connectionId, record] of this.connections) {
+      if (record.closedAt !== null && now - record.closedAt > this.retentionMs) {
+        this.connections.delete(connectionId);
+      }
+    }
+    while (this.rejections.length > 0 && now - this.rejections[0].at > this.retentionMs) {
+      this.rejections.shift();
+    }
+  }
+}
@@ -0,0 +1,135 @@
+import { createHash } from "crypto";
+import { Readable } from "stream";
+import { afterEach, describe, expect, it, vi } from "vitest";
+import { DlpService } from "./dlp.service.js";
+import { EventBus } from "./event-bus.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+const sha256 = (data: string) => createHash("sha256").update(data).digest("hex");
+
+const respond = (body: object) =>
+  vi.fn().mockResolvedValue({ ok: true, status: 200, json: async () => body });
+
+describe("DlpService", () => {
+  afterEach(() => {
+    vi.unstubAllGlobals();
+  });
+
+  it("allows everything without an endpoint", async () => {
+    const fetchMock = vi.fn();
+    vi.stubGlobal("fetch", fetchMock);
+    const logger = createLogger();
+    const dlp = new DlpService(logger as any, new EventBus(logger as any), {});
+
+    await expect(
+      dlp.checkClipboard({ action: "copy", sessionId: "s1" }, { text: "secret" }),
+    ).resolves.toEqual({ allowed: true });
+    expect(fetchMock).not.toHaveBeenCalled();
+  });
+
+  it("sends metadata and a hash, and audits the decision", async () => {
+    const fetchMock = respond({ allowed: false, reason: "Contains a card number" });
+    vi.stubGlobal("fetch", fetchMock);
+    const logger = createLogger();
+    const bus = new EventBus(logger as any);
+    const decisions = vi.fn();
+    bus.subscribe("dlp.decision", decisions);
+    const dlp = new DlpService(logger as any, bus, { url: "https://dlp.example.com/check" });
+
+    await expect(
+      dlp.checkClipboard(
+        { action: "copy", sessionId: "s1", viewerId: "v1" },
+        { text: "4111 1111 1111 1111" },
+      ),
+    ).resolves.toEqual({ allowed: false, reason: "Contains a card number" });
+
+    const [url, init] = fetchMock.mock.calls[0];
+    expect(url).toBe("https://dlp.example.com/check");
+    expect(JSON.parse(init.body)).toEqual({
+      action: "copy",
+      sessionId: "s1",
+      viewerId: "v1",
+      channel: "clipboard",
+      size: 19,
+      sha256: sha256("4111 1111 1111 1111"),
+    });
+    expect(decisions).toHaveBeenCalledWith(
+      expect.objectContaining({ action: "copy", allowed: false, reason: "Contains a card number" }),
+    );
+  });
+
+  it("sends file content up to the size limit in content mode", async () => {
+    const fetchMock = respond({ allowed: true });
+    vi.stubGlobal("fetch", fetchMock);
+    const logger = createLogger();
+    const dlp = new DlpService(logger as any, new EventBus(logger as any), {
+      url: "https://dlp",
+      payload: "content",
+      maxContentBytes: 8,
+    });
+
+    await dlp.checkFile(
+      { action: "upload", sessionId: "s1", fileName: "a.txt" },
+      Readable.from([Buffer.from("hello")]),
+    );
+    await dlp.checkFile(
+      { action: "upload", sessionId: "s1", fileName: "b.txt" },
+      Readable.from([Buffer.from("hello "), Buffer.from("world")]),
+    );
+
+    const [small, large] = fetchMock.mock.calls.map(([, init]) => JSON.parse(init.body));
+    expect(small).toMatchObject({
+      channel: "file",
+      size: 5,
+      sha256: sha256("hello"),
+      content: { encoding: "base64", data: Buffer.from("hello").toString("base64") },
+    });
+    expect(large).toMatchObject({ size: 11, sha256: sha256("hello world") });
+    expect(large.content).toBeUndefined();
+  });
+
+  it("blocks when the endpoint fails unless configured to fail open", async () => {
+    vi.stubGlobal("fetch", vi.fn().mockRejectedValue(new Error("ECONNREFUSED")));
+    const logger = createLogger();
+    const bus = new EventBus(logger as any);
+    const closed = new DlpService(logger as any, bus, { url: "https://dlp" });
+    const open = new DlpService(logger as any, bus, { url: "https://dlp", failOpen: true });
+
+    await expect(
+      closed.checkClipboard({ action: "paste", sessionId: "s1" }, { text: "a" }),
+    ).resolves.toMatchObject({ allowed: false });
+    await expect(
+      open.checkClipboard({ action: "paste", sessionId: "s1" }, { text: "a" }),
+    ).resolves.toEqual({ allowed: true });
+  });
+
+  it("asks once for the same transfer of the same content", async () => {
+    const fetchMock = respond({ allowed: true });
+    vi.stubGlobal("fetch", fetchMock);
+    const logger = createLogger();
+    const dlp = new DlpService(logger as any, new EventBus(logger as any), { url: "https://dlp" });
+
+    await Promise.all([
+      dlp.checkClipboard({ action: "copy", sessionId: "s1" }, { text: "a" }),
+      dlp.checkClipboard({ action: "copy", sessionId: "s1" }, { text: "a" }),
+    ]);
+    await dlp.checkClipboard({ action: "copy", sessionId: "s1" }, { text: "b" });
+
+    expect(fetchMock).toHaveBeenCalledTimes(2);
+  });
+});
@@ -0,0 +1,188 @@
+import { createHash } from "crypto";
+import { FastifyBaseLogger } from "fastify";
+import { Readable } from "stream";
+import { ClipboardContent } from "../types/casting.js";
+import { EventBus } from "./event-bus.service.js";
+
+export type DlpAction = "paste" | "copy" | "upload" | "download";
+
+/** How much of the transferred data is sent to the DLP endpoint */
+export type DlpPayloadMode = "metadata" | "hash" | "content";
+
+export interface DlpTransfer {
+  /** paste and upload bring data into the session, copy and download take it out */
+  action: DlpAction;
+  sessionId: string;
+  /** Viewer that asked for the transfer, unset for API requests and broadcasts */
+  viewerId?: string;
+  fileName?: string;
+  mimeType?: string;
+}
+
+export interface DlpDecision {
+  allowed: boolean;
+  reason?: string;
+}
+
+export interface DlpOptions {
+  url?: string;
+  payload?: DlpPayloadMode;
+  /** Files larger than this are sent as metadata and hash only, even in content mode */
+  maxContentBytes?: number;
+  timeoutMs?: number;
+  /** Allow transfers when the endpoint cannot be reached, instead of blocking them */
+  failOpen?: boolean;
+  /** How long a decision is reused for the same transfer of the same content */
+  cacheMs?: number;
+}
+
+const ALLOWED: DlpDecision = { allowed: true };
+
+/** Reported to clients when the endpoint blocks a transfer without giving a reason */
+export const DLP_DENIED_MESSAGE = "Blocked by the data loss prevention policy";
+
+/**
+ * Asks an external data loss prevention endpoint before clipboard content or files enter or leave
+ * a session. Each transfer is POSTed as JSON with its metadata and, depending on the payload mode,
+ * a SHA-256 hash or the content itself; the endpoint answers { allowed, reason? }. Every decision
+ * is logged and published on the bus as dlp.decision for auditing. Without an endpoint all
+ * transfers are allowed.
+ */
+export class DlpService {
+  private logger: FastifyBaseLogger;
+  private decisions = new Map<string, { decision: Promise<DlpDecision>; expiresAt: number }>();
+
+  constructor(
+    logger: FastifyBaseLogger,
+    private readonly eventBus: EventBus,
+    private readonly options: DlpOptions,
+  ) {
+    this.logger = logger.child({ component: "DlpService" });
+  }
+
+  public isEnabled(): boolean {
+    return !!this.options.url;
+  }
+
+  public async checkClipboard(
+    transfer: DlpTransfer,
+    content: ClipboardContent,
+  ): Promise<DlpDecision> {
+    if (!this.isEnabled()) {
+      return ALLOWED;
+    }
+
+    const data = Buffer.from(content.text + (content.html ?? ""));
+    const sha256 = createHash("sha256").update(data).digest("hex");
+    return this.decide(transfer, {
+      channel: "clipboard",
+      size: data.length,
+      sha256,
+      content: { text: content.text, html: content.html },
+    });
+  }
+
+  /**
+   * Reads the file to hash it, so the caller has to open a new stream to send or save it
+   */
+  public async checkFile(transfer: DlpTransfer, stream: Readable): Promise<DlpDecision> {
+    if (!this.isEnabled()) {
+      stream.destroy();
+      return ALLOWED;
+    }
+
+    const maxContentBytes = this.options.maxContentBytes ?? 1024 * 1024;
+    const hash = createHash("sha256");
+    const chunks: Buffer[] = [];
+    let size = 0;
+    for await (const chunk of stream) {
+      const buffer = Buffer.isBuffer(chunk) ? chunk : Buffer.from(chunk);
+      hash.update(buffer);
+      size += buffer.length;
+      if (this.options.payload === "content" && size <= maxContentBytes) {
+        chunks.push(buffer);
+      }
+    }
+
+    return this.decide(transfer, {
+      channel: "file",
+      size,
+      sha256: hash.digest("hex"),
+      content:
+        size <= maxContentBytes
+          ? { encoding: "base64", data: Buffer.concat(chunks).toString("base64") }
+          : undefined,
+    });
+  }
+
+  private decide(
+    transfer: DlpTransfer,
+    data: { channel: "clipboard" | "file"; size: number; sha256: string; content?: unknown },
+    now: number = Date.now(),
+  ): Promise<DlpDecision> {
+    // Every connection on a page sees the same copy, only one of them needs to ask
+    const key = JSON.stringify([transfer, data.channel, data.sha256]);
+    const cached = this.decisions.get(key);
+    if (cached && cached.expiresAt > now) {
+      return cached.decision;
+    }
+    for (const [cachedKey, entry] of this.decisions) {
+      if (entry.expiresAt <= now) {
+        this.decisions.delete(cachedKey);
+      }
+    }
+
+    const payload = this.options.payload ?? "hash";
+    const decision = this.ask({
+      ...transfer,
+      channel: data.channel,
+      size: data.size,
+      ...(payload !== "metadata" ? { sha256: data.sha256 } : {}),
+      ...(payload === "content" && data.content ? { content: data.content } : {}),
+    }).then((decision) => {
+      const audit = {
+        ...transfer,
+        channel: data.channel,
+        size: data.size,
+        sha256: data.sha256,
+        allowed: decision.allowed,
+        reason: decision.reason,
+      };
+      this.logger.info(
+        { audit: "dlp_decision", ...audit },
+        decision.allowed ? "DLP allowed transfer" : "DLP blocked transfer",
+      );
+      this.eventBus.publish("dlp.decision", audit);
+      return decision;
+    });
+    this.decisions.set(key, { decision, expiresAt: now + (this.options.cacheMs ?? 5000) });
+    return decision;
+  }
+
+  private async ask(body: Record<string, unknown>): Promise<DlpDecision> {
+    const unavailable: DlpDecision = this.options.failOpen
+      ? ALLOWED
+      : { allowed: false, reason: "The data loss prevention service is unavailable" };
+    try {
+      const response = await fetch(this.options.url!, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body),
+        signal: AbortSignal.timeout(this.options.timeoutMs ?? 5000),
+      });
+      if (!response.ok) {
+        this.logger.warn({ status: response.status, action: body.action }, "DLP endpoint error");
+        return unavailable;
+      }
+
+      const { allowed, reason } = (await response.json()) as Record<string, unknown>;
+      return {
+        allowed: allowed === true,
+        ...(typeof reason === "string" ? { reason } : {}),
+      };
+    } catch (err) {
+      this.logger.warn({ err, action: body.action }, "DLP endpoint unreachable");
+      return unavailable;
+    }
+  }
+}
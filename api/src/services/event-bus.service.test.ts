@@ -0,0 +1,61 @@
+import { describe, expect, it, vi } from "vitest";
+import { EventBus } from "./event-bus.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+describe("EventBus", () => {
+  it("delivers events to topic and catch-all subscribers", () => {
+    const bus = new EventBus(createLogger() as any);
+    const onPaused = vi.fn();
+    const onAny = vi.fn();
+    bus.subscribe("session.paused", onPaused);
+    bus.subscribeAll(onAny);
+
+    bus.publish("session.paused", { sessionId: "s1" });
+    bus.publish("session.resumed", { sessionId: "s1" });
+
+    expect(onPaused).toHaveBeenCalledTimes(1);
+    expect(onPaused).toHaveBeenCalledWith({ sessionId: "s1" });
+    expect(onAny).toHaveBeenCalledTimes(2);
+    expect(onAny).toHaveBeenLastCalledWith("session.resumed", { sessionId: "s1" });
+  });
+
+  it("stops delivering after unsubscribing", () => {
+    const bus = new EventBus(createLogger() as any);
+    const handler = vi.fn();
+    const unsubscribe = bus.subscribe("media.frameSent", handler);
+
+    unsubscribe();
+    bus.publish("media.frameSent", { connectionId: "c1", bytes: 10 });
+
+    expect(handler).not.toHaveBeenCalled();
+  });
+
+  it("isolates failing handlers", () => {
+    const logger = createLogger();
+    const bus = new EventBus(logger as any);
+    const handler = vi.fn();
+    bus.subscribe("session.paused", () => {
+      throw new Error("boom");
+    });
+    bus.subscribe("session.paused", handler);
+
+    expect(() => bus.publish("session.paused", { sessionId: "s1" })).not.toThrow();
+    expect(handler).toHaveBeenCalled();
+    expect(logger.error).toHaveBeenCalled();
+  });
+});
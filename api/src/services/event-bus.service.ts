@@ -0,0 +1,138 @@
+import { FastifyBaseLogger } from "fastify";
+
+/**
+ * Events published on the bus, keyed by topic. Topics are grouped by prefix: session.*, viewer.*,
+ * media.*, input.*, dlp.* and maintenance.*
+ */
+export interface BusEvents {
+  "session.started": { sessionId: string };
+  /** A live session was released or replaced, per-session state should be dropped */
+  "session.ended": { sessionId: string };
+  "session.recordingStarted": { sessionId: string };
+  "session.paused": { sessionId: string };
+  "session.resumed": { sessionId: string };
+  "session.resized": { sessionId: string; width: number; height: number };
+  "session.thumbnail": {
+    sessionId: string;
+    pageId: string;
+    capturedAt: string;
+    /** Base64 JPEG image */
+    data: string;
+  };
+  "viewer.connected": {
+    connectionId: string;
+    viewerId: string;
+    sessionId: string;
+    pageId: string | null;
+    /** Connection this one resumed with a resume token */
+    resumedFrom?: string;
+  };
+  "viewer.disconnected": {
+    connectionId: string;
+    viewerId: string;
+    sessionId: string;
+    /** WebSocket close code and reason, when the socket closed cleanly */
+    code?: number;
+    reason?: string;
+  };
+  "viewer.rejected": { viewerId: string; sessionId: string; reason: string };
+  "viewer.heartbeatTimeout": { connectionId: string; viewerId: string };
+  "media.frameSent": { connectionId: string; bytes: number };
+  "media.firstFrame": { connectionId: string; viewerId: string; sessionId: string };
+  "media.frameDropped": { connectionId: string; reason: string };
+  "input.dropped": {
+    connectionId: string;
+    viewerId: string;
+    type: string;
+    reason: string;
+    /** When the server received the message, in milliseconds since the epoch */
+    receivedAt: number;
+    /** When the viewer says it sent the message, on the viewer's clock */
+    clientTs?: number;
+  };
+  "input.dispatched": {
+    connectionId: string;
+    viewerId: string;
+    type: string;
+    durationSeconds: number;
+    receivedAt: number;
+    clientTs?: number;
+  };
+  "dlp.decision": {
+    action: "paste" | "copy" | "upload" | "download";
+    channel: "clipboard" | "file";
+    sessionId: string;
+    viewerId?: string;
+    fileName?: string;
+    mimeType?: string;
+    size: number;
+    sha256: string;
+    allowed: boolean;
+    reason?: string;
+  };
+  "maintenance.started": { message: string; startedAt: string; until: string };
+  "maintenance.ended": { endedAt: string };
+}
+
+export type BusTopic = keyof BusEvents;
+
+type Handler<T extends BusTopic> = (payload: BusEvents[T]) => void;
+type AnyHandler = <T extends BusTopic>(topic: T, payload: BusEvents[T]) => void;
+
+/**
+ * In-process publish/subscribe bus. Producers publish without knowing who consumes an event, so
+ * metrics, audit logging and other consumers can be added without touching the producers.
+ * Handlers run synchronously and a throwing handler never affects the producer or other handlers.
+ */
+export class EventBus {
+  private logger: FastifyBaseLogger;
+  private handlers = new Map<BusTopic, Set<Handler<any>>>();
+  private anyHandlers = new Set<AnyHandler>();
+
+  constructor(logger: FastifyBaseLogger) {
+    this.logger = logger.child({ component: "EventBus" });
+  }
+
+  public publish<T extends BusTopic>(topic: T, payload: BusEvents[T]): void {
+    for (const handler of this.handlers.get(topic) ?? []) {
+      this.invoke(topic, () => handler(payload));
+    }
+    for (const handler of this.anyHandlers) {
+      this.invoke(topic, () => handler(topic, payload));
+    }
+  }
+
+  /**
+   * @returns a function that removes the subscription
+   */
+  public subscribe<T extends BusTopic>(topic: T, handler: Handler<T>): () => void {
+    let handlers = this.handlers.get(topic);
+    if (!handlers) {
+      handlers = new Set();
+      this.handlers.set(topic, handlers);
+    }
+    handlers.add(handler);
+    return () => {
+      handlers!.delete(handler);
+    };
+  }
+
+  /**
+   * Subscribes to every topic, e.g. to forward all events to an external sink
+   * @returns a function that removes the subscription
+   */
+  public subscribeAll(handler: AnyHandler): () => void {
+    this.anyHandlers.add(handler);
+    return () => {
+      this.anyHandlers.delete(handler);
+    };
+  }
+
+  private invoke(topic: BusTopic, fn: () => void) {
+    try {
+      fn();
+    } catch (err) {
+      this.logger.error({ err, topic }, "Event bus handler failed");
+    }
+  }
+}
@@ -0,0 +1,59 @@
+import fs from "fs";
+import os from "os";
+import path from "path";
+import { describe, expect, it, vi } from "vitest";
+import { FeatureFlagService } from "./feature-flag.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+describe("FeatureFlagService", () => {
+  it("uses defaults when nothing is configured", () => {
+    const flags = new FeatureFlagService(createLogger() as any);
+
+    expect(flags.isEnabled("liveViewAdaptiveQuality")).toBe(true);
+    expect(flags.list().every((flag) => flag.source === "default")).toBe(true);
+  });
+
+  it("lets the environment override the file, and runtime updates override both", () => {
+    const file = path.join(fs.mkdtempSync(path.join(os.tmpdir(), "flags-")), "flags.json");
+    fs.writeFileSync(
+      file,
+      JSON.stringify({ liveViewAdaptiveQuality: false, liveViewWindowActions: false }),
+    );
+
+    const flags = new FeatureFlagService(createLogger() as any, {
+      file,
+      env: "liveViewWindowActions=true",
+    });
+    expect(flags.isEnabled("liveViewAdaptiveQuality")).toBe(false);
+    expect(flags.isEnabled("liveViewWindowActions")).toBe(true);
+
+    flags.set("liveViewAdaptiveQuality", true);
+    expect(flags.list().find((flag) => flag.name === "liveViewAdaptiveQuality")).toMatchObject({
+      enabled: true,
+      source: "api",
+    });
+  });
+
+  it("ignores unknown flags", () => {
+    const logger = createLogger();
+    const flags = new FeatureFlagService(logger as any, { env: "notAFlag=true" });
+
+    expect(flags.list().some((flag) => (flag.name as string) === "notAFlag")).toBe(false);
+    expect(logger.warn).toHaveBeenCalled();
+  });
+});
@@ -0,0 +1,114 @@
+import fs from "fs";
+import { FastifyBaseLogger } from "fastify";
+
+/**
+ * Experimental subsystems that can ship dark and be toggled per deployment
+ */
+export const FEATURE_FLAGS = {
+  liveViewAdaptiveQuality: {
+    description: "Lower live view JPEG quality while a viewer's link cannot keep up",
+    defaultValue: true,
+  },
+  liveViewIdleThrottle: {
+    description: "Reduce the live view capture rate while the page is static",
+    defaultValue: true,
+  },
+  liveViewTypingFallback: {
+    description: "Type pasted text into pages that block paste events",
+    defaultValue: true,
+  },
+  liveViewWindowActions: {
+    description: "Allow live viewers to minimize, maximize and switch windows or dismiss dialogs",
+    defaultValue: true,
+  },
+} as const;
+
+export type FeatureFlag = keyof typeof FEATURE_FLAGS;
+
+export type FeatureFlagSource = "default" | "file" | "env" | "api";
+
+export interface FeatureFlagState {
+  name: FeatureFlag;
+  description: string;
+  enabled: boolean;
+  source: FeatureFlagSource;
+}
+
+export const isFeatureFlag = (name: string): name is FeatureFlag =>
+  Object.prototype.hasOwnProperty.call(FEATURE_FLAGS, name);
+
+/**
+ * Resolves feature flags from, in increasing precedence: defaults, a JSON file of
+ * `{ "flag": boolean }`, a `flag=true,other=false` environment variable, and runtime updates.
+ */
+export class FeatureFlagService {
+  private logger: FastifyBaseLogger;
+  private flags = new Map<FeatureFlag, { enabled: boolean; source: FeatureFlagSource }>();
+
+  constructor(logger: FastifyBaseLogger, config: { file?: string; env?: string } = {}) {
+    this.logger = logger.child({ component: "FeatureFlagService" });
+
+    for (const name of Object.keys(FEATURE_FLAGS) as FeatureFlag[]) {
+      this.flags.set(name, { enabled: FEATURE_FLAGS[name].defaultValue, source: "default" });
+    }
+
+    if (config.file) {
+      this.loadFile(config.file);
+    }
+    if (config.env) {
+      this.loadEnv(config.env);
+    }
+  }
+
+  public isEnabled(name: FeatureFlag): boolean {
+    return this.flags.get(name)?.enabled ?? false;
+  }
+
+  public set(name: FeatureFlag, enabled: boolean, source: FeatureFlagSource = "api"): void {
+    this.flags.set(name, { enabled, source });
+    this.logger.info(`Feature flag ${name} ${enabled ? "enabled" : "disabled"} (${source})`);
+  }
+
+  public list(): FeatureFlagState[] {
+    return Array.from(this.flags.entries()).map(([name, state]) => ({
+      name,
+      description: FEATURE_FLAGS[name].description,
+      ...state,
+    }));
+  }
+
+  private loadFile(file: string): void {
+    let values: Record<string, unknown>;
+    try {
+      values = JSON.parse(fs.readFileSync(file, "utf-8"));
+    } catch (err) {
+      this.logger.error({ err }, `Failed to read feature flags from ${file}`);
+      return;
+    }
+
+    for (const [name, enabled] of Object.entries(values)) {
+      if (typeof enabled === "boolean") {
+        this.apply(name, enabled, "file");
+      } else {
+        this.logger.warn(`Ignoring non-boolean value for feature flag ${name} in ${file}`);
+      }
+    }
+  }
+
+  private loadEnv(value: string): void {
+    for (const entry of value.split(",")) {
+      const [name, enabled = "true"] = entry.split("=").map((part) => part.trim());
+      if (name) {
+        this.apply(name, enabled === "true" || enabled === "1", "env");
+      }
+    }
+  }
+
+  private apply(name: string, enabled: boolean, source: FeatureFlagSource): void {
+    if (!isFeatureFlag(name)) {
+      this.logger.warn(`Ignoring unknown feature flag ${name}`);
+      return;
+    }
+    this.flags.set(name, { enabled, source });
+  }
+}
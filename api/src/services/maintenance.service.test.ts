@@ -0,0 +1,88 @@
+import { afterEach, beforeEach, describe, expect, it, vi } from "vitest";
+import { EventBus } from "./event-bus.service.js";
+import { MaintenanceService } from "./maintenance.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+describe("MaintenanceService", () => {
+  let bus: EventBus;
+  let maintenance: MaintenanceService;
+
+  beforeEach(() => {
+    vi.useFakeTimers();
+    vi.setSystemTime(new Date("2026-01-01T00:00:00Z"));
+    const logger = createLogger();
+    bus = new EventBus(logger as any);
+    maintenance = new MaintenanceService(logger as any, bus);
+  });
+
+  afterEach(() => {
+    vi.useRealTimers();
+  });
+
+  it("opens a window and announces it", () => {
+    const started = vi.fn();
+    bus.subscribe("maintenance.started", started);
+
+    const status = maintenance.start({ durationMs: 90_000, message: "Upgrading hosts" });
+
+    expect(status).toEqual({
+      active: true,
+      message: "Upgrading hosts",
+      startedAt: "2026-01-01T00:00:00.000Z",
+      until: "2026-01-01T00:01:30.000Z",
+    });
+    expect(maintenance.isActive()).toBe(true);
+    expect(maintenance.retryAfterSeconds()).toBe(90);
+    expect(started).toHaveBeenCalledWith({
+      message: "Upgrading hosts",
+      startedAt: "2026-01-01T00:00:00.000Z",
+      until: "2026-01-01T00:01:30.000Z",
+    });
+  });
+
+  it("ends on its own when the duration runs out", () => {
+    const ended = vi.fn();
+    bus.subscribe("maintenance.ended", ended);
+    maintenance.start({ durationMs: 1000 });
+
+    vi.advanceTimersByTime(999);
+    expect(maintenance.isActive()).toBe(true);
+    vi.advanceTimersByTime(1);
+    expect(maintenance.status()).toEqual({ active: false });
+    expect(ended).toHaveBeenCalledTimes(1);
+  });
+
+  it("can be ended early or extended", () => {
+    const ended = vi.fn();
+    bus.subscribe("maintenance.ended", ended);
+    maintenance.start({ durationMs: 1000 });
+    maintenance.start({ durationMs: 5000 });
+
+    vi.advanceTimersByTime(2000);
+    expect(maintenance.isActive()).toBe(true);
+    expect(maintenance.end()).toBe(true);
+    expect(maintenance.end()).toBe(false);
+    expect(ended).toHaveBeenCalledTimes(1);
+  });
+
+  it("rejects windows without an end", () => {
+    expect(() => maintenance.start({ durationMs: 0 })).toThrow();
+    expect(() => maintenance.start({ durationMs: 48 * 60 * 60 * 1000 })).toThrow();
+    expect(maintenance.isActive()).toBe(false);
+  });
+});
@@ -0,0 +1,104 @@
+import { FastifyBaseLogger } from "fastify";
+import { EventBus } from "./event-bus.service.js";
+
+/** Longest maintenance window, so a forgotten toggle cannot keep the server closed */
+export const MAX_MAINTENANCE_DURATION_MS = 24 * 60 * 60 * 1000;
+
+const DEFAULT_MESSAGE = "The server is undergoing maintenance";
+
+export interface MaintenanceStatus {
+  active: boolean;
+  message?: string;
+  startedAt?: string;
+  until?: string;
+}
+
+/**
+ * Time-boxed maintenance mode. While a window is open, new sessions are refused with a
+ * "maintenance" error and running sessions keep working. Every window ends on its own when its
+ * duration runs out; opening a new one replaces the current window. Changes are published on the
+ * bus as maintenance.started and maintenance.ended so viewers and webhooks can be told.
+ */
+export class MaintenanceService {
+  private logger: FastifyBaseLogger;
+  private window: { message: string; startedAt: number; until: number } | null = null;
+  private endTimer: NodeJS.Timeout | null = null;
+
+  constructor(
+    logger: FastifyBaseLogger,
+    private readonly eventBus: EventBus,
+  ) {
+    this.logger = logger.child({ component: "MaintenanceService" });
+  }
+
+  /**
+   * @throws if the duration is not positive or longer than MAX_MAINTENANCE_DURATION_MS
+   */
+  public start(
+    { durationMs, message }: { durationMs: number; message?: string },
+    now: number = Date.now(),
+  ): MaintenanceStatus {
+    if (!(durationMs > 0) || durationMs > MAX_MAINTENANCE_DURATION_MS) {
+      throw new Error(`Maintenance can last at most ${MAX_MAINTENANCE_DURATION_MS} ms`);
+    }
+
+    this.clearTimer();
+    this.window = { message: message || DEFAULT_MESSAGE, startedAt: now, until: now + durationMs };
+    this.endTimer = setTimeout(() => this.end(), durationMs);
+    this.endTimer.unref();
+
+    const status = this.status(now);
+    this.logger.info({ until: status.until }, "Maintenance started");
+    this.eventBus.publish("maintenance.started", {
+      message: status.message!,
+      startedAt: status.startedAt!,
+      until: status.until!,
+    });
+    return status;
+  }
+
+  /**
+   * @returns false if no maintenance window was open
+   */
+  public end(): boolean {
+    this.clearTimer();
+    if (!this.window) {
+      return false;
+    }
+
+    this.window = null;
+    this.logger.info("Maintenance ended");
+    this.eventBus.publish("maintenance.ended", { endedAt: new Date().toISOString() });
+    return true;
+  }
+
+  public isActive(now: number = Date.now()): boolean {
+    return !!this.window && this.window.until > now;
+  }
+
+  public status(now: number = Date.now()): MaintenanceStatus {
+    if (!this.window || !this.isActive(now)) {
+      return { active: false };
+    }
+    return {
+      active: true,
+      message: this.window.message,
+      startedAt: new Date(this.window.startedAt).toISOString(),
+      until: new Date(this.window.until).toISOString(),
+    };
+  }
+
+  /**
+   * Seconds until the window ends, for the Retry-After header of refused requests
+   */
+  public retryAfterSeconds(now: number = Date.now()): number {
+    return this.window ? Math.max(Math.ceil((this.window.until - now) / 1000), 1) : 0;
+  }
+
+  private clearTimer(): void {
+    if (this.endTimer) {
+      clearTimeout(this.endTimer);
+      this.endTimer = null;
+    }
+  }
+}
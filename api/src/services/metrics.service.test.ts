@@ -0,0 +1,48 @@
+import { describe, expect, it } from "vitest";
+import { Counter, Gauge, Histogram, MetricsService } from "./metrics.service.js";
+
+describe("MetricsService", () => {
+  it("renders counters and gauges with labels", () => {
+    const metrics = new MetricsService();
+    metrics.liveViewInputEvents.inc({ type: "mouseEvent" });
+    metrics.liveViewInputEvents.inc({ type: "mouseEvent" });
+    metrics.liveViewConnections.inc();
+
+    const output = metrics.render();
+    expect(output).toContain("# TYPE steel_live_view_input_events_total counter");
+    expect(output).toContain('steel_live_view_input_events_total{type="mouseEvent"} 2');
+    expect(output).toContain("steel_live_view_connections 1");
+  });
+
+  it("reads collected gauges at render time", () => {
+    const metrics = new MetricsService();
+    let viewers = 1;
+    metrics.register(new Gauge("test_viewers", "Viewers", () => viewers));
+
+    viewers = 3;
+    expect(metrics.render()).toContain("test_viewers 3");
+  });
+
+  it("renders cumulative histogram buckets", () => {
+    const histogram = new Histogram("test_duration_seconds", "Duration", [0.1, 1]);
+    histogram.observe(0.05, { type: "keyEvent" });
+    histogram.observe(0.5, { type: "keyEvent" });
+
+    expect(histogram.render()).toEqual([
+      'test_duration_seconds_bucket{type="keyEvent",le="0.1"} 1',
+      'test_duration_seconds_bucket{type="keyEvent",le="1"} 2',
+      'test_duration_seconds_bucket{type="keyEvent",le="+Inf"} 2',
+      'test_duration_seconds_sum{type="keyEvent"} 0.55',
+      'test_duration_seconds_count{type="keyEvent"} 2',
+    ]);
+  });
+
+  it("escapes label values and rejects duplicate metric names", () => {
+    const metrics = new MetricsService();
+    const counter = metrics.register(new Counter("test_total", "Test"));
+    counter.inc({ reason: 'a "quoted" value' });
+
+    expect(metrics.render()).toContain('test_total{reason="a \\"quoted\\" value"} 1');
+    expect(() => metrics.register(new Counter("test_total", "Test"))).toThrow();
+  });
+});
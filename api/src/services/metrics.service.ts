@@ -0,0 +1,200 @@
+type Labels = Record<string, string>;
+
+const DEFAULT_BUCKETS = [0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5];
+
+const escapeLabelValue = (value: string) =>
+  value.replace(/\\/g, "\\\\").replace(/"/g, '\\"').replace(/\n/g, "\\n");
+
+const labelKey = (labels: Labels) =>
+  Object.keys(labels)
+    .sort()
+    .map((name) => `${name}="${escapeLabelValue(labels[name])}"`)
+    .join(",");
+
+const formatSample = (name: string, key: string, value: number) =>
+  `${name}${key ? `{${key}}` : ""} ${Number.isFinite(value) ? value : value > 0 ? "+Inf" : "-Inf"}`;
+
+export interface Metric {
+  name: string;
+  help: string;
+  type: "counter" | "gauge" | "histogram";
+  render(): string[];
+}
+
+export class Counter implements Metric {
+  public readonly type = "counter";
+  private values = new Map<string, number>();
+
+  constructor(
+    public readonly name: string,
+    public readonly help: string,
+  ) {}
+
+  public inc(labels: Labels = {}, value: number = 1): void {
+    const key = labelKey(labels);
+    this.values.set(key, (this.values.get(key) ?? 0) + value);
+  }
+
+  public get(labels: Labels = {}): number {
+    return this.values.get(labelKey(labels)) ?? 0;
+  }
+
+  public render(): string[] {
+    return Array.from(this.values, ([key, value]) => formatSample(this.name, key, value));
+  }
+}
+
+export class Gauge implements Metric {
+  public readonly type = "gauge";
+  private values = new Map<string, number>();
+
+  /**
+   * @param collect optional callback that reads the current value at scrape time, for gauges that
+   * mirror state owned elsewhere
+   */
+  constructor(
+    public readonly name: string,
+    public readonly help: string,
+    private readonly collect?: () => number,
+  ) {}
+
+  public set(value: number, labels: Labels = {}): void {
+    this.values.set(labelKey(labels), value);
+  }
+
+  public inc(labels: Labels = {}, value: number = 1): void {
+    const key = labelKey(labels);
+    this.values.set(key, (this.values.get(key) ?? 0) + value);
+  }
+
+  public dec(labels: Labels = {}, value: number = 1): void {
+    this.inc(labels, -value);
+  }
+
+  public get(labels: Labels = {}): number {
+    return this.values.get(labelKey(labels)) ?? 0;
+  }
+
+  public render(): string[] {
+    if (this.collect) {
+      this.set(this.collect());
+    }
+    return Array.from(this.values, ([key, value]) => formatSample(this.name, key, value));
+  }
+}
+
+export class Histogram implements Metric {
+  public readonly type = "histogram";
+  private series = new Map<string, { counts: number[]; sum: number; count: number }>();
+
+  constructor(
+    public readonly name: string,
+    public readonly help: string,
+    private readonly buckets: number[] = DEFAULT_BUCKETS,
+  ) {}
+
+  public observe(value: number, labels: Labels = {}): void {
+    const key = labelKey(labels);
+    let series = this.series.get(key);
+    if (!series) {
+      series = { counts: this.buckets.map(() => 0), sum: 0, count: 0 };
+      this.series.set(key, series);
+    }
+
+    this.buckets.forEach((bound, index) => {
+      if (value <= bound) {
+        series!.counts[index]++;
+      }
+    });
+    series.sum += value;
+    series.count++;
+  }
+
+  /**
+   * Starts a timer, the returned function records the elapsed time in seconds
+   */
+  public startTimer(labels: Labels = {}): () => number {
+    const start = process.hrtime.bigint();
+    return () => {
+      const seconds = Number(process.hrtime.bigint() - start) / 1e9;
+      this.observe(seconds, labels);
+      return seconds;
+    };
+  }
+
+  public render(): string[] {
+    const lines: string[] = [];
+    for (const [key, series] of this.series) {
+      const prefix = key ? `${key},` : "";
+      this.buckets.forEach((bound, index) => {
+        lines.push(`${this.name}_bucket{${prefix}le="${bound}"} ${series.counts[index]}`);
+      });
+      lines.push(`${this.name}_bucket{${prefix}le="+Inf"} ${series.count}`);
+      lines.push(formatSample(`${this.name}_sum`, key, series.sum));
+      lines.push(formatSample(`${this.name}_count`, key, series.count));
+    }
+    return lines;
+  }
+}
+
+/**
+ * Registry of the API's runtime metrics, rendered in the Prometheus text exposition format.
+ */
+export class MetricsService {
+  private metrics = new Map<string, Metric>();
+
+  public readonly liveViewConnections = this.register(
+    new Gauge("steel_live_view_connections", "Open live view WebSocket connections"),
+  );
+  public readonly liveViewConnectionEvents = this.register(
+    new Counter(
+      "steel_live_view_connection_events_total",
+      "Live view connection state transitions by state",
+    ),
+  );
+  public readonly liveViewFramesSent = this.register(
+    new Counter("steel_live_view_frames_sent_total", "Screencast frames sent to live viewers"),
+  );
+  public readonly liveViewFrameBytes = this.register(
+    new Counter("steel_live_view_frame_bytes_total", "Bytes of screencast frame data sent"),
+  );
+  public readonly liveViewFramesDropped = this.register(
+    new Counter(
+      "steel_live_view_frames_dropped_total",
+      "Screencast frames captured but not sent to a viewer, by reason",
+    ),
+  );
+  public readonly liveViewInputEvents = this.register(
+    new Counter("steel_live_view_input_events_total", "Viewer input messages dispatched by type"),
+  );
+  public readonly liveViewInputDropped = this.register(
+    new Counter(
+      "steel_live_view_input_dropped_total",
+      "Viewer input dropped before reaching the browser, by reason",
+    ),
+  );
+  public readonly liveViewInputLatency = this.register(
+    new Histogram(
+      "steel_live_view_input_duration_seconds",
+      "Time taken to dispatch viewer input to the browser by type",
+    ),
+  );
+
+  public register<T extends Metric>(metric: T): T {
+    if (this.metrics.has(metric.name)) {
+      throw new Error(`Metric ${metric.name} is already registered`);
+    }
+    this.metrics.set(metric.name, metric);
+    return metric;
+  }
+
+  public render(): string {
+    const lines: string[] = [];
+    for (const metric of this.metrics.values()) {
+      lines.push(`# HELP ${metric.name} ${metric.help}`);
+      lines.push(`# TYPE ${metric.name} ${metric.type}`);
+      lines.push(...metric.render());
+    }
+    return `${lines.join("\n")}\n`;
+  }
+}
@@ -0,0 +1,45 @@
+import fs from "fs/promises";
+import { tmpdir } from "os";
+import path from "path";
+import { afterEach, beforeEach, describe, expect, it } from "vitest";
+import { ScratchService } from "./scratch.service.js";
+
+describe("ScratchService", () => {
+  let root: string;
+
+  beforeEach(async () => {
+    root = await fs.mkdtemp(path.join(tmpdir(), "scratch-test-"));
+  });
+
+  afterEach(async () => {
+    await fs.rm(root, { recursive: true, force: true });
+  });
+
+  it("creates a directory per session and removes it with its files", async () => {
+    const scratch = new ScratchService(root);
+    const dir = await scratch.directory("s1");
+    await fs.writeFile(path.join(dir, "upload"), "secret");
+
+    await expect(scratch.directory("s1")).resolves.toBe(dir);
+    expect((await fs.stat(dir)).mode & 0o777).toBe(0o700);
+
+    await scratch.release("s1");
+    await expect(fs.readdir(root)).resolves.toEqual([]);
+  });
+
+  it("sweeps stale directories of unknown sessions only", async () => {
+    const scratch = new ScratchService(root);
+    await scratch.directory("active");
+    await fs.mkdir(path.join(root, "steel-scratch-crashed"));
+    await fs.mkdir(path.join(root, "unrelated"));
+
+    await expect(scratch.sweep(60_000)).resolves.toBe(0);
+    await expect(scratch.sweep(60_000, Date.now() + 120_000)).resolves.toBe(1);
+    expect((await fs.readdir(root)).sort()).toEqual(["steel-scratch-active", "unrelated"]);
+  });
+
+  it("refuses session ids that are not a plain name", async () => {
+    const scratch = new ScratchService(root);
+    await expect(scratch.directory("../escape")).rejects.toThrow("Invalid session id");
+  });
+});
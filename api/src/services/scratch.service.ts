@@ -0,0 +1,75 @@
+import fs from "fs/promises";
+import { tmpdir } from "os";
+import path from "path";
+
+const SCRATCH_PREFIX = "steel-scratch-";
+
+/**
+ * Temporary files of a session, e.g. uploads waiting for a DLP decision, live in a directory of
+ * their own so that nothing the session handled outlives it. The session service removes the
+ * directory when the session ends, and sweep removes those a crashed process left behind.
+ */
+export class ScratchService {
+  private directories = new Map<string, Promise<string>>();
+
+  constructor(private readonly root: string = tmpdir()) {}
+
+  /**
+   * @returns the scratch directory of the session, created on first use and only readable by
+   * this user
+   */
+  public directory(sessionId: string): Promise<string> {
+    let directory = this.directories.get(sessionId);
+    if (!directory) {
+      directory = (async () => {
+        const dir = this.pathOf(sessionId);
+        await fs.mkdir(dir, { recursive: true, mode: 0o700 });
+        return dir;
+      })();
+      directory.catch(() => this.directories.delete(sessionId));
+      this.directories.set(sessionId, directory);
+    }
+    return directory;
+  }
+
+  /**
+   * Removes the scratch directory of a session with everything in it
+   */
+  public async release(sessionId: string): Promise<void> {
+    this.directories.delete(sessionId);
+    await fs.rm(this.pathOf(sessionId), { recursive: true, force: true });
+  }
+
+  /**
+   * Removes scratch directories of sessions this process does not know, once they have not been
+   * modified for maxAgeMs
+   * @returns how many directories were removed
+   */
+  public async sweep(maxAgeMs: number, now: number = Date.now()): Promise<number> {
+    const entries = await fs.readdir(this.root, { withFileTypes: true }).catch(() => []);
+    let removed = 0;
+    for (const entry of entries) {
+      if (!entry.isDirectory() || !entry.name.startsWith(SCRATCH_PREFIX)) {
+        continue;
+      }
+      if (this.directories.has(entry.name.slice(SCRATCH_PREFIX.length))) {
+        continue;
+      }
+
+      const dir = path.join(this.root, entry.name);
+      const stats = await fs.stat(dir).catch(() => null);
+      if (stats && now - stats.mtimeMs >= maxAgeMs) {
+        await fs.rm(dir, { recursive: true, force: true });
+        removed += 1;
+      }
+    }
+    return removed;
+  }
+
+  private pathOf(sessionId: string): string {
+    if (!/^[\w-]+$/.test(sessionId)) {
+      throw new Error(`Invalid session id for a scratch directory: ${sessionId}`);
+    }
+    return path.join(this.root, `${SCRATCH_PREFIX}${sessionId}`);
+  }
+}
@@ -0,0 +1,90 @@
+import { EventEmitter } from "events";
+import { describe, expect, it, vi } from "vitest";
+import { ScreencastService } from "./screencast.service.js";
+
+const createClient = () => {
+  const client = new EventEmitter() as EventEmitter & {
+    send: ReturnType<typeof vi.fn>;
+    detach: ReturnType<typeof vi.fn>;
+  };
+  client.send = vi.fn().mockResolvedValue({});
+  client.detach = vi.fn().mockResolvedValue(undefined);
+  return client;
+};
+
+const jpeg = { format: "jpeg" as const, quality: 75 };
+const size = { width: 1920, height: 1080 };
+
+const startCalls = (client: ReturnType<typeof createClient>) =>
+  client.send.mock.calls.filter(([method]) => method === "Page.startScreencast");
+
+describe("ScreencastService", () => {
+  it("captures a page once for all of its viewers", async () => {
+    const client = createClient();
+    const createClientFor = vi.fn(async () => client as any);
+    const service = new ScreencastService(createClientFor);
+    const first = { onFrame: vi.fn() };
+    const second = { onFrame: vi.fn() };
+
+    await service.subscribe("page", jpeg, size, first, 75);
+    await service.subscribe("page", jpeg, size, second, 75);
+    client.emit("Page.screencastFrame", { data: "frame", sessionId: 1 });
+    await vi.waitFor(() => expect(second.onFrame).toHaveBeenCalled());
+
+    expect(createClientFor).toHaveBeenCalledTimes(1);
+    expect(startCalls(client)).toHaveLength(1);
+    expect(client.send).toHaveBeenCalledWith("Page.screencastFrameAck", { sessionId: 1 });
+    expect(first.onFrame).toHaveBeenCalledWith("frame", true);
+    expect(second.onFrame).toHaveBeenCalledWith("frame", true);
+    expect(service.active).toBe(1);
+  });
+
+  it("captures at the highest quality any viewer wants", async () => {
+    const client = createClient();
+    const service = new ScreencastService(async () => client as any);
+
+    await service.subscribe("page", jpeg, size, { onFrame: vi.fn() }, 45);
+    const sharp = await service.subscribe("page", jpeg, size, { onFrame: vi.fn() }, 75);
+    await sharp.setQuality(30);
+
+    expect(startCalls(client).map(([, params]) => params.quality)).toEqual([45, 75, 45]);
+  });
+
+  it("stops the screencast once its last viewer leaves", async () => {
+    const clients = [createClient(), createClient()];
+    const service = new ScreencastService(async () => clients.shift() as any);
+    const [client] = clients;
+
+    const first = await service.subscribe("page", jpeg, size, { onFrame: vi.fn() }, 75);
+    const second = await service.subscribe("page", jpeg, size, { onFrame: vi.fn() }, 75);
+    await first.unsubscribe();
+    expect(client.send).not.toHaveBeenCalledWith("Page.stopScreencast");
+
+    await second.unsubscribe();
+    expect(client.send).toHaveBeenCalledWith("Page.stopScreencast");
+    expect(client.detach).toHaveBeenCalled();
+    expect(service.active).toBe(0);
+
+    // A new viewer starts a screencast of its own
+    await service.subscribe("page", jpeg, size, { onFrame: vi.fn() }, 75);
+    expect(clients).toHaveLength(0);
+  });
+
+  it("resizes the stream once by as much as the viewport changed", async () => {
+    const client = createClient();
+    const service = new ScreencastService(async () => client as any);
+    const onResize = vi.fn();
+    const first = await service.subscribe("page", jpeg, size, { onFrame: vi.fn(), onResize }, 75);
+    const second = await service.subscribe("page", jpeg, size, { onFrame: vi.fn() }, 75);
+
+    // The first viewport read is what the stream was started for
+    await first.fitViewport({ width: 1905, height: 1080 });
+    await first.fitViewport({ width: 1265, height: 720 });
+    await second.fitViewport({ width: 1265, height: 720 });
+
+    expect(onResize).toHaveBeenCalledTimes(1);
+    expect(onResize).toHaveBeenCalledWith({ width: 1280, height: 720 });
+    expect(startCalls(client)).toHaveLength(2);
+    expect(startCalls(client)[1][1]).toMatchObject({ maxWidth: 1280, maxHeight: 720 });
+  });
+});
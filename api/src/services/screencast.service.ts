@@ -0,0 +1,232 @@
+import { CDPSession } from "puppeteer-core";
+import { ScreencastSettings } from "../types/casting.js";
+import { IdleFrameThrottle } from "../utils/casting.js";
+
+type Size = { width: number; height: number };
+
+export interface ScreencastSubscriber {
+  /** Receives every captured frame, along with whether it differs from the previous one */
+  onFrame: (data: string, changed: boolean) => void;
+  /** Told the new frame size before the screencast switches to it */
+  onResize?: (size: Size) => void;
+}
+
+export interface ScreencastSubscription {
+  /**
+   * Sets the JPEG quality this subscriber wants. The screencast runs at the highest quality any of
+   * its subscribers wants.
+   */
+  setQuality: (quality: number | undefined) => Promise<void>;
+  /** Resizes the stream after the page's viewport changed */
+  fitViewport: (viewport: Size) => Promise<void>;
+  /** Stops throttling the capture of a static page, e.g. on viewer input */
+  wake: () => void;
+  unsubscribe: () => Promise<void>;
+}
+
+/**
+ * One screencast of a page, whose frames go to every subscriber. Each subscriber decides which
+ * frames it forwards, e.g. to stay within the bandwidth of its viewer, but the page is captured
+ * only once however many viewers watch it.
+ */
+export class ScreencastHub {
+  private readonly subscribers = new Map<ScreencastSubscriber, number | undefined>();
+  private readonly throttle = new IdleFrameThrottle();
+  private readonly size: Size;
+  // Viewport the stream was last sized for, unknown until a subscriber reads it
+  private viewport: Size | null = null;
+  private quality: number | undefined;
+  private started = false;
+  private stopped = false;
+
+  constructor(
+    private readonly client: CDPSession,
+    private readonly settings: ScreencastSettings,
+    size: Size,
+    private readonly isIdleThrottled: () => boolean,
+  ) {
+    this.size = { ...size };
+    client.on("Page.screencastFrame", ({ data, sessionId }) => {
+      this.handleFrame(data, sessionId).catch((err) => {
+        console.error("Error in Page.screencastFrame handler:", err);
+      });
+    });
+  }
+
+  public get subscriberCount(): number {
+    return this.subscribers.size;
+  }
+
+  public get isStopped(): boolean {
+    return this.stopped;
+  }
+
+  public async subscribe(subscriber: ScreencastSubscriber, quality?: number): Promise<void> {
+    this.subscribers.set(subscriber, quality);
+    await this.applyQuality();
+  }
+
+  /**
+   * @returns whether the subscriber was the last one, after which the screencast is stopped
+   */
+  public unsubscribe(subscriber: ScreencastSubscriber): boolean {
+    this.subscribers.delete(subscriber);
+    if (this.subscribers.size > 0 || this.stopped) {
+      return false;
+    }
+    this.stopped = true;
+    this.throttle.wake();
+    return true;
+  }
+
+  public async setQuality(subscriber: ScreencastSubscriber, quality?: number): Promise<void> {
+    if (!this.subscribers.has(subscriber)) {
+      return;
+    }
+    this.subscribers.set(subscriber, quality);
+    await this.applyQuality();
+  }
+
+  /**
+   * The viewport leaves out scrollbars, so the stream grows or shrinks by as much as the viewport
+   * did rather than taking its size. Every subscriber reports the same viewport, only the first
+   * report of a change resizes the stream.
+   */
+  public async fitViewport(viewport: Size): Promise<void> {
+    const previous = this.viewport;
+    this.viewport = { ...viewport };
+    if (!previous || (previous.width === viewport.width && previous.height === viewport.height)) {
+      return;
+    }
+
+    this.size.width = Math.max(this.size.width + viewport.width - previous.width, 1);
+    this.size.height = Math.max(this.size.height + viewport.height - previous.height, 1);
+    for (const subscriber of this.subscribers.keys()) {
+      subscriber.onResize?.({ ...this.size });
+    }
+    await this.start();
+  }
+
+  public wake(): void {
+    this.throttle.wake();
+  }
+
+  public async stop(): Promise<void> {
+    await this.client.send("Page.stopScreencast").catch(() => {});
+    await this.client.detach().catch(() => {});
+  }
+
+  // Adaptive quality of a subscriber moves below the quality of its stream preset, never above it
+  private async applyQuality(): Promise<void> {
+    const quality =
+      this.settings.format === "jpeg"
+        ? Math.max(...[...this.subscribers.values()].map((wanted) => wanted ?? 100))
+        : undefined;
+    if (this.started && quality === this.quality) {
+      return;
+    }
+    this.quality = quality;
+    await this.start();
+  }
+
+  // Restarting the screencast is how its quality or size changes, Chrome keeps the stream
+  private async start(): Promise<void> {
+    if (this.stopped) {
+      return;
+    }
+    this.started = true;
+    this.throttle.wake();
+    await this.client.send("Page.startScreencast", {
+      format: this.settings.format,
+      ...(this.quality !== undefined ? { quality: this.quality } : {}),
+      maxWidth: this.size.width,
+      maxHeight: this.size.height,
+    });
+  }
+
+  private async handleFrame(data: string, sessionId: number): Promise<void> {
+    const changed = this.throttle.observe(data);
+
+    // Acknowledge the frame to free up memory; while the page is static the ack is delayed, which
+    // throttles how often Chrome captures new frames
+    if (this.isIdleThrottled()) {
+      await this.throttle.wait();
+    }
+    await this.client.send("Page.screencastFrameAck", { sessionId });
+
+    for (const subscriber of this.subscribers.keys()) {
+      subscriber.onFrame(data, changed);
+    }
+  }
+}
+
+/**
+ * Shares screencasts between live view connections, one per page and format
+ */
+export class ScreencastService {
+  private readonly hubs = new Map<string, Promise<ScreencastHub>>();
+
+  constructor(
+    private readonly createClient: (pageId: string) => Promise<CDPSession>,
+    private readonly isIdleThrottled: () => boolean = () => false,
+  ) {}
+
+  /** Number of screencasts running */
+  public get active(): number {
+    return this.hubs.size;
+  }
+
+  /**
+   * Subscribes to the screencast of a page, starting it if nobody watches the page yet
+   * @param size largest frame size, only used when the screencast is started
+   */
+  public async subscribe(
+    pageId: string,
+    settings: ScreencastSettings,
+    size: Size,
+    subscriber: ScreencastSubscriber,
+    quality?: number,
+  ): Promise<ScreencastSubscription> {
+    const key = `${pageId}:${settings.format}`;
+    const pending =
+      this.hubs.get(key) ??
+      this.createClient(pageId).then(
+        (client) => new ScreencastHub(client, settings, size, this.isIdleThrottled),
+      );
+    this.hubs.set(key, pending);
+
+    const hub = await pending.catch((err) => {
+      if (this.hubs.get(key) === pending) {
+        this.hubs.delete(key);
+      }
+      throw err;
+    });
+    // The last subscriber left while this one was waiting for the screencast
+    if (hub.isStopped) {
+      return this.subscribe(pageId, settings, size, subscriber, quality);
+    }
+
+    const unsubscribe = async () => {
+      if (!hub.unsubscribe(subscriber)) {
+        return;
+      }
+      if (this.hubs.get(key) === pending) {
+        this.hubs.delete(key);
+      }
+      await hub.stop();
+    };
+    try {
+      await hub.subscribe(subscriber, quality);
+    } catch (err) {
+      await unsubscribe();
+      throw err;
+    }
+
+    return {
+      setQuality: (quality) => hub.setQuality(subscriber, quality),
+      fitViewport: (viewport) => hub.fitViewport(viewport),
+      wake: () => hub.wake(),
+      unsubscribe,
+    };
+  }
+}
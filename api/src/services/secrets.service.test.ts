@@ -0,0 +1,47 @@
+import { describe, expect, it } from "vitest";
+import { MAX_SECRETS, SecretsService } from "./secrets.service.js";
+
+describe("SecretsService", () => {
+  it("stores secrets by name and lists them without their values", () => {
+    const secrets = new SecretsService();
+    secrets.set("login.password", "hunter2", 1000);
+    secrets.set("otp", "123456", 2000);
+
+    expect(secrets.get("login.password")).toBe("hunter2");
+    expect(secrets.get("missing")).toBeNull();
+    expect(secrets.list()).toEqual([
+      { name: "login.password", updatedAt: 1000 },
+      { name: "otp", updatedAt: 2000 },
+    ]);
+  });
+
+  it("rejects invalid names and values", () => {
+    const secrets = new SecretsService();
+
+    expect(() => secrets.set("has space", "value")).toThrow("Secret names");
+    expect(() => secrets.set("empty", "")).toThrow("Secret values");
+    expect(() => secrets.set("long", "x".repeat(4097))).toThrow("Secret values");
+  });
+
+  it("limits the number of secrets but allows replacing one", () => {
+    const secrets = new SecretsService();
+    for (let i = 0; i < MAX_SECRETS; i++) {
+      secrets.set(`secret${i}`, "value");
+    }
+
+    expect(() => secrets.set("one-more", "value")).toThrow("at most");
+    secrets.set("secret0", "new value");
+    expect(secrets.get("secret0")).toBe("new value");
+  });
+
+  it("deletes and clears secrets", () => {
+    const secrets = new SecretsService();
+    secrets.set("a", "1");
+    secrets.set("b", "2");
+
+    expect(secrets.delete("a")).toBe(true);
+    expect(secrets.delete("a")).toBe(false);
+    secrets.clear();
+    expect(secrets.list()).toEqual([]);
+  });
+});
@@ -0,0 +1,52 @@
+const SECRET_NAME_PATTERN = /^[A-Za-z0-9_.-]{1,64}$/;
+export const MAX_SECRET_LENGTH = 4096;
+export const MAX_SECRETS = 32;
+
+export interface SecretInfo {
+  name: string;
+  updatedAt: number;
+}
+
+/**
+ * Secrets staged for the active session, e.g. a password an orchestrator wants typed into a login
+ * form. Values can be injected into the page by name but are never returned by the API, sent to
+ * viewers or logged. The session service clears them whenever the session changes.
+ */
+export class SecretsService {
+  private secrets = new Map<string, { value: string; updatedAt: number }>();
+
+  /**
+   * @throws if the name or value is invalid, or the session already holds MAX_SECRETS secrets
+   */
+  public set(name: string, value: string, now: number = Date.now()): void {
+    if (!SECRET_NAME_PATTERN.test(name)) {
+      throw new Error("Secret names must be 1 to 64 letters, digits, dots, dashes or underscores");
+    }
+    if (!value || value.length > MAX_SECRET_LENGTH) {
+      throw new Error(`Secret values must be 1 to ${MAX_SECRET_LENGTH} characters`);
+    }
+    if (!this.secrets.has(name) && this.secrets.size >= MAX_SECRETS) {
+      throw new Error(`A session can hold at most ${MAX_SECRETS} secrets`);
+    }
+    this.secrets.set(name, { value, updatedAt: now });
+  }
+
+  public get(name: string): string | null {
+    return this.secrets.get(name)?.value ?? null;
+  }
+
+  /**
+   * @returns false if there was no secret with the name
+   */
+  public delete(name: string): boolean {
+    return this.secrets.delete(name);
+  }
+
+  public list(): SecretInfo[] {
+    return Array.from(this.secrets, ([name, { updatedAt }]) => ({ name, updatedAt }));
+  }
+
+  public clear(): void {
+    this.secrets.clear();
+  }
+}
@@ -5,6 +5,9 @@ import path, { dirname } from "path";
 import { FastifyBaseLogger } from "fastify";
 import { fileURLToPath } from "url";
 
+const STARTUP_TIMEOUT_MS = 15000;
+const SHUTDOWN_GRACE_MS = 5000;
+
 export class SeleniumService extends EventEmitter {
   private seleniumProcess: ChildProcess | null = null;
   private seleniumServerUrl: string = "http://localhost:4444";
@@ -41,7 +44,8 @@ export class SeleniumService extends EventEmitter {
 
     const seleniumArgs = ["-jar", seleniumServerPath, "standalone"];
 
-    this.seleniumProcess = spawn("java", seleniumArgs);
+    // Run in its own process group so the drivers and browsers it starts are stopped with it
+    this.seleniumProcess = spawn("java", seleniumArgs, { detached: true });
     this.seleniumServerUrl = `http://localhost:${this.port}`;
 
     this.seleniumProcess.stdout?.on("data", (data) => {
@@ -69,8 +73,9 @@ export class SeleniumService extends EventEmitter {
 
     await new Promise<void>((resolve, reject) => {
       const timeout = setTimeout(() => {
+        this.close();
         reject(new Error("Selenium server failed to start within the timeout period"));
-      }, 15000); // 15 seconds timeout
+      }, STARTUP_TIMEOUT_MS);
 
       this.seleniumProcess!.stdout?.on("data", (data) => {
         if (data.toString().includes("Started Selenium Standalone")) {
@@ -82,9 +87,33 @@ export class SeleniumService extends EventEmitter {
   }
 
   public close(): void {
-    if (this.seleniumProcess) {
-      this.seleniumProcess.kill("SIGINT");
-      this.seleniumProcess = null;
+    const seleniumProcess = this.seleniumProcess;
+    if (!seleniumProcess) {
+      return;
+    }
+    this.seleniumProcess = null;
+
+    this.killProcessGroup(seleniumProcess, "SIGINT");
+    // A hung server would otherwise keep its drivers and browsers alive
+    const forceKill = setTimeout(() => {
+      this.logger.warn("Selenium did not exit after SIGINT, killing its process group");
+      this.killProcessGroup(seleniumProcess, "SIGKILL");
+    }, SHUTDOWN_GRACE_MS);
+    // Not cleared when the server exits: drivers and browsers it spawned can outlive it
+    forceKill.unref();
+  }
+
+  private killProcessGroup(child: ChildProcess, signal: NodeJS.Signals) {
+    if (child.pid === undefined) {
+      return;
+    }
+    try {
+      process.kill(-child.pid, signal);
+    } catch (error) {
+      // ESRCH means every process in the group has already exited
+      if ((error as NodeJS.ErrnoException).code !== "ESRCH") {
+        this.logger.warn(`Failed to send ${signal} to the Selenium process group: ${error}`);
+      }
     }
   }
 
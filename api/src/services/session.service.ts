@@ -13,19 +13,27 @@ import {
   OptimizeBandwidthOptions,
 } from "../types/index.js";
 import { IProxyServer, ProxyServer } from "../utils/proxy.js";
+import { SessionStreamPreset } from "../utils/stream-quality.js";
 import { getBaseUrl, getUrl } from "../utils/url.js";
 import { CDPService } from "./cdp/cdp.service.js";
 import { ShutdownReason } from "./cdp/plugins/core/base-plugin.js";
 import { CookieData } from "./context/types.js";
+import { EventBus } from "./event-bus.service.js";
+import { ScratchService } from "./scratch.service.js";
+import { SecretsService } from "./secrets.service.js";
 import { FileService } from "./file.service.js";
 import { SeleniumService } from "./selenium.service.js";
 import { TimezoneFetcher } from "./timezone-fetcher.service.js";
 import { deepMerge } from "../utils/context.js";
+import { EmitEvent } from "../types/enums.js";
 
 type Session = SessionDetails & {
   completion: Promise<void>;
   complete: (value: void) => void;
   proxyServer: IProxyServer | undefined;
+  /** consentedBy is the viewer that acknowledged recording */
+  recording: { started: boolean; consented: boolean; consentedBy: string | null };
+  paused: boolean;
 };
 
 const sessionStats = {
@@ -60,19 +68,26 @@ export class SessionService {
   private cdpService: CDPService;
   private seleniumService: SeleniumService;
   private fileService: FileService;
+  private eventBus?: EventBus;
   private timezoneFetcher: TimezoneFetcher;
   public proxyFactory: ProxyFactory = (proxyUrl) => new ProxyServer(proxyUrl);
 
   public pastSessions: Session[] = [];
   public activeSession: Session;
+  /** Secrets staged for the active session, cleared when it changes */
+  public readonly secrets = new SecretsService();
+  /** Temporary files of each session, removed when it ends */
+  public readonly scratch = new ScratchService(env.SCRATCH_DIR);
 
   constructor(config: {
     cdpService: CDPService;
     seleniumService: SeleniumService;
     fileService: FileService;
     logger: FastifyBaseLogger;
+    eventBus?: EventBus;
   }) {
     this.cdpService = config.cdpService;
+    this.eventBus = config.eventBus;
     this.seleniumService = config.seleniumService;
     this.fileService = config.fileService;
     this.logger = config.logger;
@@ -87,6 +102,8 @@ export class SessionService {
       completion: Promise.resolve(),
       complete: () => {},
       proxyServer: undefined,
+      recording: { started: false, consented: false, consentedBy: null },
+      paused: false,
     };
   }
 
@@ -117,6 +134,9 @@ export class SessionService {
     headless?: boolean;
     dangerouslyLogRequestDetails?: boolean;
     caCertificates?: string[];
+    screenContent?: boolean;
+    streamPreset?: SessionStreamPreset;
+    clipboardSync?: boolean;
   }): Promise<SessionDetails> {
     const {
       sessionId,
@@ -139,6 +159,9 @@ export class SessionService {
       headless,
       dangerouslyLogRequestDetails,
       caCertificates,
+      screenContent,
+      streamPreset,
+      clipboardSync,
     } = options;
 
     // start fetching timezone as early as possible
@@ -173,6 +196,9 @@ export class SessionService {
       dimensions: finalDimensions,
       isSelenium,
       deviceConfig,
+      screenContent,
+      streamPreset,
+      clipboardSync,
     });
 
     const userDataDir =
@@ -252,6 +278,7 @@ export class SessionService {
         deviceConfig,
       });
 
+      this.eventBus?.publish("session.started", { sessionId: this.activeSession.id });
       return this.activeSession;
     } else {
       await this.cdpService.startNewSession(browserLauncherOptions);
@@ -269,6 +296,7 @@ export class SessionService {
       });
     }
 
+    this.eventBus?.publish("session.started", { sessionId: this.activeSession.id });
     return this.activeSession;
   }
 
@@ -303,7 +331,10 @@ export class SessionService {
   }
 
   private async resetSessionInfo(overrides?: Partial<SessionDetails>): Promise<SessionDetails> {
+    const previousSession = this.activeSession;
     this.activeSession.complete();
+    this.secrets.clear();
+    await this.cleanUpScratch(this.activeSession.id);
 
     await this.activeSession.proxyServer?.close(true);
     this.activeSession.proxyServer = undefined;
@@ -319,11 +350,110 @@ export class SessionService {
       completion: promise,
       complete: resolve,
       proxyServer: undefined,
+      recording: { started: false, consented: false, consentedBy: null },
+      paused: false,
     };
 
+    // Idle sessions were never handed out, so there is nothing of theirs to clean up
+    if (previousSession.status !== "idle") {
+      this.eventBus?.publish("session.ended", { sessionId: previousSession.id });
+    }
     return this.activeSession;
   }
 
+  /**
+   * Removes the temporary files of a session that ended, and those of sessions a previous
+   * process did not get to clean up
+   */
+  public async cleanUpScratch(endedSessionId?: string): Promise<void> {
+    try {
+      if (endedSessionId) {
+        await this.scratch.release(endedSessionId);
+      }
+      const removed = await this.scratch.sweep(env.SCRATCH_MAX_AGE_MS);
+      if (removed > 0) {
+        this.logger.info({ removed }, "Removed stale session scratch directories");
+      }
+    } catch (err) {
+      this.logger.error({ err, sessionId: endedSessionId }, "Failed to clean up scratch files");
+    }
+  }
+
+  /**
+   * Whether recorded events may be stored for the active session.
+   * With RECORDING_REQUIRE_CONSENT enabled, a viewer has to acknowledge recording first.
+   */
+  public isRecordingAllowed(): boolean {
+    return !env.RECORDING_REQUIRE_CONSENT || this.activeSession.recording.consented;
+  }
+
+  /**
+   * Records that a viewer allowed recording of the active session, for the whole session
+   */
+  public acknowledgeRecording(viewerId: string): void {
+    const { recording } = this.activeSession;
+    if (recording.consented) {
+      return;
+    }
+    recording.consented = true;
+    recording.consentedBy = viewerId;
+    this.logger.info(
+      { audit: "recording_consent", sessionId: this.activeSession.id, viewerId },
+      "Viewer consented to recording",
+    );
+  }
+
+  /**
+   * Marks recording as started and notifies viewers the first time it happens in a session
+   */
+  public markRecordingStarted(): void {
+    if (this.activeSession.recording.started) {
+      return;
+    }
+    this.activeSession.recording.started = true;
+    this.cdpService.emit(EmitEvent.RecordingStarted, { sessionId: this.activeSession.id });
+    this.eventBus?.publish("session.recordingStarted", { sessionId: this.activeSession.id });
+  }
+
+  public isPaused(): boolean {
+    return this.activeSession.paused;
+  }
+
+  /**
+   * Pauses the session for live viewers: frames, viewer input and recorded events are dropped
+   * until the session is resumed, while viewer connections stay open.
+   */
+  public pause(): void {
+    if (this.activeSession.paused) {
+      return;
+    }
+    this.activeSession.paused = true;
+    this.logger.info(`Session ${this.activeSession.id} paused`);
+    this.eventBus?.publish("session.paused", { sessionId: this.activeSession.id });
+  }
+
+  public resume(): void {
+    if (!this.activeSession.paused) {
+      return;
+    }
+    this.activeSession.paused = false;
+    this.logger.info(`Session ${this.activeSession.id} resumed`);
+    this.eventBus?.publish("session.resumed", { sessionId: this.activeSession.id });
+  }
+
+  /**
+   * Changes the viewport size of the active session by resizing the browser's windows. Live view
+   * connections also apply it to their pages and resize their streams, and connections opened
+   * later start at the new size.
+   * @throws if the browser could not be resized
+   */
+  public async resize(width: number, height: number): Promise<void> {
+    await this.cdpService.resizeWindows(width, height);
+    this.activeSession.dimensions = { width, height };
+    this.logger.info(`Session ${this.activeSession.id} resized to ${width}x${height}`);
+    this.eventBus?.publish("session.resized", { sessionId: this.activeSession.id, width, height });
+  }
+
   public setProxyFactory(factory: ProxyFactory) {
     this.proxyFactory = factory;
   }
@@ -0,0 +1,82 @@
+import { afterEach, describe, expect, it, vi } from "vitest";
+import { EventBus } from "./event-bus.service.js";
+import { ThumbnailService } from "./thumbnail.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+const image = Buffer.from("jpeg");
+
+describe("ThumbnailService", () => {
+  afterEach(() => {
+    vi.useRealTimers();
+  });
+
+  it("keeps the latest thumbnail of the session and publishes it", async () => {
+    const bus = new EventBus(createLogger() as any);
+    const published = vi.fn();
+    bus.subscribe("session.thumbnail", published);
+    const source = vi.fn().mockResolvedValue({ sessionId: "s1", pageId: "p1", data: image });
+    const thumbnails = new ThumbnailService(source, createLogger() as any, bus);
+
+    await thumbnails.capture(() => 1000);
+
+    expect(thumbnails.latest("s1")).toEqual({
+      sessionId: "s1",
+      pageId: "p1",
+      data: image,
+      capturedAt: 1000,
+    });
+    expect(thumbnails.latest("s2")).toBeNull();
+    expect(published).toHaveBeenCalledWith({
+      sessionId: "s1",
+      pageId: "p1",
+      capturedAt: new Date(1000).toISOString(),
+      data: image.toString("base64"),
+    });
+  });
+
+  it("keeps the previous thumbnail when there is nothing to capture", async () => {
+    const source = vi
+      .fn()
+      .mockResolvedValueOnce({ sessionId: "s1", pageId: "p1", data: image })
+      .mockResolvedValueOnce(null);
+    const thumbnails = new ThumbnailService(source, createLogger() as any);
+
+    await thumbnails.capture();
+    await expect(thumbnails.capture()).resolves.toBeNull();
+    expect(thumbnails.latest("s1")?.data).toBe(image);
+  });
+
+  it("captures on the interval, skipping while a capture is still running", async () => {
+    vi.useFakeTimers();
+    let resolve: (value: null) => void = () => {};
+    const source = vi.fn(() => new Promise<null>((r) => (resolve = r)));
+    const thumbnails = new ThumbnailService(source, createLogger() as any);
+
+    thumbnails.start(1000);
+    await vi.advanceTimersByTimeAsync(2500);
+    expect(source).toHaveBeenCalledTimes(1);
+
+    resolve(null);
+    await vi.advanceTimersByTimeAsync(1000);
+    expect(source).toHaveBeenCalledTimes(2);
+
+    thumbnails.stop();
+    await vi.advanceTimersByTimeAsync(5000);
+    expect(source).toHaveBeenCalledTimes(2);
+  });
+});
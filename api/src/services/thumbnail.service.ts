@@ -0,0 +1,87 @@
+import { FastifyBaseLogger } from "fastify";
+import { EventBus } from "./event-bus.service.js";
+
+export interface Thumbnail {
+  sessionId: string;
+  pageId: string;
+  /** JPEG image */
+  data: Buffer;
+  capturedAt: number;
+}
+
+/**
+ * Captures a thumbnail of the active session, or null when there is nothing to capture
+ */
+export type ThumbnailSource = () => Promise<Omit<Thumbnail, "capturedAt"> | null>;
+
+/**
+ * Keeps a small, recent image of the active session, so session lists can show live previews
+ * without a live view connection per session. Captures run on an interval, the latest one is
+ * kept and each is published as session.thumbnail.
+ */
+export class ThumbnailService {
+  private logger: FastifyBaseLogger;
+  private latestThumbnail: Thumbnail | null = null;
+  private timer: NodeJS.Timeout | null = null;
+  private capturing = false;
+
+  constructor(
+    private readonly source: ThumbnailSource,
+    logger: FastifyBaseLogger,
+    private readonly eventBus?: EventBus,
+  ) {
+    this.logger = logger.child({ component: "ThumbnailService" });
+  }
+
+  public start(intervalMs: number): void {
+    this.stop();
+    this.timer = setInterval(() => {
+      this.capture().catch(() => {});
+    }, intervalMs);
+    this.timer.unref();
+  }
+
+  public stop(): void {
+    if (this.timer) {
+      clearInterval(this.timer);
+      this.timer = null;
+    }
+  }
+
+  /**
+   * @returns the latest thumbnail of a session, null if none was captured since it started
+   */
+  public latest(sessionId: string): Thumbnail | null {
+    return this.latestThumbnail?.sessionId === sessionId ? this.latestThumbnail : null;
+  }
+
+  /**
+   * Captures a thumbnail now, unless a capture is still running
+   */
+  public async capture(now: () => number = Date.now): Promise<Thumbnail | null> {
+    if (this.capturing) {
+      return null;
+    }
+    this.capturing = true;
+    try {
+      const captured = await this.source();
+      if (!captured) {
+        return null;
+      }
+      const thumbnail = { ...captured, capturedAt: now() };
+      this.latestThumbnail = thumbnail;
+      this.eventBus?.publish("session.thumbnail", {
+        sessionId: thumbnail.sessionId,
+        pageId: thumbnail.pageId,
+        capturedAt: new Date(thumbnail.capturedAt).toISOString(),
+        data: thumbnail.data.toString("base64"),
+      });
+      return thumbnail;
+    } catch (err) {
+      this.logger.warn({ err }, "Failed to capture a session thumbnail");
+      throw err;
+    } finally {
+      this.capturing = false;
+    }
+  }
+}
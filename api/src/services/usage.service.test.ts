@@ -0,0 +1,127 @@
+import fs from "fs/promises";
+import { tmpdir } from "os";
+import path from "path";
+import { afterEach, beforeEach, describe, expect, it, vi } from "vitest";
+import { EventBus } from "./event-bus.service.js";
+import { formatUsageCsv, UsageService } from "./usage.service.js";
+
+const connected = { connectionId: "c1", viewerId: "v1", sessionId: "s1", pageId: "p1" };
+const at = (iso: string) => Date.parse(iso);
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+describe("UsageService", () => {
+  afterEach(() => {
+    vi.useRealTimers();
+  });
+
+  it("rolls bus events up into the day they happened", () => {
+    vi.useFakeTimers({ now: at("2026-03-01T10:00:00Z") });
+    const bus = new EventBus(createLogger() as any);
+    const usage = new UsageService();
+    usage.attach(bus);
+
+    bus.publish("session.started", { sessionId: "s1" });
+    bus.publish("session.recordingStarted", { sessionId: "s1" });
+    bus.publish("media.frameSent", { connectionId: "c1", bytes: 1000 });
+    bus.publish("media.frameSent", { connectionId: "c1", bytes: 500 });
+    bus.publish("input.dispatched", {
+      connectionId: "c1",
+      viewerId: "v1",
+      type: "mouseEvent",
+      durationSeconds: 0.01,
+      receivedAt: Date.now(),
+    });
+
+    expect(usage.summary()).toEqual([
+      {
+        date: "2026-03-01",
+        sessions: 1,
+        viewerConnections: 0,
+        viewerMinutes: 0,
+        frameBytes: 1500,
+        recordings: 1,
+        inputEvents: 1,
+      },
+    ]);
+  });
+
+  it("splits viewer minutes across midnight and counts open connections up to now", () => {
+    const usage = new UsageService();
+    usage.recordConnected(connected, at("2026-03-01T23:50:00Z"));
+    usage.recordDisconnected(connected, at("2026-03-02T00:20:00Z"));
+    usage.recordConnected({ ...connected, connectionId: "c2" }, at("2026-03-02T01:00:00Z"));
+
+    expect(usage.summary(undefined, undefined, at("2026-03-02T01:05:00Z"))).toMatchObject([
+      { date: "2026-03-01", viewerConnections: 1, viewerMinutes: 10 },
+      { date: "2026-03-02", viewerConnections: 1, viewerMinutes: 25 },
+    ]);
+
+    // Minutes already counted are not counted again
+    usage.recordDisconnected({ ...connected, connectionId: "c2" }, at("2026-03-02T01:10:00Z"));
+    expect(usage.summary("2026-03-02", "2026-03-02", at("2026-03-02T02:00:00Z"))).toMatchObject([
+      { date: "2026-03-02", viewerMinutes: 30 },
+    ]);
+  });
+
+  it("forgets days past the retention", () => {
+    const usage = new UsageService(2);
+    usage.recordConnected(connected, at("2026-03-01T12:00:00Z"));
+    usage.recordDisconnected(connected, at("2026-03-01T12:30:00Z"));
+    expect(usage.summary(undefined, undefined, at("2026-03-04T12:00:00Z"))).toEqual([]);
+  });
+
+  describe("export", () => {
+    let directory: string;
+
+    beforeEach(async () => {
+      directory = await fs.mkdtemp(path.join(tmpdir(), "usage-test-"));
+    });
+
+    afterEach(async () => {
+      await fs.rm(directory, { recursive: true, force: true });
+    });
+
+    it("writes the totals of a day as json or csv", async () => {
+      const usage = new UsageService();
+      usage.recordConnected(connected, at("2026-03-01T12:00:00Z"));
+      const now = at("2026-03-02T00:01:00Z");
+
+      const json = await usage.export("2026-03-01", directory, "json", now);
+      expect(path.basename(json)).toBe("steel-usage-2026-03-01.json");
+      expect(JSON.parse(await fs.readFile(json, "utf8"))).toMatchObject({
+        date: "2026-03-01",
+        viewerConnections: 1,
+        viewerMinutes: 720,
+      });
+
+      const csv = await usage.export("2026-02-28", directory, "csv", now);
+      expect(await fs.readFile(csv, "utf8")).toBe(
+        "date,sessions,viewerConnections,viewerMinutes,frameBytes,recordings,inputEvents\n" +
+          "2026-02-28,0,0,0,0,0,0\n",
+      );
+    });
+  });
+});
+
+describe("formatUsageCsv", () => {
+  it("writes a header only when there are no days", () => {
+    expect(formatUsageCsv([])).toBe(
+      "date,sessions,viewerConnections,viewerMinutes,frameBytes,recordings,inputEvents\n",
+    );
+  });
+});
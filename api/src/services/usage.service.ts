@@ -0,0 +1,162 @@
+import fs from "fs/promises";
+import path from "path";
+import { BusEvents, EventBus } from "./event-bus.service.js";
+
+export interface DailyUsage {
+  /** UTC day, YYYY-MM-DD */
+  date: string;
+  sessions: number;
+  /** Live view connections opened */
+  viewerConnections: number;
+  /** Time live view connections were open, summed over connections */
+  viewerMinutes: number;
+  /** Frame data sent to live viewers */
+  frameBytes: number;
+  recordings: number;
+  /** Viewer input messages dispatched to the browser */
+  inputEvents: number;
+}
+
+export type UsageExportFormat = "json" | "csv";
+
+const USAGE_COLUMNS: (keyof DailyUsage)[] = [
+  "date",
+  "sessions",
+  "viewerConnections",
+  "viewerMinutes",
+  "frameBytes",
+  "recordings",
+  "inputEvents",
+];
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+const toDate = (at: number) => new Date(at).toISOString().slice(0, 10);
+
+const emptyDay = (date: string): DailyUsage => ({
+  date,
+  sessions: 0,
+  viewerConnections: 0,
+  viewerMinutes: 0,
+  frameBytes: 0,
+  recordings: 0,
+  inputEvents: 0,
+});
+
+export const formatUsageCsv = (days: DailyUsage[]): string =>
+  [USAGE_COLUMNS.join(","), ...days.map((day) => USAGE_COLUMNS.map((c) => day[c]).join(","))]
+    .join("\n")
+    .concat("\n");
+
+/**
+ * Rolls events of the bus up into per-day totals, in UTC, for capacity planning and billing
+ * without an analytics stack. Days older than the retention are forgotten, so they should be
+ * exported before then.
+ */
+export class UsageService {
+  private days = new Map<string, DailyUsage>();
+  // Connections still open, with the time up to which their minutes are counted
+  private openConnections = new Map<string, number>();
+
+  constructor(private readonly retentionDays: number = 31) {}
+
+  public attach(bus: EventBus): () => void {
+    const unsubscribes = [
+      bus.subscribe("session.started", () => this.day().sessions++),
+      bus.subscribe("session.recordingStarted", () => this.day().recordings++),
+      bus.subscribe("viewer.connected", (event) => this.recordConnected(event)),
+      bus.subscribe("viewer.disconnected", (event) => this.recordDisconnected(event)),
+      bus.subscribe("media.frameSent", ({ bytes }) => {
+        this.day().frameBytes += bytes;
+      }),
+      bus.subscribe("input.dispatched", () => this.day().inputEvents++),
+    ];
+    return () => unsubscribes.forEach((unsubscribe) => unsubscribe());
+  }
+
+  public recordConnected(event: BusEvents["viewer.connected"], now: number = Date.now()): void {
+    this.day(now).viewerConnections++;
+    this.openConnections.set(event.connectionId, now);
+  }
+
+  public recordDisconnected(
+    event: BusEvents["viewer.disconnected"],
+    now: number = Date.now(),
+  ): void {
+    const countedUntil = this.openConnections.get(event.connectionId);
+    if (countedUntil === undefined) {
+      return;
+    }
+    this.openConnections.delete(event.connectionId);
+    this.addViewerTime(countedUntil, now);
+  }
+
+  /**
+   * @returns the days from from to to, both included, oldest first. Days without activity are
+   * left out, and connections still open count up to now.
+   */
+  public summary(from?: string, to?: string, now: number = Date.now()): DailyUsage[] {
+    // Open connections are counted up to now, so their minutes show up on the right days
+    for (const [connectionId, countedUntil] of this.openConnections) {
+      this.addViewerTime(countedUntil, now);
+      this.openConnections.set(connectionId, now);
+    }
+    this.prune(now);
+
+    return Array.from(this.days.values())
+      .filter((day) => (!from || day.date >= from) && (!to || day.date <= to))
+      .sort((a, b) => a.date.localeCompare(b.date))
+      .map((day) => ({ ...day, viewerMinutes: Math.round(day.viewerMinutes * 100) / 100 }));
+  }
+
+  /**
+   * Writes the totals of a day to steel-usage-<date>.<format> in a directory
+   * @returns the path of the file
+   */
+  public async export(
+    date: string,
+    directory: string,
+    format: UsageExportFormat,
+    now: number = Date.now(),
+  ): Promise<string> {
+    const days = this.summary(date, date, now);
+    const day = days[0] ?? emptyDay(date);
+    const file = path.join(directory, `steel-usage-${date}.${format}`);
+    await fs.mkdir(directory, { recursive: true });
+    await fs.writeFile(
+      file,
+      format === "csv" ? formatUsageCsv([day]) : `${JSON.stringify(day, null, 2)}\n`,
+    );
+    return file;
+  }
+
+  private day(now: number = Date.now()): DailyUsage {
+    const date = toDate(now);
+    let day = this.days.get(date);
+    if (!day) {
+      day = emptyDay(date);
+      this.days.set(date, day);
+    }
+    return day;
+  }
+
+  // Time crossing midnight is split between the days it falls on
+  private addViewerTime(from: number, to: number): void {
+    let start = from;
+    while (start < to) {
+      const endOfDay = (Math.floor(start / DAY_MS) + 1) * DAY_MS;
+      const end = Math.min(to, endOfDay);
+      this.day(start).viewerMinutes += (end - start) / 60_000;
+      start = end;
+    }
+  }
+
+  private prune(now: number): void {
+    const oldest = toDate(now - this.retentionDays * DAY_MS);
+    for (const date of this.days.keys()) {
+      if (date < oldest) {
+        this.days.delete(date);
+      }
+    }
+  }
+}
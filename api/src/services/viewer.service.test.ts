@@ -0,0 +1,464 @@
+import { afterEach, beforeEach, describe, expect, it, vi } from "vitest";
+import { ViewerService } from "./viewer.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+const addViewer = (
+  service: ViewerService,
+  viewerId: string,
+  pageId: string | null = null,
+  connectionId = `${viewerId}-conn`,
+) => {
+  const send = vi.fn();
+  service.register({ connectionId, viewerId, pageId, send, close: vi.fn() });
+  return send;
+};
+
+describe("ViewerService control grants", () => {
+  let service: ViewerService;
+
+  beforeEach(() => {
+    vi.useFakeTimers();
+    service = new ViewerService(createLogger() as any);
+  });
+
+  afterEach(() => {
+    service.revokeControl();
+    vi.useRealTimers();
+  });
+
+  it("lets every viewer control without a grant", () => {
+    addViewer(service, "a");
+    addViewer(service, "b");
+
+    expect(service.canControl("a")).toBe(true);
+    expect(service.canControl("b")).toBe(true);
+  });
+
+  it("restricts control to the grantee until the grant expires", () => {
+    addViewer(service, "a");
+    addViewer(service, "b");
+
+    service.grantControl("b", 120_000);
+    expect(service.canControl("a")).toBe(false);
+    expect(service.canControl("b")).toBe(true);
+
+    vi.advanceTimersByTime(120_000);
+    expect(service.canControl("a")).toBe(true);
+    expect(service.getControlGrant()).toBeNull();
+  });
+
+  it("sends countdown and revert events to all viewers", () => {
+    const sendA = addViewer(service, "a");
+    addViewer(service, "b");
+
+    service.grantControl("b", 2_000);
+    expect(sendA).toHaveBeenCalledWith({ type: "controlGrant", viewerId: "b", remainingMs: 2_000 });
+
+    vi.advanceTimersByTime(2_000);
+    expect(sendA).toHaveBeenCalledWith({ type: "controlReverted", viewerId: "b" });
+  });
+
+  it("revokes the grant when the session is reset", () => {
+    const sendA = addViewer(service, "a");
+    addViewer(service, "b");
+
+    service.grantControl("b", 120_000);
+    service.resetSession();
+    expect(service.getControlGrant()).toBeNull();
+    expect(service.canControl("a")).toBe(true);
+    expect(sendA).toHaveBeenLastCalledWith({ type: "controlReverted", viewerId: "b" });
+  });
+
+  it("lets any viewer that can drive input start a handoff while no grant is active", () => {
+    addViewer(service, "a");
+    addViewer(service, "b");
+    service.register({
+      connectionId: "watcher-conn",
+      viewerId: "watcher",
+      pageId: null,
+      viewOnly: true,
+      send: vi.fn(),
+      close: vi.fn(),
+    });
+
+    expect(() => service.handOffControl("watcher", "b", 60_000)).toThrow();
+    expect(() => service.handOffControl("a", "a", 60_000)).toThrow();
+    expect(service.handOffControl("a", "b", 60_000).viewerId).toBe("b");
+  });
+
+  it("only lets the holder pass an active grant on", () => {
+    addViewer(service, "a");
+    addViewer(service, "b");
+    addViewer(service, "c");
+    service.grantControl("b", 60_000);
+
+    expect(() => service.handOffControl("a", "c", 60_000)).toThrow();
+    expect(() => service.handOffControl("b", "b", 60_000)).toThrow();
+    expect(service.handOffControl("b", "c", 60_000).viewerId).toBe("c");
+    expect(service.canControl("b")).toBe(false);
+  });
+
+  it("rejects grants for unknown viewers and invalid durations", () => {
+    addViewer(service, "a");
+
+    expect(() => service.grantControl("missing", 1_000)).toThrow();
+    expect(() => service.grantControl("a", 0)).toThrow();
+  });
+});
+
+describe("ViewerService stream blanking", () => {
+  it("notifies viewers only when the blanked state changes", () => {
+    const service = new ViewerService(createLogger() as any);
+    const send = addViewer(service, "a");
+    const onResumed = vi.fn();
+    service.on("streamResumed", onResumed);
+
+    service.setBlanked(true);
+    service.setBlanked(true);
+    expect(service.isBlanked()).toBe(true);
+    expect(send).toHaveBeenCalledTimes(1);
+    expect(send).toHaveBeenCalledWith({ type: "streamBlanked" });
+
+    service.setBlanked(false);
+    expect(send).toHaveBeenLastCalledWith({ type: "streamResumed" });
+    expect(onResumed).toHaveBeenCalledTimes(1);
+  });
+
+  it("lifts blanking when the session is reset", () => {
+    const service = new ViewerService(createLogger() as any);
+    const send = addViewer(service, "a");
+
+    service.setBlanked(true);
+    service.resetSession();
+    expect(service.isBlanked()).toBe(false);
+    expect(send).toHaveBeenLastCalledWith({ type: "streamResumed" });
+  });
+});
+
+describe("ViewerService stream quality", () => {
+  it("tells viewers and connections about a new quality", () => {
+    const service = new ViewerService(createLogger() as any);
+    const send = addViewer(service, "a");
+    const onChanged = vi.fn();
+    service.on("streamQualityChanged", onChanged);
+    const low = { preset: "low" as const, quality: 40, maxFps: 10, maxBitrateKbps: 1000 };
+
+    expect(service.getStreamQuality().preset).toBe("high");
+    service.setStreamQuality(low);
+
+    expect(service.getStreamQuality()).toEqual(low);
+    expect(send).toHaveBeenCalledWith({ type: "streamQuality", ...low });
+    expect(onChanged).toHaveBeenCalledWith(low);
+  });
+});
+
+describe("ViewerService lifecycle", () => {
+  it("counts viewers once across their connections", () => {
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a", "p1", "a-1");
+    addViewer(service, "a", "p2", "a-2");
+    addViewer(service, "b", "p1", "b-1");
+
+    expect(service.count()).toBe(2);
+    expect(service.count("p1")).toBe(2);
+    expect(service.count("p2")).toBe(1);
+  });
+
+  it("revokes a grant once the holder's last connection closes", () => {
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a", "p1", "a-1");
+    addViewer(service, "a", "p2", "a-2");
+    service.grantControl("a", 60_000);
+
+    service.unregister("a-1");
+    expect(service.getControlGrant()?.viewerId).toBe("a");
+
+    service.unregister("a-2");
+    expect(service.getControlGrant()).toBeNull();
+  });
+});
+
+describe("ViewerService registry", () => {
+  it("tracks connection timestamps and activity", () => {
+    vi.useFakeTimers();
+    vi.setSystemTime(1_000);
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a");
+
+    vi.setSystemTime(5_000);
+    service.touch("a-conn");
+    expect(service.list()[0]).toMatchObject({
+      state: "active",
+      connectedAt: 1_000,
+      lastActiveAt: 5_000,
+    });
+    vi.useRealTimers();
+  });
+
+  it("closes and removes every connection of a viewer", () => {
+    const service = new ViewerService(createLogger() as any);
+    const close = vi.fn();
+    service.register({ connectionId: "a-1", viewerId: "a", pageId: null, send: vi.fn(), close });
+    addViewer(service, "b");
+
+    expect(service.disconnect("a", "Kicked")).toBe(true);
+    expect(close).toHaveBeenCalledWith("Kicked");
+    expect(service.hasViewer("a")).toBe(false);
+    expect(service.hasViewer("b")).toBe(true);
+    expect(service.disconnect("a")).toBe(false);
+  });
+});
+
+describe("ViewerService view-only viewers", () => {
+  it("refuses to grant control to view-only viewers", () => {
+    const service = new ViewerService(createLogger() as any);
+    service.register({
+      connectionId: "a-1",
+      viewerId: "a",
+      pageId: null,
+      viewOnly: true,
+      send: vi.fn(),
+      close: vi.fn(),
+    });
+
+    expect(() => service.grantControl("a", 1_000)).toThrow("view-only");
+  });
+});
+
+describe("ViewerService connection health", () => {
+  it("summarizes reconnects, missed pongs and round trips per viewer", () => {
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a", null, "a-1");
+    service.unregister("a-1");
+    addViewer(service, "a", null, "a-2");
+
+    [10, 20, 30, 40].forEach((rtt) => {
+      service.recordPing("a");
+      service.recordPong("a", "a-2", rtt);
+    });
+    service.recordPing("a");
+    expect(service.recordMissedPong("a", "a-2")).toBe(1);
+    expect(service.recordMissedPong("a", "a-2")).toBe(2);
+    service.recordDeadlineExpired("a", "a-2");
+
+    expect(service.getHealth("a")).toEqual({
+      reconnects: 1,
+      pings: 5,
+      missedPongs: 2,
+      deadlineExpirations: 1,
+      rttMs: { p50: 30, p95: 40, max: 40 },
+    });
+  });
+
+  it("counts missed pongs in a row per connection", () => {
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a", "p1", "a-1");
+    addViewer(service, "a", "p2", "a-2");
+
+    expect(service.recordMissedPong("a", "a-1")).toBe(1);
+    // A healthy tab does not vouch for a dead one
+    service.recordPong("a", "a-2", 10);
+    expect(service.recordMissedPong("a", "a-1")).toBe(2);
+    expect(service.recordMissedPong("a", "a-2")).toBe(1);
+    expect(service.getHealth("a").missedPongs).toBe(3);
+  });
+
+  it("forgets viewers some time after their last connection closed", () => {
+    vi.useFakeTimers();
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a");
+    service.recordPing("a");
+    service.unregister("a-conn");
+
+    vi.advanceTimersByTime(11 * 60 * 1000);
+    addViewer(service, "b");
+    expect(service.getHealth("a")).toMatchObject({ reconnects: 0, pings: 0 });
+    vi.useRealTimers();
+  });
+});
+
+describe("ViewerService media stats", () => {
+  it("tracks frames per connection and the recent bitrate", () => {
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a", null, "a-1");
+
+    service.recordFrameSent("a-1", 50_000, 1_000);
+    service.recordFrameSent("a-1", 25_000, 5_000);
+    service.recordFrameDropped("a-1");
+
+    expect(service.getMediaStats("a-1", 5_000)).toEqual({
+      framesSent: 2,
+      framesDropped: 1,
+      bytesSent: 75_000,
+      bitrateKbps: 120,
+    });
+    // Only the second frame is still within the window
+    expect(service.getMediaStats("a-1", 7_000)?.bitrateKbps).toBe(40);
+
+    service.unregister("a-1");
+    expect(service.getMediaStats("a-1")).toBeNull();
+  });
+});
+
+describe("ViewerService bandwidth limits", () => {
+  it("keeps a viewer's limit across reconnects until it is removed", () => {
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a", null, "a-1");
+
+    service.setBandwidthLimit("a", 1000);
+    service.unregister("a-1");
+    expect(service.getBandwidthLimit("a")).toBe(1000);
+
+    service.setBandwidthLimit("a", null);
+    expect(service.getBandwidthLimit("a")).toBeNull();
+  });
+
+  it("drops limits of viewers that are gone and of the previous session", () => {
+    vi.useFakeTimers();
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a");
+    service.setBandwidthLimit("a", 1000);
+    service.setBandwidthLimit("b", 2000);
+    service.unregister("a-conn");
+
+    vi.advanceTimersByTime(11 * 60 * 1000);
+    addViewer(service, "c");
+    expect(service.getBandwidthLimit("a")).toBeNull();
+    expect(service.getBandwidthLimit("b")).toBe(2000);
+
+    service.resetSession();
+    expect(service.getBandwidthLimit("b")).toBeNull();
+    vi.useRealTimers();
+  });
+
+  it("rejects limits that are not positive", () => {
+    const service = new ViewerService(createLogger() as any);
+
+    expect(() => service.setBandwidthLimit("a", 0)).toThrow();
+    expect(service.getBandwidthLimit("a")).toBeNull();
+  });
+});
+
+describe("ViewerService pointers", () => {
+  it("forgets the pointer of a closed page and all pointers when the session ends", () => {
+    const service = new ViewerService(createLogger() as any);
+    service.setPointer("p1", 10, 20, "text");
+    service.setPointer("p2", 30, 40);
+
+    service.clearPointer("p1");
+    expect(service.getPointer("p1")).toBeNull();
+    expect(service.getPointer("p2")).toEqual({ x: 30, y: 40, cursor: undefined });
+
+    service.resetSession();
+    expect(service.getPointer("p2")).toBeNull();
+  });
+});
+
+describe("ViewerService clipboard", () => {
+  it("reports unchanged content so synced writes do not echo", () => {
+    const service = new ViewerService(createLogger() as any);
+
+    expect(service.updateClipboard("s1", { text: "a" })).toBe(true);
+    expect(service.updateClipboard("s1", { text: "a" })).toBe(false);
+    expect(service.updateClipboard("s1", { text: "a", html: "<b>a</b>" })).toBe(true);
+    expect(service.getClipboard("s1")).toEqual({ text: "a", html: "<b>a</b>" });
+  });
+
+  it("does not hand one session's clipboard to another", () => {
+    const service = new ViewerService(createLogger() as any);
+    service.updateClipboard("s1", { text: "secret" });
+
+    expect(service.getClipboard("s2")).toBeNull();
+    expect(service.updateClipboard("s2", { text: "secret" })).toBe(true);
+  });
+});
+
+describe("ViewerService resume tokens", () => {
+  const state = {
+    sessionId: "s1",
+    viewerId: "a",
+    connectionId: "a-conn",
+    pageId: "p1",
+    viewOnly: false,
+    keyboardLayout: "us",
+    streamQuality: null,
+  };
+
+  it("hands the state over once, within the grace window", () => {
+    const service = new ViewerService(createLogger() as any);
+    const token = service.issueResumeToken(state);
+    service.updateResumeState(token, { keyboardLayout: "de" });
+    service.releaseResumeToken(token, 30_000, 1000);
+
+    expect(service.resume(token, "s2", 2000)).toBeNull();
+    expect(service.resume(token, "s1", 2000)).toEqual({ ...state, keyboardLayout: "de" });
+    expect(service.resume(token, "s1", 2000)).toBeNull();
+  });
+
+  it("rejects tokens past their grace window", () => {
+    const service = new ViewerService(createLogger() as any);
+    const token = service.issueResumeToken(state);
+    service.releaseResumeToken(token, 30_000, 1000);
+
+    expect(service.resume(token, "s1", 31_000)).toBeNull();
+  });
+
+  it("closes the connection being resumed if it is still registered", () => {
+    const service = new ViewerService(createLogger() as any);
+    const close = vi.fn();
+    service.register({ connectionId: "a-conn", viewerId: "a", pageId: "p1", send: vi.fn(), close });
+    const token = service.issueResumeToken(state);
+
+    expect(service.resume(token, "s1")).not.toBeNull();
+    expect(close).toHaveBeenCalledWith("Resumed by a new connection");
+    expect(service.hasViewer("a")).toBe(false);
+  });
+
+  it("revokes the token of a connection the server closed", () => {
+    const service = new ViewerService(createLogger() as any);
+    addViewer(service, "a", "p1");
+    const token = service.issueResumeToken(state);
+
+    service.close("a-conn");
+    expect(service.resume(token, "s1")).toBeNull();
+  });
+});
+
+describe("ViewerService reservations", () => {
+  it("holds places for connections being set up", () => {
+    const service = new ViewerService(createLogger() as any);
+
+    expect(service.reserve("a-conn", "a", 2)).toBe(true);
+    expect(service.reserve("b-conn", "b", 2)).toBe(true);
+    expect(service.reserve("c-conn", "c", 2)).toBe(false);
+    // Another tab of a viewer shares its place
+    expect(service.reserve("a-conn-2", "a", 2)).toBe(true);
+  });
+
+  it("hands the place over on register and frees it on release", () => {
+    const service = new ViewerService(createLogger() as any);
+    service.reserve("a-conn", "a", 1);
+    addViewer(service, "a");
+    expect(service.reserve("b-conn", "b", 1)).toBe(false);
+
+    service.unregister("a-conn");
+    expect(service.reserve("b-conn", "b", 1)).toBe(true);
+    service.releaseReservation("b-conn");
+    expect(service.reserve("c-conn", "c", 1)).toBe(true);
+  });
+});
@@ -0,0 +1,642 @@
+import { randomBytes } from "crypto";
+import { EventEmitter } from "events";
+import { FastifyBaseLogger } from "fastify";
+import { ClipboardContent } from "../types/casting.js";
+import { DEFAULT_STREAM_QUALITY, StreamQuality } from "../utils/stream-quality.js";
+
+export interface ViewerConnection {
+  /** Unique id of the WebSocket connection */
+  connectionId: string;
+  /** Id shared by all connections from the same viewer (one per tab), from its token or resume */
+  viewerId: string;
+  pageId: string | null;
+  /** View-only connections never send input and cannot be granted control */
+  viewOnly?: boolean;
+  /** Dry-run connections have their input acknowledged but never dispatched */
+  dryRun?: boolean;
+  send: (payload: Record<string, unknown>) => void;
+  /** Closes the connection; the connection tears down its screencast once closed */
+  close: (reason: string) => void;
+}
+
+export type ViewerState = "active" | "closing";
+
+/**
+ * What a connection had set up, handed to the connection that resumes it
+ */
+export interface ResumeState {
+  sessionId: string;
+  viewerId: string;
+  connectionId: string;
+  pageId: string | null;
+  viewOnly: boolean;
+  keyboardLayout: string;
+  /** Quality the viewer picked for the connection, null to follow the session's */
+  streamQuality: StreamQuality | null;
+}
+
+export interface Viewer extends ViewerConnection {
+  state: ViewerState;
+  connectedAt: number;
+  lastActiveAt: number;
+}
+
+export interface ControlGrant {
+  viewerId: string;
+  expiresAt: number;
+}
+
+export interface ViewerHealth {
+  /** Number of connections the viewer opened beyond the first one */
+  reconnects: number;
+  pings: number;
+  missedPongs: number;
+  /** Connections closed because too many consecutive pongs were missed */
+  deadlineExpirations: number;
+  rttMs: { p50: number; p95: number; max: number } | null;
+}
+
+export interface ConnectionMediaStats {
+  framesSent: number;
+  framesDropped: number;
+  bytesSent: number;
+  /** Bitrate of frames sent over the last few seconds */
+  bitrateKbps: number;
+}
+
+interface MediaStats {
+  framesSent: number;
+  framesDropped: number;
+  bytesSent: number;
+  recent: { at: number; bytes: number }[];
+}
+
+interface ViewerHealthStats {
+  connections: number;
+  pings: number;
+  missedPongs: number;
+  deadlineExpirations: number;
+  rtts: number[];
+  /** When the viewer's last connection closed, null while it is connected */
+  disconnectedAt: number | null;
+}
+
+const MAX_RTT_SAMPLES = 100;
+// Health of a viewer that reconnects within this long adds up, later it starts over
+const HEALTH_RETENTION_MS = 10 * 60 * 1000;
+const BITRATE_WINDOW_MS = 5000;
+
+const percentile = (sorted: number[], p: number) =>
+  sorted[Math.min(sorted.length - 1, Math.floor((p / 100) * sorted.length))];
+
+const COUNTDOWN_INTERVAL_MS = 1000;
+const MAX_GRANT_DURATION_MS = 60 * 60 * 1000;
+
+export class ViewerService extends EventEmitter {
+  private logger: FastifyBaseLogger;
+  private viewers = new Map<string, Viewer>();
+  private grant: ControlGrant | null = null;
+  private grantTimer: NodeJS.Timeout | null = null;
+  private countdownTimer: NodeJS.Timeout | null = null;
+  private blanked = false;
+  private streamQuality: StreamQuality = DEFAULT_STREAM_QUALITY;
+  // Only the clipboard of the latest session is kept, so it never leaks into the next one
+  private clipboard: { sessionId: string; content: ClipboardContent } | null = null;
+  private pointers = new Map<string, { x: number; y: number; cursor?: string }>();
+  // Kept per viewer across reconnects, so flaky links show up as reconnects and missed pongs
+  private health = new Map<string, ViewerHealthStats>();
+  // Pongs missed in a row, per connection since each of a viewer's tabs has a socket of its own
+  private consecutiveMissedPongs = new Map<string, number>();
+  private media = new Map<string, MediaStats>();
+  // Egress caps set through the API, kept per viewer so they survive reconnects, but not sessions
+  private bandwidthLimits = new Map<string, number>();
+  // Resume tokens of open connections never expire, those of closed ones after their grace window
+  private resumeTokens = new Map<string, { state: ResumeState; expiresAt: number | null }>();
+  // Viewer ids of connections that passed the viewer cap and are still being set up
+  private reservations = new Map<string, string>();
+
+  constructor(logger: FastifyBaseLogger) {
+    super();
+    this.logger = logger.child({ component: "ViewerService" });
+  }
+
+  public register(connection: ViewerConnection): Viewer {
+    const now = Date.now();
+    const viewer: Viewer = { ...connection, state: "active", connectedAt: now, lastActiveAt: now };
+    this.viewers.set(viewer.connectionId, viewer);
+    this.reservations.delete(viewer.connectionId);
+    this.media.set(viewer.connectionId, {
+      framesSent: 0,
+      framesDropped: 0,
+      bytesSent: 0,
+      recent: [],
+    });
+    this.pruneHealth(now);
+    const health = this.getHealthStats(viewer.viewerId);
+    health.connections++;
+    health.disconnectedAt = null;
+    this.logger.debug(`Viewer ${viewer.viewerId} connected (${viewer.connectionId})`);
+    return viewer;
+  }
+
+  public recordPing(viewerId: string): void {
+    this.getHealthStats(viewerId).pings++;
+  }
+
+  public recordPong(viewerId: string, connectionId: string, rttMs: number): void {
+    const stats = this.getHealthStats(viewerId);
+    this.consecutiveMissedPongs.delete(connectionId);
+    stats.rtts.push(rttMs);
+    if (stats.rtts.length > MAX_RTT_SAMPLES) {
+      stats.rtts.shift();
+    }
+  }
+
+  /**
+   * @returns the number of consecutive pongs the connection has missed
+   */
+  public recordMissedPong(viewerId: string, connectionId: string): number {
+    this.getHealthStats(viewerId).missedPongs++;
+    const missed = (this.consecutiveMissedPongs.get(connectionId) ?? 0) + 1;
+    this.consecutiveMissedPongs.set(connectionId, missed);
+    return missed;
+  }
+
+  public recordDeadlineExpired(viewerId: string, connectionId: string): void {
+    this.getHealthStats(viewerId).deadlineExpirations++;
+    this.consecutiveMissedPongs.delete(connectionId);
+  }
+
+  public getHealth(viewerId: string): ViewerHealth {
+    const stats = this.health.get(viewerId) ?? this.emptyHealthStats();
+    const rtts = [...stats.rtts].sort((a, b) => a - b);
+    return {
+      reconnects: Math.max(0, stats.connections - 1),
+      pings: stats.pings,
+      missedPongs: stats.missedPongs,
+      deadlineExpirations: stats.deadlineExpirations,
+      rttMs:
+        rtts.length > 0
+          ? { p50: percentile(rtts, 50), p95: percentile(rtts, 95), max: rtts[rtts.length - 1] }
+          : null,
+    };
+  }
+
+  public recordFrameSent(connectionId: string, bytes: number, now: number = Date.now()): void {
+    const stats = this.media.get(connectionId);
+    if (!stats) {
+      return;
+    }
+    stats.framesSent++;
+    stats.bytesSent += bytes;
+    stats.recent.push({ at: now, bytes });
+    while (stats.recent.length > 0 && now - stats.recent[0].at > BITRATE_WINDOW_MS) {
+      stats.recent.shift();
+    }
+  }
+
+  public recordFrameDropped(connectionId: string): void {
+    const stats = this.media.get(connectionId);
+    if (stats) {
+      stats.framesDropped++;
+    }
+  }
+
+  public getMediaStats(
+    connectionId: string,
+    now: number = Date.now(),
+  ): ConnectionMediaStats | null {
+    const stats = this.media.get(connectionId);
+    if (!stats) {
+      return null;
+    }
+
+    const recentBytes = stats.recent
+      .filter((sample) => now - sample.at <= BITRATE_WINDOW_MS)
+      .reduce((total, sample) => total + sample.bytes, 0);
+    return {
+      framesSent: stats.framesSent,
+      framesDropped: stats.framesDropped,
+      bytesSent: stats.bytesSent,
+      bitrateKbps: Math.round((recentBytes * 8) / BITRATE_WINDOW_MS),
+    };
+  }
+
+  /**
+   * Caps the frame bitrate sent to each connection of a viewer, overriding any cap from the
+   * viewer's token. Pass null to remove the cap.
+   */
+  public setBandwidthLimit(viewerId: string, maxBitrateKbps: number | null): void {
+    if (maxBitrateKbps === null) {
+      this.bandwidthLimits.delete(viewerId);
+    } else if (!Number.isFinite(maxBitrateKbps) || maxBitrateKbps <= 0) {
+      throw new Error("Bandwidth limit must be a positive number of kbps");
+    } else {
+      this.bandwidthLimits.set(viewerId, maxBitrateKbps);
+    }
+    this.logger.info(
+      maxBitrateKbps === null
+        ? `Removed bandwidth limit of viewer ${viewerId}`
+        : `Limited viewer ${viewerId} to ${maxBitrateKbps} kbps`,
+    );
+  }
+
+  public getBandwidthLimit(viewerId: string): number | null {
+    return this.bandwidthLimits.get(viewerId) ?? null;
+  }
+
+  private getHealthStats(viewerId: string): ViewerHealthStats {
+    let stats = this.health.get(viewerId);
+    if (!stats) {
+      stats = this.emptyHealthStats();
+      this.health.set(viewerId, stats);
+    }
+    return stats;
+  }
+
+  private emptyHealthStats(): ViewerHealthStats {
+    return {
+      connections: 0,
+      pings: 0,
+      missedPongs: 0,
+      deadlineExpirations: 0,
+      rtts: [],
+      disconnectedAt: null,
+    };
+  }
+
+  // Viewers whose id was their connection's never come back, so nothing would remove them
+  private pruneHealth(now: number): void {
+    for (const [viewerId, { disconnectedAt }] of this.health) {
+      if (disconnectedAt !== null && now - disconnectedAt > HEALTH_RETENTION_MS) {
+        this.health.delete(viewerId);
+        // A viewer gone this long is not reconnecting, its cap has nothing left to apply to
+        this.bandwidthLimits.delete(viewerId);
+      }
+    }
+  }
+
+  /**
+   * Records activity (e.g. input) from a connection
+   */
+  public touch(connectionId: string): void {
+    const viewer = this.viewers.get(connectionId);
+    if (viewer) {
+      viewer.lastActiveAt = Date.now();
+    }
+  }
+
+  /**
+   * Closes a connection and removes it from the registry right away, so it receives no further
+   * broadcasts while its socket finishes closing.
+   */
+  public close(connectionId: string, reason = "Closed by server"): void {
+    const viewer = this.viewers.get(connectionId);
+    if (!viewer || viewer.state === "closing") {
+      return;
+    }
+
+    viewer.state = "closing";
+    this.unregister(connectionId);
+    // A connection the server closed on purpose must not come back through its token
+    for (const [token, { state }] of this.resumeTokens) {
+      if (state.connectionId === connectionId) {
+        this.resumeTokens.delete(token);
+      }
+    }
+    try {
+      viewer.close(reason);
+    } catch (err) {
+      this.logger.error({ err }, `Failed to close viewer connection ${connectionId}`);
+    }
+  }
+
+  /**
+   * Closes every connection of a viewer
+   * @returns false if the viewer is not connected
+   */
+  public disconnect(viewerId: string, reason?: string): boolean {
+    const connections = this.list().filter((viewer) => viewer.viewerId === viewerId);
+    connections.forEach((viewer) => this.close(viewer.connectionId, reason));
+    return connections.length > 0;
+  }
+
+  public unregister(connectionId: string): void {
+    const viewer = this.viewers.get(connectionId);
+    if (!viewer) {
+      return;
+    }
+
+    this.viewers.delete(connectionId);
+    this.media.delete(connectionId);
+    this.consecutiveMissedPongs.delete(connectionId);
+    if (!this.hasViewer(viewer.viewerId)) {
+      const health = this.health.get(viewer.viewerId);
+      if (health) {
+        health.disconnectedAt = Date.now();
+      }
+    }
+    this.logger.debug(`Viewer ${viewer.viewerId} disconnected (${connectionId})`);
+
+    // A grant held by a viewer that is gone would lock everyone else out until it expires
+    if (this.grant?.viewerId === viewer.viewerId && !this.hasViewer(viewer.viewerId)) {
+      this.revokeControl();
+    }
+  }
+
+  /**
+   * Issues the token a connection can be resumed with once its socket drops
+   */
+  public issueResumeToken(state: ResumeState): string {
+    const token = randomBytes(24).toString("base64url");
+    this.resumeTokens.set(token, { state, expiresAt: null });
+    return token;
+  }
+
+  public updateResumeState(token: string, update: Partial<ResumeState>): void {
+    const entry = this.resumeTokens.get(token);
+    if (entry) {
+      entry.state = { ...entry.state, ...update };
+    }
+  }
+
+  /**
+   * Starts the grace window of a closed connection's token, it can be resumed until it ends
+   */
+  public releaseResumeToken(token: string, graceMs: number, now: number = Date.now()): void {
+    const entry = this.resumeTokens.get(token);
+    if (!entry) {
+      return;
+    }
+    if (graceMs > 0) {
+      entry.expiresAt = now + graceMs;
+    } else {
+      this.resumeTokens.delete(token);
+    }
+    this.pruneResumeTokens(now);
+  }
+
+  /**
+   * Takes over the connection a token was issued for. Each token works once. A connection that is
+   * still registered, e.g. a half-open socket the heartbeat has not caught yet, is closed.
+   * @returns the state to restore, null if the token is unknown, expired or from another session
+   */
+  public resume(token: string, sessionId: string, now: number = Date.now()): ResumeState | null {
+    this.pruneResumeTokens(now);
+    const entry = this.resumeTokens.get(token);
+    if (!entry || entry.state.sessionId !== sessionId) {
+      return null;
+    }
+
+    this.resumeTokens.delete(token);
+    this.close(entry.state.connectionId, "Resumed by a new connection");
+    this.logger.debug(
+      `Viewer ${entry.state.viewerId} resumed connection ${entry.state.connectionId}`,
+    );
+    return entry.state;
+  }
+
+  private pruneResumeTokens(now: number): void {
+    for (const [token, { expiresAt }] of this.resumeTokens) {
+      if (expiresAt !== null && expiresAt <= now) {
+        this.resumeTokens.delete(token);
+      }
+    }
+  }
+
+  /**
+   * Holds a place for a connection while it is set up, so concurrent upgrades cannot all pass the
+   * viewer cap before any of them registers. Connections of a viewer that is already connected or
+   * holds a place share its place. Registering the connection takes over the place.
+   * @param maxViewers cap on distinct viewers, 0 for no cap
+   * @returns false if the cap is reached
+   */
+  public reserve(connectionId: string, viewerId: string, maxViewers: number): boolean {
+    const viewerIds = new Set([
+      ...this.list().map((viewer) => viewer.viewerId),
+      ...this.reservations.values(),
+    ]);
+    if (maxViewers > 0 && !viewerIds.has(viewerId) && viewerIds.size >= maxViewers) {
+      return false;
+    }
+    this.reservations.set(connectionId, viewerId);
+    return true;
+  }
+
+  /**
+   * Gives up the place of a connection that did not register, e.g. because its setup failed
+   */
+  public releaseReservation(connectionId: string): void {
+    this.reservations.delete(connectionId);
+  }
+
+  public list(): Viewer[] {
+    return Array.from(this.viewers.values());
+  }
+
+  /**
+   * Number of connected viewers, optionally only those watching a given page
+   */
+  public count(pageId?: string): number {
+    const viewers = this.list().filter((viewer) => !pageId || viewer.pageId === pageId);
+    return new Set(viewers.map((viewer) => viewer.viewerId)).size;
+  }
+
+  public hasViewer(viewerId: string): boolean {
+    return this.list().some((viewer) => viewer.viewerId === viewerId);
+  }
+
+  /**
+   * @param exceptConnectionId connection that should not receive the payload, e.g. its origin
+   */
+  public broadcast(payload: Record<string, unknown>, exceptConnectionId?: string): void {
+    for (const viewer of this.viewers.values()) {
+      if (viewer.connectionId === exceptConnectionId) {
+        continue;
+      }
+      try {
+        viewer.send(payload);
+      } catch (err) {
+        this.logger.error({ err }, `Failed to send to viewer ${viewer.connectionId}`);
+      }
+    }
+  }
+
+  /**
+   * Records where the mouse was last dispatched on a page, by any viewer, or last seen by the
+   * page. Without a cursor the page's last known cursor is kept.
+   */
+  public setPointer(pageId: string, x: number, y: number, cursor?: string): void {
+    this.pointers.set(pageId, { x, y, cursor: cursor ?? this.pointers.get(pageId)?.cursor });
+  }
+
+  public getPointer(pageId: string): { x: number; y: number; cursor?: string } | null {
+    return this.pointers.get(pageId) ?? null;
+  }
+
+  public clearPointer(pageId: string): void {
+    this.pointers.delete(pageId);
+  }
+
+  /**
+   * Drops state tied to a session, called when it ends
+   */
+  public resetSession(): void {
+    this.pointers.clear();
+    this.bandwidthLimits.clear();
+    // Blanking covers what one session shows, viewers of the next are told it is lifted
+    this.setBlanked(false);
+    // A viewer still connected from the previous session must not lock everyone out of this one
+    this.revokeControl();
+  }
+
+  public getClipboard(sessionId: string): ClipboardContent | null {
+    return this.clipboard?.sessionId === sessionId ? this.clipboard.content : null;
+  }
+
+  /**
+   * Records new content of the clipboard shared by a session and its viewers
+   * @returns false if the clipboard already holds the content. A synced write comes back from
+   * the other side, and stopping there keeps it from bouncing back and forth.
+   */
+  public updateClipboard(sessionId: string, content: ClipboardContent): boolean {
+    const current = this.getClipboard(sessionId);
+    if (current?.text === content.text && current?.html === content.html) {
+      return false;
+    }
+    this.clipboard = { sessionId, content };
+    return true;
+  }
+
+  public isBlanked(): boolean {
+    return this.blanked;
+  }
+
+  /**
+   * Blanks the stream for all viewers without disconnecting them, e.g. while sensitive data is
+   * on screen. Connections emit the latest frame again once the stream is resumed.
+   */
+  public setBlanked(blanked: boolean): void {
+    if (this.blanked === blanked) {
+      return;
+    }
+
+    this.blanked = blanked;
+    this.logger.info(`Stream ${blanked ? "blanked" : "resumed"}`);
+    this.broadcast({ type: blanked ? "streamBlanked" : "streamResumed" });
+    this.emit(blanked ? "streamBlanked" : "streamResumed");
+  }
+
+  public getStreamQuality(): StreamQuality {
+    return this.streamQuality;
+  }
+
+  /**
+   * Sets the quality of the stream for all viewers. Connections restart their screencast with it,
+   * except those whose viewer picked a quality of its own.
+   */
+  public setStreamQuality(quality: StreamQuality): void {
+    this.streamQuality = quality;
+    this.logger.info({ ...quality }, `Stream quality set to ${quality.preset}`);
+    this.broadcast({ type: "streamQuality", ...quality });
+    this.emit("streamQualityChanged", quality);
+  }
+
+  /**
+   * Whether a viewer may drive input. Everyone may while no grant is active.
+   */
+  public canControl(viewerId: string): boolean {
+    return !this.grant || this.grant.viewerId === viewerId;
+  }
+
+  public getControlGrant(): ControlGrant | null {
+    return this.grant;
+  }
+
+  /**
+   * Gives exclusive control to a viewer for a bounded duration, after which control reverts
+   * to all viewers. Viewers receive a countdown while the grant is active.
+   */
+  public grantControl(viewerId: string, durationMs: number): ControlGrant {
+    if (!Number.isFinite(durationMs) || durationMs <= 0 || durationMs > MAX_GRANT_DURATION_MS) {
+      throw new Error(`Grant duration must be between 1ms and ${MAX_GRANT_DURATION_MS}ms`);
+    }
+    const connections = this.list().filter((viewer) => viewer.viewerId === viewerId);
+    if (connections.length === 0) {
+      throw new Error(`Viewer ${viewerId} is not connected`);
+    }
+    if (connections.every((viewer) => viewer.viewOnly)) {
+      throw new Error(`Viewer ${viewerId} is view-only`);
+    }
+
+    this.clearGrantTimers();
+    this.grant = { viewerId, expiresAt: Date.now() + durationMs };
+    this.logger.info(`Granted control to viewer ${viewerId} for ${durationMs}ms`);
+
+    this.broadcastCountdown();
+    this.countdownTimer = setInterval(() => this.broadcastCountdown(), COUNTDOWN_INTERVAL_MS);
+    this.grantTimer = setTimeout(() => this.revokeControl(), durationMs);
+
+    return this.grant;
+  }
+
+  /**
+   * Hands control to another viewer at a viewer's request, e.g. over its socket. Anyone who may
+   * drive input can start a handoff while no grant is active, afterwards only the holder can pass
+   * it on. Viewers never grant control to themselves, which would lock everyone else out.
+   */
+  public handOffControl(
+    fromViewerId: string,
+    toViewerId: string,
+    durationMs: number,
+  ): ControlGrant {
+    if (this.grant && this.grant.viewerId !== fromViewerId) {
+      throw new Error("Only the viewer holding control can grant it");
+    }
+    if (toViewerId === fromViewerId) {
+      throw new Error("Viewers cannot grant control to themselves");
+    }
+    const canDrive = this.list().some(
+      (viewer) => viewer.viewerId === fromViewerId && !viewer.viewOnly,
+    );
+    if (!canDrive) {
+      throw new Error(`Viewer ${fromViewerId} cannot grant control`);
+    }
+    return this.grantControl(toViewerId, durationMs);
+  }
+
+  public revokeControl(): void {
+    if (!this.grant) {
+      return;
+    }
+
+    const { viewerId } = this.grant;
+    this.clearGrantTimers();
+    this.grant = null;
+    this.logger.info(`Control reverted from viewer ${viewerId}`);
+    this.broadcast({ type: "controlReverted", viewerId });
+  }
+
+  private broadcastCountdown(): void {
+    if (!this.grant) {
+      return;
+    }
+
+    this.broadcast({
+      type: "controlGrant",
+      viewerId: this.grant.viewerId,
+      remainingMs: Math.max(0, this.grant.expiresAt - Date.now()),
+    });
+  }
+
+  private clearGrantTimers(): void {
+    if (this.grantTimer) {
+      clearTimeout(this.grantTimer);
+      this.grantTimer = null;
+    }
+    if (this.countdownTimer) {
+      clearInterval(this.countdownTimer);
+      this.countdownTimer = null;
+    }
+  }
+}
@@ -0,0 +1,77 @@
+import { createHmac } from "crypto";
+import { afterEach, describe, expect, it, vi } from "vitest";
+import { EventBus } from "./event-bus.service.js";
+import { WebhookService } from "./webhook.service.js";
+
+const createLogger = () => {
+  const logger = {
+    info: vi.fn(),
+    warn: vi.fn(),
+    error: vi.fn(),
+    debug: vi.fn(),
+    fatal: vi.fn(),
+    trace: vi.fn(),
+    silent: vi.fn(),
+    child: vi.fn(),
+    level: "info",
+  };
+  logger.child.mockReturnValue(logger);
+  return logger;
+};
+
+describe("WebhookService", () => {
+  afterEach(() => {
+    vi.unstubAllGlobals();
+  });
+
+  it("delivers configured bus events with a signature", async () => {
+    const fetchMock = vi.fn().mockResolvedValue({ ok: true });
+    vi.stubGlobal("fetch", fetchMock);
+    const logger = createLogger();
+    const bus = new EventBus(logger as any);
+    new WebhookService(logger as any, {
+      urls: ["https://example.com/hook"],
+      events: ["viewer.connected"],
+      secret: "secret",
+    }).attach(bus);
+
+    bus.publish("media.frameSent", { connectionId: "c1", bytes: 10 });
+    bus.publish("viewer.connected", {
+      connectionId: "c1",
+      viewerId: "v1",
+      sessionId: "s1",
+      pageId: null,
+    });
+    await vi.waitFor(() => expect(fetchMock).toHaveBeenCalledTimes(1));
+
+    const [url, init] = fetchMock.mock.calls[0];
+    expect(url).toBe("https://example.com/hook");
+    expect(JSON.parse(init.body)).toMatchObject({
+      event: "viewer.connected",
+      data: { viewerId: "v1" },
+    });
+    const signature = createHmac("sha256", "secret").update(init.body).digest("hex");
+    expect(init.headers["X-Steel-Signature"]).toBe(`sha256=${signature}`);
+  });
+
+  it("retries failed deliveries before giving up", async () => {
+    const fetchMock = vi
+      .fn()
+      .mockRejectedValueOnce(new Error("connection refused"))
+      .mockResolvedValueOnce({ ok: false, status: 502 })
+      .mockResolvedValueOnce({ ok: true });
+    vi.stubGlobal("fetch", fetchMock);
+    const service = new WebhookService(createLogger() as any, {
+      urls: ["https://example.com/hook"],
+      retryDelayMs: 1,
+    });
+
+    await service.deliver("session.paused", { sessionId: "s1" });
+    expect(fetchMock).toHaveBeenCalledTimes(3);
+
+    fetchMock.mockResolvedValue({ ok: false, status: 500 });
+    await expect(service.deliver("session.paused", { sessionId: "s1" })).rejects.toThrow(
+      "failed after 3 attempts",
+    );
+  });
+});
@@ -0,0 +1,103 @@
+import { createHmac } from "crypto";
+import { FastifyBaseLogger } from "fastify";
+import { BusEvents, BusTopic, EventBus } from "./event-bus.service.js";
+
+/** Bus events that are delivered as webhooks unless a narrower list is configured */
+export const WEBHOOK_EVENTS: BusTopic[] = [
+  "session.ended",
+  "session.paused",
+  "session.resumed",
+  "session.resized",
+  "viewer.connected",
+  "viewer.disconnected",
+  "viewer.rejected",
+  "viewer.heartbeatTimeout",
+  "media.firstFrame",
+  "dlp.decision",
+  "maintenance.started",
+  "maintenance.ended",
+];
+
+export interface WebhookOptions {
+  urls: string[];
+  /** Events to deliver, defaults to WEBHOOK_EVENTS */
+  events?: BusTopic[];
+  /** When set, each request carries an HMAC-SHA256 signature of its body */
+  secret?: string;
+  maxAttempts?: number;
+  timeoutMs?: number;
+  retryDelayMs?: number;
+}
+
+/**
+ * Delivers lifecycle events from the event bus to external HTTP endpoints. Deliveries run in the
+ * background and are retried with backoff, so a slow or failing endpoint never delays the
+ * live view.
+ */
+export class WebhookService {
+  private logger: FastifyBaseLogger;
+  private events: Set<BusTopic>;
+
+  constructor(
+    logger: FastifyBaseLogger,
+    private readonly options: WebhookOptions,
+  ) {
+    this.logger = logger.child({ component: "WebhookService" });
+    this.events = new Set(options.events?.length ? options.events : WEBHOOK_EVENTS);
+  }
+
+  /**
+   * @returns a function that stops delivering events from the bus
+   */
+  public attach(eventBus: EventBus): () => void {
+    return eventBus.subscribeAll((topic, payload) => {
+      if (this.events.has(topic)) {
+        this.deliver(topic, payload).catch((err) => {
+          this.logger.error({ err, topic }, "Webhook delivery failed");
+        });
+      }
+    });
+  }
+
+  public async deliver<T extends BusTopic>(topic: T, payload: BusEvents[T]): Promise<void> {
+    const body = JSON.stringify({
+      event: topic,
+      timestamp: new Date().toISOString(),
+      data: payload,
+    });
+    const headers: Record<string, string> = { "Content-Type": "application/json" };
+    if (this.options.secret) {
+      const signature = createHmac("sha256", this.options.secret).update(body).digest("hex");
+      headers["X-Steel-Signature"] = `sha256=${signature}`;
+    }
+
+    await Promise.all(this.options.urls.map((url) => this.post(url, headers, body, topic)));
+  }
+
+  private async post(url: string, headers: Record<string, string>, body: string, topic: string) {
+    const { maxAttempts = 3, timeoutMs = 5000, retryDelayMs = 500 } = this.options;
+
+    for (let attempt = 1; attempt <= maxAttempts; attempt++) {
+      try {
+        const response = await fetch(url, {
+          method: "POST",
+          headers,
+          body,
+          signal: AbortSignal.timeout(timeoutMs),
+        });
+        if (response.ok) {
+          return;
+        }
+        this.logger.warn({ url, topic, status: response.status, attempt }, "Webhook rejected");
+      } catch (err) {
+        this.logger.warn({ err, url, topic, attempt }, "Webhook request failed");
+      }
+
+      if (attempt < maxAttempts) {
+        await new Promise((resolve) => setTimeout(resolve, retryDelayMs * 2 ** (attempt - 1)));
+      }
+    }
+
+    throw new Error(`Webhook ${topic} to ${url} failed after ${maxAttempts} attempts`);
+  }
+}
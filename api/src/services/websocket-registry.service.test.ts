@@ -0,0 +1,32 @@
+import { describe, expect, it } from "vitest";
+import { WebSocketRegistryService } from "./websocket-registry.service.js";
+
+const createHandler = (path: string) => ({ path, handler: () => {} });
+
+describe("WebSocketRegistryService", () => {
+  const registry = new WebSocketRegistryService();
+  const cast = createHandler("/v1/sessions/cast");
+  const sessionCast = createHandler("/v1/sessions/:sessionId/cast");
+  registry.registerHandler(cast);
+  registry.registerHandler(sessionCast);
+
+  it("matches static paths by prefix", () => {
+    expect(registry.match("/v1/sessions/cast?pageId=1")).toEqual({ handler: cast, params: {} });
+  });
+
+  it("captures path parameters", () => {
+    expect(registry.match("/v1/sessions/abc-123/cast?pageId=1")).toEqual({
+      handler: sessionCast,
+      params: { sessionId: "abc-123" },
+    });
+  });
+
+  it("returns undefined when nothing matches", () => {
+    expect(registry.match("/devtools/browser/1")).toBeUndefined();
+    expect(registry.matchHandler("/v1/sessions/abc/logs")).toBeUndefined();
+  });
+
+  it("throws on malformed parameters, for the caller to refuse the URL", () => {
+    expect(() => registry.match("/v1/sessions/%E0%A4%A/cast")).toThrow(URIError);
+  });
+});
@@ -1,4 +1,37 @@
-import { WebSocketHandler, WebSocketHandlerRegistry } from "../types/websocket.js";
+import {
+  WebSocketHandler,
+  WebSocketHandlerMatch,
+  WebSocketHandlerRegistry,
+} from "../types/websocket.js";
+
+const escapeRegExp = (value: string) => value.replace(/[.*+?^${}()|[\]\\]/g, "\\$&");
+
+/**
+ * Matches the start of a URL against a handler path, where `:name` segments capture a parameter
+ * @throws URIError if a captured parameter is not a valid percent-encoded string
+ */
+const matchPath = (path: string, url: string): Record<string, string> | null => {
+  const names: string[] = [];
+  const pattern = path
+    .split("/")
+    .map((segment) => {
+      if (segment.startsWith(":")) {
+        names.push(segment.slice(1));
+        return "([^/?#]+)";
+      }
+      return escapeRegExp(segment);
+    })
+    .join("/");
+
+  const match = new RegExp(`^${pattern}`).exec(url);
+  if (!match) {
+    return null;
+  }
+
+  return Object.fromEntries(
+    names.map((name, index) => [name, decodeURIComponent(match[index + 1])]),
+  );
+};
 
 export class WebSocketRegistryService implements WebSocketHandlerRegistry {
   public handlers = new Map<string, WebSocketHandler>();
@@ -12,11 +45,15 @@ export class WebSocketRegistryService implements WebSocketHandlerRegistry {
   }
 
   matchHandler(url: string): WebSocketHandler | undefined {
-    // TODO: use path-to-regexp or find-my-way to match the path
+    return this.match(url)?.handler;
+  }
+
+  match(url: string): WebSocketHandlerMatch | undefined {
     // Find the first handler whose path matches the start of the URL
     for (const [path, handler] of this.handlers.entries()) {
-      if (url.startsWith(path)) {
-        return handler;
+      const params = matchPath(path, url);
+      if (params) {
+        return { handler, params };
       }
     }
     return undefined;
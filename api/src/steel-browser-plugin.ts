@@ -2,21 +2,33 @@ import fastifyView from "@fastify/view";
 import { FastifyPluginAsync } from "fastify";
 import fp from "fastify-plugin";
 import path, { dirname } from "node:path";
+import authorizerPlugin from "./plugins/authorizer.js";
 import browserInstancePlugin from "./plugins/browser.js";
 import browserSessionPlugin from "./plugins/browser-session.js";
 import browserWebSocket from "./plugins/browser-socket/browser-socket.js";
 import customBodyParser from "./plugins/custom-body-parser.js";
+import dlpPlugin from "./plugins/dlp.js";
+import eventBusPlugin from "./plugins/event-bus.js";
+import featureFlagsPlugin from "./plugins/feature-flags.js";
 import fileStoragePlugin from "./plugins/file-storage.js";
+import maintenancePlugin from "./plugins/maintenance.js";
+import metricsPlugin from "./plugins/metrics.js";
 import requestLogger from "./plugins/request-logger.js";
 import openAPIPlugin from "./plugins/schemas.js";
 import seleniumPlugin from "./plugins/selenium.js";
+import thumbnailsPlugin from "./plugins/thumbnails.js";
+import usagePlugin from "./plugins/usage.js";
+import viewersPlugin from "./plugins/viewers.js";
+import webhooksPlugin from "./plugins/webhooks.js";
 import {
   actionsRoutes,
   cdpRoutes,
   filesRoutes,
   logsRoutes,
+  metricsRoutes,
   seleniumRoutes,
   sessionsRoutes,
+  usageRoutes,
 } from "./routes.js";
 import { fileURLToPath } from "node:url";
 import ejs from "ejs";
@@ -25,6 +37,18 @@ import type { BrowserLauncherOptions } from "./types/browser.js";
 import { WebSocketHandler } from "./types/websocket.js";
 import { WebSocketRegistryService } from "./services/websocket-registry.service.js";
 import { SessionService } from "./services/session.service.js";
+import { ViewerService } from "./services/viewer.service.js";
+import { FeatureFlagService } from "./services/feature-flag.service.js";
+import { MetricsService } from "./services/metrics.service.js";
+import { EventBus } from "./services/event-bus.service.js";
+import { ConnectionHistoryService } from "./services/connection-history.service.js";
+import { Authorizer } from "./services/authorizer.service.js";
+import { DlpService } from "./services/dlp.service.js";
+import { MaintenanceService } from "./services/maintenance.service.js";
+import { UsageService } from "./services/usage.service.js";
+import { ScreencastService } from "./services/screencast.service.js";
+import { ThumbnailService } from "./services/thumbnail.service.js";
+import { WorkQueue } from "./utils/work-queue.js";
 import { LogStorage } from "./services/cdp/instrumentation/storage/log-storage.interface.js";
 
 // We need to redeclare any decorators from within the plugin that we want to expose
@@ -33,6 +57,18 @@ declare module "fastify" {
     steelBrowserConfig: SteelBrowserConfig;
     cdpService: CDPService;
     sessionService: SessionService;
+    viewerService: ViewerService;
+    featureFlags: FeatureFlagService;
+    metrics: MetricsService;
+    eventBus: EventBus;
+    inputQueue: WorkQueue;
+    screencasts: ScreencastService;
+    connectionHistory: ConnectionHistoryService;
+    authorizer: Authorizer;
+    dlp: DlpService;
+    maintenance: MaintenanceService;
+    usage: UsageService;
+    thumbnails: ThumbnailService;
     webSocketRegistry: WebSocketRegistryService;
     registerCDPLaunchHook: (hook: (config: BrowserLauncherOptions) => Promise<void> | void) => void;
     registerCDPShutdownHook: (
@@ -48,6 +84,8 @@ export interface SteelBrowserConfig {
     maxSizePerSession?: number;
   };
   customWsHandlers?: WebSocketHandler[];
+  /** Custom authorization policy, replacing the authorizers configured through the environment */
+  authorizer?: Authorizer;
   logging?: {
     enableStorage?: boolean;
     storagePath?: string;
@@ -66,15 +104,25 @@ const steelBrowserPlugin: FastifyPluginAsync<SteelBrowserConfig> = async (fastif
     root: path.join(dirname(fileURLToPath(import.meta.url)), "templates"),
   });
   await fastify.register(requestLogger);
+  await fastify.register(eventBusPlugin);
+  await fastify.register(webhooksPlugin);
+  await fastify.register(dlpPlugin);
+  await fastify.register(authorizerPlugin, { authorizer: opts.authorizer });
+  await fastify.register(featureFlagsPlugin);
+  await fastify.register(maintenancePlugin);
   await fastify.register(openAPIPlugin);
   await fastify.register(fileStoragePlugin);
   await fastify.register(browserInstancePlugin);
   await fastify.register(seleniumPlugin);
+  await fastify.register(viewersPlugin);
+  await fastify.register(metricsPlugin);
+  await fastify.register(usagePlugin);
   await fastify.register(browserWebSocket, {
     customHandlers: opts.customWsHandlers,
   });
   await fastify.register(customBodyParser);
   await fastify.register(browserSessionPlugin);
+  await fastify.register(thumbnailsPlugin);
 
   // Routes
   await fastify.register(actionsRoutes, { prefix: "/v1" });
@@ -82,6 +130,8 @@ const steelBrowserPlugin: FastifyPluginAsync<SteelBrowserConfig> = async (fastif
   await fastify.register(cdpRoutes, { prefix: "/v1" });
   await fastify.register(seleniumRoutes);
   await fastify.register(filesRoutes, { prefix: "/v1" });
+  await fastify.register(metricsRoutes);
+  await fastify.register(usageRoutes, { prefix: "/v1" });
 
   const enableLogsRoutes = opts.logging?.enableLogsRoutes ?? true;
   if (enableLogsRoutes) {
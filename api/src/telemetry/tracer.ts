@@ -61,6 +61,18 @@ export const tracer = {
       }
     });
   },
+  /**
+   * Starts a span that the caller ends, for work that does not fit in a single callback such as
+   * event handlers with early returns
+   */
+  startSpan(name: string, opts?: Omit<TracerOptions, "spanName">): Span {
+    if (!otel) {
+      return noopSpan;
+    }
+
+    const { tracerName, ...options } = opts ?? {};
+    return otel.trace.getTracer(tracerName ?? "steel").startSpan(name, options);
+  },
   factory(tracerName: string) {
     return {
       startActiveSpan<F extends (span: Span) => unknown>(
@@ -70,6 +82,9 @@ export const tracer = {
       ): ReturnType<F> {
         return tracer.startActiveSpan(name, fn, { ...opts, tracerName });
       },
+      startSpan(name: string, opts?: Omit<TracerOptions, "spanName" | "tracerName">): Span {
+        return tracer.startSpan(name, { ...opts, tracerName });
+      },
     };
   },
 };
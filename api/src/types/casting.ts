@@ -1,3 +1,6 @@
+import type { KeyboardLayout } from "../utils/keyboard-layouts.js";
+import type { StreamQualityPreset } from "../utils/stream-quality.js";
+
 export type MouseEvent = {
   type: "mouseEvent";
   pageId: string;
@@ -13,6 +16,48 @@ export type MouseEvent = {
   };
 };
 
+export type TouchPoint = {
+  /** Identifier of the finger, stable for the duration of the touch */
+  id: number;
+  x: number;
+  y: number;
+  radiusX?: number;
+  radiusY?: number;
+  force?: number;
+};
+
+/**
+ * Touch input from a viewer. touchPoints lists the touches that are still active after the
+ * event, like TouchEvent.touches in the DOM.
+ */
+export type TouchEvent = {
+  type: "touch";
+  pageId: string;
+  event: {
+    type: "touchStart" | "touchMove" | "touchEnd" | "touchCancel";
+    touchPoints: TouchPoint[];
+    modifiers: number;
+  };
+};
+
+/**
+ * Two-finger gesture recognized by the viewer. Pinches zoom like Ctrl+scroll, scrolls pan the page
+ * under the gesture.
+ */
+export type GestureEvent = {
+  type: "gesture";
+  pageId: string;
+  event:
+    | {
+        type: "pinch";
+        x: number;
+        y: number;
+        /** Change in finger distance since the previous pinch message, e.g. 1.1 to zoom in */
+        scale: number;
+      }
+    | { type: "scroll"; x: number; y: number; deltaX: number; deltaY: number };
+};
+
 export type KeyEvent = {
   type: "keyEvent";
   pageId: string;
@@ -26,6 +71,77 @@ export type KeyEvent = {
   };
 };
 
+/**
+ * Switches the keyboard layout the viewer's key events are read in
+ */
+export type KeyboardLayoutEvent = {
+  type: "keyboardLayout";
+  pageId: string;
+  layout: KeyboardLayout;
+};
+
+/**
+ * Presses a key combination such as "Control+Shift+T" in one message
+ */
+export type KeyComboEvent = {
+  type: "keyCombo";
+  pageId: string;
+  combo: string;
+};
+
+/**
+ * Committed text that did not come from individual key presses, e.g. from an IME composition
+ */
+export type TextInputEvent = {
+  type: "textInput";
+  pageId: string;
+  text: string;
+};
+
+/**
+ * Types or pastes a secret staged for the session into the focused element. The viewer only
+ * names the secret and never sees its value.
+ */
+export type PasteSecretEvent = {
+  type: "pasteSecret";
+  pageId: string;
+  name: string;
+  mode?: "type" | "paste";
+};
+
+/**
+ * Announces a file the viewer dropped into the live view. Its content follows as binary chunks
+ * and a fileUploadEnd. With a position, the saved file is dropped into the page there, which
+ * fills file inputs and drop zones.
+ */
+export type FileUploadStartEvent = {
+  type: "fileUploadStart";
+  pageId: string;
+  /** Chosen by the viewer, unique among its uploads in progress */
+  uploadId: number;
+  name: string;
+  size: number;
+  mimeType?: string;
+  x?: number;
+  y?: number;
+};
+
+/**
+ * The next part of a file's content, always sent as a binary message
+ */
+export type FileUploadChunkEvent = {
+  type: "fileUploadChunk";
+  pageId: string;
+  uploadId: number;
+  data: Uint8Array;
+};
+
+export type FileUploadEndEvent = {
+  type: "fileUploadEnd" | "fileUploadCancel";
+  pageId: string;
+  uploadId: number;
+};
+
 export type NavigationEvent = {
   type: "navigation";
   pageId: string;
@@ -40,22 +156,124 @@ export type CloseTabEvent = {
   pageId: string;
 };
 
+export type ClipboardContentType = "text/plain" | "text/html";
+
 export type ClipboardWriteEvent = {
   type: "clipboardWrite";
   pageId: string;
   event: {
     text: string;
+    html?: string;
+    /**
+     * "paste" inserts the content at once and falls back to typing if the page blocks paste,
+     * "type" always simulates typing
+     */
+    mode?: "paste" | "type";
+    /** Delay between typed characters in milliseconds */
+    delayMs?: number;
   };
 };
 
-export type ClipboardReadEvent = {
-  type: "clipboardRead";
+/**
+ * Also sent as clipboardRead by older viewers. That type is deprecated and is parsed into this one.
+ */
+export type GetSelectedTextEvent = {
+  type: "getSelectedText";
   pageId: string;
+  formats?: ClipboardContentType[];
 };
 
-export type GetSelectedTextEvent = {
-  type: "getSelectedText";
+/**
+ * Sent by viewers whose local clipboard changed while the session has clipboard sync enabled
+ */
+export type ClipboardSyncEvent = {
+  type: "clipboardSync";
   pageId: string;
+  text: string;
+  html?: string;
+};
+
+export type ClipboardContent = {
+  text: string;
+  html?: string;
+};
+
+/**
+ * Outcome of a paste, checked by reading the focused element back after inserting the content
+ */
+export type PasteResult = "pasted" | "blocked" | "notEditable" | "notApplied";
+
+export type RecordingConsentEvent = {
+  type: "recordingConsent";
+  pageId: string;
+};
+
+export type GrantControlEvent = {
+  type: "grantControl";
+  pageId: string;
+  viewerId: string;
+  durationMs: number;
+};
+
+export type WindowAction = "minimize" | "maximize" | "restore" | "nextWindow" | "closeDialog";
+
+export type WindowEvent = {
+  type: "window";
+  pageId: string;
+  event: {
+    action: WindowAction;
+  };
+};
+
+export type PauseSessionEvent = {
+  type: "pauseSession" | "resumeSession";
+  pageId: string;
+};
+
+/**
+ * Sent by viewers when their network connection changed, e.g. from Wi-Fi to cellular
+ */
+export type NetworkChangedEvent = {
+  type: "networkChanged";
+  pageId: string;
+  connectionType?: string;
+};
+
+export type StreamQualityEvent = {
+  type: "quality";
+  pageId: string;
+  preset: StreamQualityPreset;
+  quality?: number;
+  maxFps?: number | null;
+  maxBitrateKbps?: number | null;
+};
+
+export type CastMessage = (
+  | MouseEvent
+  | TouchEvent
+  | GestureEvent
+  | KeyEvent
+  | KeyComboEvent
+  | KeyboardLayoutEvent
+  | TextInputEvent
+  | PasteSecretEvent
+  | FileUploadStartEvent
+  | FileUploadChunkEvent
+  | FileUploadEndEvent
+  | NavigationEvent
+  | CloseTabEvent
+  | GetSelectedTextEvent
+  | ClipboardWriteEvent
+  | ClipboardSyncEvent
+  | RecordingConsentEvent
+  | GrantControlEvent
+  | WindowEvent
+  | PauseSessionEvent
+  | NetworkChangedEvent
+  | StreamQualityEvent
+) & {
+  /** When the viewer sent the message, in milliseconds since the epoch on the viewer's clock */
+  ts?: number;
 };
 
 export type PageInfo = {
@@ -64,3 +282,8 @@ export type PageInfo = {
   title: string;
   favicon: string | null;
 };
+
+export type ScreencastSettings = {
+  format: "jpeg" | "png";
+  quality?: number;
+};
@@ -29,4 +29,5 @@ export enum EmitEvent {
   Log = "log",
   PageId = "pageId",
   Recording = "recording",
+  RecordingStarted = "recordingStarted",
 }
@@ -4,6 +4,18 @@ import { SessionService } from "../services/session.service.js";
 import { SeleniumService } from "../services/selenium.service.js";
 import { Page } from "puppeteer-core";
 import { FileService } from "../services/file.service.js";
+import { ViewerService } from "../services/viewer.service.js";
+import { FeatureFlagService } from "../services/feature-flag.service.js";
+import { MetricsService } from "../services/metrics.service.js";
+import { EventBus } from "../services/event-bus.service.js";
+import { ConnectionHistoryService } from "../services/connection-history.service.js";
+import { Authorizer } from "../services/authorizer.service.js";
+import { DlpService } from "../services/dlp.service.js";
+import { MaintenanceService } from "../services/maintenance.service.js";
+import { UsageService } from "../services/usage.service.js";
+import { ScreencastService } from "../services/screencast.service.js";
+import { ThumbnailService } from "../services/thumbnail.service.js";
+import { WorkQueue } from "../utils/work-queue.js";
 
 declare module "fastify" {
   interface FastifyRequest {}
@@ -11,5 +23,17 @@ declare module "fastify" {
     seleniumService: SeleniumService;
     sessionService: SessionService;
     fileService: FileService;
+    viewerService: ViewerService;
+    featureFlags: FeatureFlagService;
+    metrics: MetricsService;
+    eventBus: EventBus;
+    inputQueue: WorkQueue;
+    screencasts: ScreencastService;
+    connectionHistory: ConnectionHistoryService;
+    authorizer: Authorizer;
+    dlp: DlpService;
+    maintenance: MaintenanceService;
+    usage: UsageService;
+    thumbnails: ThumbnailService;
   }
 }
@@ -11,6 +11,11 @@ export interface WebSocketHandlerContext {
 
 export interface WebSocketHandler {
   path: string;
+  /**
+   * Set for handlers that authorize their connections with Authorizer.checkUpgrade themselves,
+   * instead of requiring admin access
+   */
+  authorizesUpgrade?: boolean;
   handler: (
     request: IncomingMessage,
     socket: Duplex,
@@ -19,9 +24,17 @@ export interface WebSocketHandler {
   ) => Promise<void> | void;
 }
 
+export interface WebSocketHandlerMatch {
+  handler: WebSocketHandler;
+  /** Values of the `:name` segments in the handler path */
+  params: Record<string, string>;
+}
+
 export interface WebSocketHandlerRegistry {
   handlers: Map<string, WebSocketHandler>;
   registerHandler: (handler: WebSocketHandler) => void;
   getHandler: (path: string) => WebSocketHandler | undefined;
   matchHandler: (url: string) => WebSocketHandler | undefined;
+  /** @throws URIError if the URL has a malformed percent-encoded parameter */
+  match: (url: string) => WebSocketHandlerMatch | undefined;
 }
@@ -1,6 +1,6 @@
 import fs from "fs";
 import path from "path";
-import { Page } from "puppeteer-core";
+import { Page, Target } from "puppeteer-core";
 import { env } from "../env.js";
 
 export const getChromeExecutablePath = () => {
@@ -163,3 +163,15 @@ export function filterHeaders(headers: Record<string, string>) {
   });
   return filteredHeaders;
 }
+
+/**
+ * Id of the CDP target behind a page or target, which is also the page id viewers use. Puppeteer
+ * only keeps it in a private field, so this is the one place that reads it.
+ */
+export function getTargetId(pageOrTarget: Page | Target): string {
+  const target =
+    typeof (pageOrTarget as Page).target === "function"
+      ? (pageOrTarget as Page).target()
+      : (pageOrTarget as Target);
+  return (target as any)._targetId as string;
+}
@@ -0,0 +1,55 @@
+import fs from "fs";
+import path, { dirname } from "path";
+import { fileURLToPath } from "url";
+import { env } from "../env.js";
+
+export interface BuildInfo {
+  version: string;
+  gitSha: string | null;
+  buildDate: string | null;
+  nodeVersion: string;
+  puppeteerVersion: string | null;
+  features: string[];
+}
+
+// Resolves to the package root from both src/utils and build/utils
+const PACKAGE_JSON_PATH = path.join(dirname(fileURLToPath(import.meta.url)), "../../package.json");
+
+let buildInfo: BuildInfo | null = null;
+
+const getEnabledFeatures = (): string[] => {
+  const features: Record<string, boolean> = {
+    signedFileUrls: env.REQUIRE_SIGNED_FILE_URLS,
+    recordingConsent: env.RECORDING_REQUIRE_CONSENT,
+    liveViewFocus: env.LIVE_VIEW_ENSURE_FOCUS,
+    logStorage: env.LOG_STORAGE_ENABLED,
+  };
+  return Object.keys(features).filter((feature) => features[feature]);
+};
+
+/**
+ * Returns metadata identifying this build, so bug reports can be matched to an exact build.
+ * The git SHA and build date are baked into the image at build time.
+ */
+export const getBuildInfo = (): BuildInfo => {
+  if (buildInfo) {
+    return buildInfo;
+  }
+
+  let packageJson: { version?: string; dependencies?: Record<string, string> } = {};
+  try {
+    packageJson = JSON.parse(fs.readFileSync(PACKAGE_JSON_PATH, "utf-8"));
+  } catch {
+    // Running from an unusual layout, report what is known
+  }
+
+  buildInfo = {
+    version: packageJson.version ?? "unknown",
+    gitSha: env.BUILD_GIT_SHA || null,
+    buildDate: env.BUILD_DATE || null,
+    nodeVersion: process.version,
+    puppeteerVersion: packageJson.dependencies?.["puppeteer-core"] ?? null,
+    features: getEnabledFeatures(),
+  };
+  return buildInfo;
+};
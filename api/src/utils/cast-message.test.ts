@@ -0,0 +1,256 @@
+import { describe, expect, it } from "vitest";
+import {
+  BINARY_FILE_CHUNK,
+  BINARY_MOUSE_MOVE,
+  MAX_FILE_CHUNK_BYTES,
+  parseBinaryCastMessage,
+  parseCastMessage,
+} from "./cast-message.js";
+
+const viewport = { width: 1920, height: 1080 };
+
+const mouseEvent = (event: Record<string, unknown>) =>
+  JSON.stringify({
+    type: "mouseEvent",
+    pageId: "page",
+    event: { type: "mouseMoved", x: 10, y: 20, button: "none", modifiers: 0, ...event },
+  });
+
+describe("parseCastMessage", () => {
+  it("accepts well-formed messages", () => {
+    expect(parseCastMessage(mouseEvent({}), viewport)).toEqual({
+      type: "mouseEvent",
+      pageId: "page",
+      event: { type: "mouseMoved", x: 10, y: 20, button: "none", modifiers: 0 },
+    });
+    expect(
+      parseCastMessage(
+        JSON.stringify({
+          type: "keyEvent",
+          pageId: "page",
+          event: { type: "keyDown", code: "KeyA", key: "a", keyCode: 65, text: "a" },
+        }),
+        viewport,
+      ),
+    ).not.toBeNull();
+  });
+
+  it("keeps the viewer's send time of a message", () => {
+    const message = (ts: unknown) =>
+      parseCastMessage(JSON.stringify({ type: "closeTab", pageId: "page", ts }), viewport);
+    expect(message(1_700_000_000_123)).toEqual({
+      type: "closeTab",
+      pageId: "page",
+      ts: 1_700_000_000_123,
+    });
+    expect(message("yesterday")).toEqual({ type: "closeTab", pageId: "page" });
+    expect(message(-1)).toEqual({ type: "closeTab", pageId: "page" });
+  });
+
+  it("accepts quality presets with overrides", () => {
+    const quality = (fields: Record<string, unknown>) =>
+      parseCastMessage(JSON.stringify({ type: "quality", pageId: "page", ...fields }), viewport);
+
+    expect(quality({ preset: "low" })).toEqual({ type: "quality", pageId: "page", preset: "low" });
+    expect(quality({ preset: "custom", maxFps: 15, maxBitrateKbps: null })).not.toBeNull();
+    expect(quality({ preset: "ultra" })).toBeNull();
+    expect(quality({ preset: "custom", maxFps: 240 })).toBeNull();
+  });
+
+  it("accepts committed text in any script", () => {
+    const text = "日本語 👍🏽";
+    expect(
+      parseCastMessage(JSON.stringify({ type: "textInput", pageId: "page", text }), viewport),
+    ).toEqual({ type: "textInput", pageId: "page", text });
+    expect(
+      parseCastMessage(JSON.stringify({ type: "textInput", pageId: "page", text: "" }), viewport),
+    ).toBeNull();
+  });
+
+  it("accepts touches and clamps their points to the viewport", () => {
+    const touch = (event: Record<string, unknown>) =>
+      parseCastMessage(JSON.stringify({ type: "touch", pageId: "page", event }), viewport);
+
+    expect(
+      touch({ type: "touchStart", touchPoints: [{ id: 3, x: 5000, y: -10, force: 0.5 }] }),
+    ).toEqual({
+      type: "touch",
+      pageId: "page",
+      event: {
+        type: "touchStart",
+        touchPoints: [{ id: 3, x: 1919, y: 0, force: 0.5 }],
+        modifiers: 0,
+      },
+    });
+    expect(touch({ type: "touchEnd", touchPoints: [] })).not.toBeNull();
+    expect(touch({ type: "touchMove", touchPoints: [] })).toBeNull();
+  });
+
+  it("accepts pinch and scroll gestures", () => {
+    const gesture = (event: Record<string, unknown>) =>
+      parseCastMessage(JSON.stringify({ type: "gesture", pageId: "page", event }), viewport);
+
+    expect(gesture({ type: "pinch", x: 3000, y: 10, scale: 1.2 })).toEqual({
+      type: "gesture",
+      pageId: "page",
+      event: { type: "pinch", x: 1919, y: 10, scale: 1.2 },
+    });
+    expect(gesture({ type: "scroll", x: 1, y: 1, deltaX: 0, deltaY: -40 })).not.toBeNull();
+    expect(gesture({ type: "pinch", x: 1, y: 1, scale: 0 })).toBeNull();
+  });
+
+  it("fills in key codes and text from the key", () => {
+    const keyEvent = (event: Record<string, unknown>) =>
+      parseCastMessage(JSON.stringify({ type: "keyEvent", pageId: "page", event }), viewport);
+
+    expect(keyEvent({ type: "keyDown", key: "Enter" })).toMatchObject({
+      event: { key: "Enter", code: "Enter", keyCode: 13, text: "\r" },
+    });
+    expect(keyEvent({ type: "keyDown", key: "esc" })).toMatchObject({
+      event: { key: "Escape", code: "Escape", keyCode: 27 },
+    });
+    // Codes sent by the viewer win, and shortcuts do not type
+    const shortcut = keyEvent({ type: "keyDown", key: "Enter", code: "NumpadEnter", modifiers: 2 });
+    expect(shortcut).toMatchObject({ event: { code: "NumpadEnter", keyCode: 13 } });
+    expect(shortcut?.type === "keyEvent" && shortcut.event.text).toBeUndefined();
+  });
+
+  it("reads codes in the viewer's keyboard layout", () => {
+    const keyEvent = (event: Record<string, unknown>, layout?: "us" | "de") =>
+      parseCastMessage(
+        JSON.stringify({ type: "keyEvent", pageId: "page", event }),
+        viewport,
+        layout,
+      );
+
+    expect(keyEvent({ type: "keyDown", code: "KeyY" })).toMatchObject({
+      event: { key: "y", code: "KeyY", keyCode: 89, text: "y" },
+    });
+    expect(keyEvent({ type: "keyDown", code: "KeyY" }, "de")).toMatchObject({
+      event: { key: "z", code: "KeyY", keyCode: 90, text: "z" },
+    });
+    expect(keyEvent({ type: "keyDown", code: "ShiftRight", modifiers: 8 }, "de")).toMatchObject({
+      event: { key: "Shift", code: "ShiftRight", keyCode: 16 },
+    });
+    expect(keyEvent({ type: "keyDown", code: "Unknown" })).toBeNull();
+    expect(keyEvent({ type: "keyDown" })).toBeNull();
+  });
+
+  it("accepts known key combos only", () => {
+    const keyCombo = (combo: string) =>
+      parseCastMessage(JSON.stringify({ type: "keyCombo", pageId: "page", combo }), viewport);
+
+    expect(keyCombo("Control+Shift+T")).toEqual({
+      type: "keyCombo",
+      pageId: "page",
+      combo: "Control+Shift+T",
+    });
+    expect(keyCombo("Hyper+T")).toBeNull();
+  });
+
+  it("accepts file uploads and clamps where they are dropped", () => {
+    const upload = (message: Record<string, unknown>) =>
+      parseCastMessage(JSON.stringify({ pageId: "page", uploadId: 1, ...message }), viewport);
+
+    expect(
+      upload({ type: "fileUploadStart", name: "report.pdf", size: 1024, x: 5000, y: 10 }),
+    ).toMatchObject({ type: "fileUploadStart", uploadId: 1, x: 1919, y: 10 });
+    expect(upload({ type: "fileUploadStart", uploadId: -1, name: "a", size: 1 })).toBeNull();
+    expect(upload({ type: "fileUploadEnd" })).toEqual({
+      type: "fileUploadEnd",
+      pageId: "page",
+      uploadId: 1,
+    });
+  });
+
+  it("clamps coordinates to the viewport", () => {
+    const message = parseCastMessage(mouseEvent({ x: -50, y: 99_999 }), viewport);
+    expect(message?.type === "mouseEvent" && message.event).toMatchObject({ x: 0, y: 1079 });
+  });
+
+  it("caps click counts", () => {
+    const message = parseCastMessage(mouseEvent({ clickCount: 12 }), viewport);
+    expect(message?.type === "mouseEvent" && message.event.clickCount).toBe(3);
+  });
+
+  it.each([
+    ["invalid JSON", "{"],
+    ["non-object payloads", "42"],
+    ["unknown message types", JSON.stringify({ type: "shell", pageId: "page" })],
+    ["non-numeric coordinates", mouseEvent({ x: "10" })],
+    ["out-of-range coordinates", mouseEvent({ x: 1e12 })],
+    ["unknown buttons", mouseEvent({ button: "back" })],
+    ["invalid modifiers", mouseEvent({ modifiers: 1024 })],
+    [
+      "overlong keys",
+      JSON.stringify({
+        type: "keyEvent",
+        pageId: "page",
+        event: { type: "keyDown", code: "KeyA", key: "a".repeat(1000), keyCode: 65 },
+      }),
+    ],
+  ])("rejects %s", (_, raw) => {
+    expect(parseCastMessage(raw, viewport)).toBeNull();
+  });
+
+  it("reads the deprecated clipboardRead as getSelectedText", () => {
+    expect(
+      parseCastMessage(JSON.stringify({ type: "clipboardRead", pageId: "page" }), viewport),
+    ).toEqual({ type: "getSelectedText", pageId: "page" });
+  });
+
+  it("never throws on mutated payloads", () => {
+    const values = [null, -1, 0, 1e308, "", "x".repeat(10_000), [], {}, true];
+    const base = JSON.parse(mouseEvent({}));
+
+    for (const key of Object.keys(base.event)) {
+      for (const value of values) {
+        const raw = JSON.stringify({ ...base, event: { ...base.event, [key]: value } });
+        expect(() => parseCastMessage(raw, viewport)).not.toThrow();
+      }
+    }
+  });
+});
+
+describe("parseBinaryCastMessage", () => {
+  const mouseMove = (x: number, y: number, modifiers: number, opcode = BINARY_MOUSE_MOVE) => {
+    const view = new DataView(new ArrayBuffer(10));
+    view.setUint8(0, opcode);
+    view.setFloat32(1, x, true);
+    view.setFloat32(5, y, true);
+    view.setUint8(9, modifiers);
+    return new Uint8Array(view.buffer);
+  };
+
+  it("decodes compact mouse moves and clamps them to the viewport", () => {
+    expect(parseBinaryCastMessage(mouseMove(10.5, 5000, 2), viewport)).toEqual({
+      type: "mouseEvent",
+      pageId: "",
+      event: { type: "mouseMoved", x: 10.5, y: 1079, button: "none", modifiers: 2 },
+    });
+  });
+
+  it("rejects unknown opcodes, bad lengths and invalid values", () => {
+    expect(parseBinaryCastMessage(mouseMove(1, 1, 0, 0x7f), viewport)).toBeNull();
+    expect(parseBinaryCastMessage(new Uint8Array([BINARY_MOUSE_MOVE, 0, 0]), viewport)).toBeNull();
+    expect(parseBinaryCastMessage(mouseMove(NaN, 1, 0), viewport)).toBeNull();
+    expect(parseBinaryCastMessage(mouseMove(1, 1, 64), viewport)).toBeNull();
+  });
+
+  it("decodes file chunks", () => {
+    const chunk = new Uint8Array([BINARY_FILE_CHUNK, 7, 1, 0, 0, 104, 105]);
+    const message = parseBinaryCastMessage(chunk, viewport);
+
+    expect(message).toMatchObject({ type: "fileUploadChunk", uploadId: 263 });
+    expect(message?.type === "fileUploadChunk" && Array.from(message.data)).toEqual([104, 105]);
+  });
+
+  it("rejects empty and oversized file chunks", () => {
+    const empty = new Uint8Array([BINARY_FILE_CHUNK, 1, 0, 0, 0]);
+    const oversized = new Uint8Array(5 + MAX_FILE_CHUNK_BYTES + 1);
+    oversized[0] = BINARY_FILE_CHUNK;
+
+    expect(parseBinaryCastMessage(empty, viewport)).toBeNull();
+    expect(parseBinaryCastMessage(oversized, viewport)).toBeNull();
+  });
+});
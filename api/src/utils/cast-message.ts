@@ -0,0 +1,363 @@
+import { z } from "zod";
+import { CastMessage } from "../types/casting.js";
+import { applyKeyboardLayout, KEYBOARD_LAYOUTS, KeyboardLayout } from "./keyboard-layouts.js";
+import { MODIFIERS, parseKeyCombo, resolveCode, resolveKey } from "./keymap.js";
+import { STREAM_QUALITY_PRESETS } from "./stream-quality.js";
+
+const MAX_COORDINATE = 100_000;
+const MAX_SCROLL_DELTA = 10_000;
+const MAX_TOUCH_POINTS = 10;
+const MAX_KEY_LENGTH = 32;
+const MAX_KEY_TEXT_LENGTH = 64;
+const MAX_TEXT_INPUT_LENGTH = 4096;
+const MAX_URL_LENGTH = 8192;
+const MAX_CLIPBOARD_LENGTH = 1_000_000;
+const MAX_ID_LENGTH = 256;
+const MAX_FILE_NAME_LENGTH = 255;
+const MAX_UPLOAD_ID = 0xffffffff;
+
+const id = z.string().max(MAX_ID_LENGTH);
+const coordinate = z.number().finite().min(-MAX_COORDINATE).max(MAX_COORDINATE);
+const scrollDelta = z.number().finite().min(-MAX_SCROLL_DELTA).max(MAX_SCROLL_DELTA);
+const modifiers = z.number().int().min(0).max(15);
+const uploadId = z.number().int().min(0).max(MAX_UPLOAD_ID);
+const clientTimestamp = z.number().finite().positive();
+
+const castMessageSchema = z.discriminatedUnion("type", [
+  z.object({
+    type: z.literal("mouseEvent"),
+    pageId: id,
+    event: z.object({
+      type: z.enum(["mousePressed", "mouseReleased", "mouseWheel", "mouseMoved"]),
+      x: coordinate,
+      y: coordinate,
+      button: z.enum(["none", "left", "middle", "right"]),
+      modifiers: modifiers.default(0),
+      // Browsers keep counting on rapid clicks, Chrome only distinguishes up to triple clicks
+      clickCount: z
+        .number()
+        .int()
+        .min(0)
+        .transform((count) => Math.min(count, 3))
+        .optional(),
+      deltaX: scrollDelta.optional(),
+      deltaY: scrollDelta.optional(),
+    }),
+  }),
+  z.object({
+    type: z.literal("touch"),
+    pageId: id,
+    event: z
+      .object({
+        type: z.enum(["touchStart", "touchMove", "touchEnd", "touchCancel"]),
+        touchPoints: z
+          .array(
+            z.object({
+              id: z.number().int().min(0),
+              x: coordinate,
+              y: coordinate,
+              radiusX: z.number().finite().min(0).max(MAX_COORDINATE).optional(),
+              radiusY: z.number().finite().min(0).max(MAX_COORDINATE).optional(),
+              force: z.number().finite().min(0).max(1).optional(),
+            }),
+          )
+          .max(MAX_TOUCH_POINTS),
+        modifiers: modifiers.default(0),
+      })
+      .refine(
+        (event) =>
+          event.touchPoints.length > 0 || event.type === "touchEnd" || event.type === "touchCancel",
+        "Touches that start or move need at least one touch point",
+      ),
+  }),
+  z.object({
+    type: z.literal("gesture"),
+    pageId: id,
+    event: z.discriminatedUnion("type", [
+      z.object({
+        type: z.literal("pinch"),
+        x: coordinate,
+        y: coordinate,
+        scale: z.number().finite().min(0.1).max(10),
+      }),
+      z.object({
+        type: z.literal("scroll"),
+        x: coordinate,
+        y: coordinate,
+        deltaX: scrollDelta,
+        deltaY: scrollDelta,
+      }),
+    ]),
+  }),
+  z.object({
+    type: z.literal("keyEvent"),
+    pageId: id,
+    event: z
+      .object({
+        type: z.enum(["keyDown", "keyUp", "char"]),
+        text: z.string().max(MAX_KEY_TEXT_LENGTH).optional(),
+        // Either is filled in from the other when missing
+        code: z.string().max(MAX_KEY_LENGTH).optional(),
+        key: z.string().max(MAX_KEY_LENGTH).optional(),
+        keyCode: z.number().int().min(0).max(255).optional(),
+        modifiers: modifiers.optional(),
+      })
+      .refine((event) => event.key !== undefined || !!event.code, "Keys need a key or a code"),
+  }),
+  z.object({
+    type: z.literal("keyboardLayout"),
+    pageId: id,
+    layout: z.enum(KEYBOARD_LAYOUTS),
+  }),
+  z.object({
+    type: z.literal("keyCombo"),
+    pageId: id,
+    combo: z
+      .string()
+      .max(MAX_KEY_LENGTH * 4)
+      .refine((combo) => parseKeyCombo(combo) !== null, "Unknown key or modifier"),
+  }),
+  z.object({
+    type: z.literal("textInput"),
+    pageId: id,
+    text: z.string().min(1).max(MAX_TEXT_INPUT_LENGTH),
+  }),
+  z.object({
+    type: z.literal("pasteSecret"),
+    pageId: id,
+    name: z.string().min(1).max(64),
+    mode: z.enum(["type", "paste"]).optional(),
+  }),
+  z.object({
+    type: z.literal("fileUploadStart"),
+    pageId: id,
+    uploadId,
+    name: z.string().min(1).max(MAX_FILE_NAME_LENGTH),
+    size: z.number().int().min(0),
+    mimeType: z.string().max(MAX_ID_LENGTH).optional(),
+    x: coordinate.optional(),
+    y: coordinate.optional(),
+  }),
+  z.object({ type: z.literal("fileUploadEnd"), pageId: id, uploadId }),
+  z.object({ type: z.literal("fileUploadCancel"), pageId: id, uploadId }),
+  z.object({
+    type: z.literal("navigation"),
+    pageId: id,
+    event: z.object({
+      url: z.string().max(MAX_URL_LENGTH).optional(),
+      action: z.enum(["back", "forward", "refresh"]).optional(),
+    }),
+  }),
+  z.object({ type: z.literal("closeTab"), pageId: id }),
+  /** @deprecated read as a getSelectedText message, use that instead */
+  z.object({ type: z.literal("clipboardRead"), pageId: id }),
+  z.object({
+    type: z.literal("getSelectedText"),
+    pageId: id,
+    formats: z.array(z.enum(["text/plain", "text/html"])).max(2).optional(),
+  }),
+  z.object({
+    type: z.literal("clipboardWrite"),
+    pageId: id,
+    event: z.object({
+      text: z.string().max(MAX_CLIPBOARD_LENGTH),
+      html: z.string().max(MAX_CLIPBOARD_LENGTH).optional(),
+      mode: z.enum(["paste", "type"]).optional(),
+      delayMs: z.number().finite().min(0).max(1000).optional(),
+    }),
+  }),
+  z.object({
+    type: z.literal("clipboardSync"),
+    pageId: id,
+    text: z.string().min(1).max(MAX_CLIPBOARD_LENGTH),
+    html: z.string().max(MAX_CLIPBOARD_LENGTH).optional(),
+  }),
+  z.object({ type: z.literal("recordingConsent"), pageId: id }),
+  z.object({ type: z.literal("pauseSession"), pageId: id }),
+  z.object({
+    type: z.literal("networkChanged"),
+    pageId: id,
+    connectionType: z.string().max(MAX_KEY_LENGTH).optional(),
+  }),
+  z.object({ type: z.literal("resumeSession"), pageId: id }),
+  z.object({
+    type: z.literal("quality"),
+    pageId: id,
+    preset: z.enum(STREAM_QUALITY_PRESETS),
+    quality: z.number().int().min(10).max(100).optional(),
+    maxFps: z.number().finite().positive().max(60).nullable().optional(),
+    maxBitrateKbps: z.number().finite().positive().nullable().optional(),
+  }),
+  z.object({
+    type: z.literal("grantControl"),
+    pageId: id,
+    viewerId: id,
+    durationMs: z.number().finite().positive(),
+  }),
+  z.object({
+    type: z.literal("window"),
+    pageId: id,
+    event: z.object({
+      action: z.enum(["minimize", "maximize", "restore", "nextWindow", "closeDialog"]),
+    }),
+  }),
+]);
+
+/**
+ * Parses a raw message from a cast WebSocket into a typed message.
+ * Anything that is not a well-formed message within the limits above is rejected, and pointer
+ * coordinates are clamped to the viewport so crafted payloads cannot reach outside of it. Key
+ * events are read in the keyboard layout of the viewer that sent them. A numeric ts on any message
+ * is kept as the viewer's send time.
+ * @returns the parsed message, or null if the message was rejected
+ */
+export const parseCastMessage = (
+  raw: string,
+  viewport: { width: number; height: number },
+  keyboardLayout: KeyboardLayout = "us",
+): CastMessage | null => {
+  let json: unknown;
+  try {
+    json = JSON.parse(raw);
+  } catch {
+    return null;
+  }
+
+  const result = castMessageSchema.safeParse(json);
+  if (!result.success) {
+    return null;
+  }
+
+  // clipboardRead used to be accepted without an answer, older viewers get the selection instead
+  const message = (
+    result.data.type === "clipboardRead"
+      ? { type: "getSelectedText", pageId: result.data.pageId }
+      : result.data
+  ) as CastMessage;
+  // Any message may carry the viewer's send time, which is only recorded, never trusted
+  const ts = clientTimestamp.safeParse((json as { ts?: unknown }).ts);
+  if (ts.success) {
+    message.ts = ts.data;
+  }
+  if (message.type === "mouseEvent" || message.type === "gesture") {
+    message.event.x = clamp(message.event.x, 0, Math.max(viewport.width - 1, 0));
+    message.event.y = clamp(message.event.y, 0, Math.max(viewport.height - 1, 0));
+  }
+  if (message.type === "touch") {
+    for (const point of message.event.touchPoints) {
+      point.x = clamp(point.x, 0, Math.max(viewport.width - 1, 0));
+      point.y = clamp(point.y, 0, Math.max(viewport.height - 1, 0));
+    }
+  }
+  if (message.type === "fileUploadStart" && message.x !== undefined && message.y !== undefined) {
+    message.x = clamp(message.x, 0, Math.max(viewport.width - 1, 0));
+    message.y = clamp(message.y, 0, Math.max(viewport.height - 1, 0));
+  }
+  if (message.type === "keyEvent") {
+    applyKeyboardLayout(message.event, keyboardLayout);
+    if (!normalizeKeyEvent(message.event)) {
+      return null;
+    }
+  }
+  return message;
+};
+
+const COMMAND_MODIFIERS = MODIFIERS.Control | MODIFIERS.Alt | MODIFIERS.Meta;
+
+type KeyEventFields = Parameters<typeof applyKeyboardLayout>[0];
+
+/**
+ * Completes key events that only name the key, e.g. { key: "Esc" } from a script, with the code
+ * and key code Chrome needs to act on them, and events that only name the code of a key that
+ * types no character, e.g. { code: "ShiftRight" }. Keys like Enter only do something in the page
+ * when they carry their text, which browsers do not report as the key value.
+ * @returns false if the key could not be determined
+ */
+const normalizeKeyEvent = (event: KeyEventFields): boolean => {
+  const definition =
+    event.key !== undefined ? resolveKey(event.key) : event.code ? resolveCode(event.code) : null;
+  if (!definition) {
+    if (event.key === undefined) {
+      return false;
+    }
+    event.code ??= "";
+    event.keyCode ??= 0;
+    return true;
+  }
+
+  event.key = definition.key;
+  event.code ??= definition.code;
+  event.keyCode ??= definition.keyCode;
+  if (
+    event.type === "keyDown" &&
+    event.text === undefined &&
+    definition.text &&
+    !((event.modifiers ?? 0) & COMMAND_MODIFIERS)
+  ) {
+    event.text = definition.text;
+  }
+  return true;
+};
+
+/** Opcode of the compact binary mouse move message */
+export const BINARY_MOUSE_MOVE = 0x01;
+const BINARY_MOUSE_MOVE_LENGTH = 10;
+
+/** Opcode of a file upload chunk */
+export const BINARY_FILE_CHUNK = 0x02;
+const BINARY_FILE_CHUNK_HEADER_LENGTH = 5;
+/** Largest content a single upload chunk may carry */
+export const MAX_FILE_CHUNK_BYTES = 256 * 1024;
+
+/**
+ * Parses a binary cast message. Mouse moves are by far the most frequent viewer message, so they
+ * may be sent as 10 bytes instead of JSON: the opcode, x and y as little-endian float32, and the
+ * modifier bitmask. Uploaded files are sent as binary chunks too, to avoid encoding them: the
+ * opcode, the upload id as little-endian uint32, and up to MAX_FILE_CHUNK_BYTES of content.
+ * @returns the parsed message, or null if the message was rejected
+ */
+export const parseBinaryCastMessage = (
+  raw: Uint8Array,
+  viewport: { width: number; height: number },
+): CastMessage | null => {
+  const view = new DataView(raw.buffer, raw.byteOffset, raw.byteLength);
+  if (raw[0] === BINARY_FILE_CHUNK) {
+    if (
+      raw.byteLength <= BINARY_FILE_CHUNK_HEADER_LENGTH ||
+      raw.byteLength > BINARY_FILE_CHUNK_HEADER_LENGTH + MAX_FILE_CHUNK_BYTES
+    ) {
+      return null;
+    }
+    return {
+      type: "fileUploadChunk",
+      pageId: "",
+      uploadId: view.getUint32(1, true),
+      data: raw.subarray(BINARY_FILE_CHUNK_HEADER_LENGTH),
+    };
+  }
+
+  if (raw.byteLength !== BINARY_MOUSE_MOVE_LENGTH || raw[0] !== BINARY_MOUSE_MOVE) {
+    return null;
+  }
+
+  const x = view.getFloat32(1, true);
+  const y = view.getFloat32(5, true);
+  const modifiers = view.getUint8(9);
+  if (!Number.isFinite(x) || !Number.isFinite(y) || modifiers > 15) {
+    return null;
+  }
+
+  return {
+    type: "mouseEvent",
+    pageId: "",
+    event: {
+      type: "mouseMoved",
+      x: clamp(x, 0, Math.max(viewport.width - 1, 0)),
+      y: clamp(y, 0, Math.max(viewport.height - 1, 0)),
+      button: "none",
+      modifiers,
+    },
+  };
+};
+
+const clamp = (value: number, min: number, max: number) => Math.min(Math.max(value, min), max);
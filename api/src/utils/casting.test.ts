@@ -0,0 +1,314 @@
+import { afterEach, beforeEach, describe, expect, it, vi } from "vitest";
+import {
+  AdaptiveQuality,
+  dropFilesIntoPage,
+  gestureToWheelSteps,
+  getTypingTimeoutMs,
+  IdleFrameThrottle,
+  MouseMoveCoalescer,
+  toCdpTouchEvent,
+  typeIntoPage,
+} from "./casting.js";
+
+describe("IdleFrameThrottle", () => {
+  beforeEach(() => {
+    vi.useFakeTimers();
+  });
+
+  afterEach(() => {
+    vi.useRealTimers();
+  });
+
+  it("reports whether a frame changed", () => {
+    const throttle = new IdleFrameThrottle(2, 500);
+
+    expect(throttle.observe("a")).toBe(true);
+    expect(throttle.observe("a")).toBe(false);
+    expect(throttle.observe("b")).toBe(true);
+  });
+
+  it("becomes idle after the threshold of unchanged frames", () => {
+    const throttle = new IdleFrameThrottle(2, 500);
+
+    throttle.observe("a");
+    throttle.observe("a");
+    expect(throttle.isIdle).toBe(false);
+
+    throttle.observe("a");
+    expect(throttle.isIdle).toBe(true);
+
+    throttle.observe("b");
+    expect(throttle.isIdle).toBe(false);
+  });
+
+  it("resolves immediately while active", async () => {
+    const throttle = new IdleFrameThrottle(2, 500);
+    const resolved = vi.fn();
+
+    throttle.observe("a");
+    throttle.wait().then(resolved);
+    await Promise.resolve();
+
+    expect(resolved).toHaveBeenCalled();
+  });
+
+  it("delays while idle until the interval elapses", async () => {
+    const throttle = new IdleFrameThrottle(1, 500);
+    const resolved = vi.fn();
+
+    throttle.observe("a");
+    throttle.observe("a");
+    throttle.wait().then(resolved);
+
+    await vi.advanceTimersByTimeAsync(499);
+    expect(resolved).not.toHaveBeenCalled();
+
+    await vi.advanceTimersByTimeAsync(1);
+    expect(resolved).toHaveBeenCalled();
+  });
+
+  it("releases a pending wait on wake", async () => {
+    const throttle = new IdleFrameThrottle(1, 500);
+    const resolved = vi.fn();
+
+    throttle.observe("a");
+    throttle.observe("a");
+    throttle.wait().then(resolved);
+    throttle.wake();
+    await Promise.resolve();
+
+    expect(resolved).toHaveBeenCalled();
+    expect(throttle.isIdle).toBe(false);
+  });
+});
+
+describe("AdaptiveQuality", () => {
+  it("lowers quality while the send buffer is backed up", () => {
+    const adaptive = new AdaptiveQuality([75, 50, 25], 1000, 3, 100);
+
+    expect(adaptive.observe(5000, 0)).toBe(50);
+    // Changes are rate limited so a single burst does not drop straight to the lowest level
+    expect(adaptive.observe(5000, 50)).toBeNull();
+    expect(adaptive.observe(5000, 100)).toBe(25);
+    expect(adaptive.observe(5000, 200)).toBeNull();
+  });
+
+  it("restores quality after the buffer stays drained", () => {
+    const adaptive = new AdaptiveQuality([75, 50, 25], 1000, 3, 100);
+    adaptive.observe(5000, 0);
+
+    expect(adaptive.observe(0, 200)).toBeNull();
+    expect(adaptive.observe(10, 300)).toBeNull();
+    expect(adaptive.observe(0, 400)).toBeNull();
+    expect(adaptive.observe(0, 500)).toBeNull();
+    expect(adaptive.observe(0, 600)).toBe(75);
+  });
+
+  it("drops to the lowest quality on demand and recovers gradually", () => {
+    const adaptive = new AdaptiveQuality([75, 50, 25], 1000, 1, 100);
+
+    expect(adaptive.degrade(0)).toBe(25);
+    expect(adaptive.degrade(10)).toBeNull();
+    expect(adaptive.observe(0, 50)).toBeNull();
+    expect(adaptive.observe(0, 150)).toBe(50);
+  });
+
+  it("reports saturation well above the congestion threshold", () => {
+    const adaptive = new AdaptiveQuality([75], 1000);
+
+    expect(adaptive.isSaturated(2000)).toBe(false);
+    expect(adaptive.isSaturated(5000)).toBe(true);
+  });
+});
+
+describe("toCdpTouchEvent", () => {
+  const point = { id: 1, x: 10, y: 20 };
+
+  it("passes touch starts and moves through", () => {
+    expect(toCdpTouchEvent({ type: "touchStart", touchPoints: [point], modifiers: 0 })).toEqual({
+      type: "touchStart",
+      touchPoints: [point],
+      modifiers: 0,
+    });
+  });
+
+  it("keeps the remaining touches when one finger is lifted", () => {
+    expect(toCdpTouchEvent({ type: "touchEnd", touchPoints: [point], modifiers: 0 })).toEqual({
+      type: "touchMove",
+      touchPoints: [point],
+      modifiers: 0,
+    });
+    expect(toCdpTouchEvent({ type: "touchEnd", touchPoints: [], modifiers: 0 })).toEqual({
+      type: "touchEnd",
+      touchPoints: [],
+      modifiers: 0,
+    });
+  });
+
+  it("cancels without touch points", () => {
+    expect(toCdpTouchEvent({ type: "touchCancel", touchPoints: [point], modifiers: 8 })).toEqual({
+      type: "touchCancel",
+      touchPoints: [],
+      modifiers: 8,
+    });
+  });
+});
+
+describe("gestureToWheelSteps", () => {
+  it("turns pinches into Ctrl+wheel with the delta Chrome uses", () => {
+    const [zoomIn] = gestureToWheelSteps({ type: "pinch", x: 10, y: 20, scale: Math.E ** 0.1 });
+    expect(zoomIn).toMatchObject({ x: 10, y: 20, deltaX: 0, modifiers: 2 });
+    expect(zoomIn.deltaY).toBeCloseTo(-10);
+
+    const [zoomOut] = gestureToWheelSteps({ type: "pinch", x: 10, y: 20, scale: 0.5 });
+    expect(zoomOut.deltaY).toBeGreaterThan(0);
+  });
+
+  it("splits long scrolls into a few steps", () => {
+    const steps = gestureToWheelSteps({ type: "scroll", x: 0, y: 0, deltaX: 0, deltaY: 100 });
+    expect(steps).toHaveLength(3);
+    expect(steps.reduce((sum, step) => sum + step.deltaY, 0)).toBeCloseTo(100);
+
+    expect(
+      gestureToWheelSteps({ type: "scroll", x: 0, y: 0, deltaX: 5000, deltaY: 0 }),
+    ).toHaveLength(5);
+    expect(gestureToWheelSteps({ type: "scroll", x: 0, y: 0, deltaX: 0, deltaY: 0 })).toEqual([]);
+  });
+});
+
+describe("dropFilesIntoPage", () => {
+  it("drags the files in and drops them at the position", async () => {
+    const send = vi.fn().mockResolvedValue({});
+
+    await dropFilesIntoPage({ send } as any, { x: 10, y: 20, files: ["/files/uploads/a.pdf"] });
+
+    expect(send.mock.calls.map(([, params]) => params.type)).toEqual([
+      "dragEnter",
+      "dragOver",
+      "drop",
+    ]);
+    expect(send).toHaveBeenLastCalledWith("Input.dispatchDragEvent", {
+      type: "drop",
+      x: 10,
+      y: 20,
+      data: { items: [], files: ["/files/uploads/a.pdf"], dragOperationsMask: 1 },
+    });
+  });
+});
+
+describe("typeIntoPage", () => {
+  it("stops before the next character once its signal is aborted", async () => {
+    const controller = new AbortController();
+    const type = vi.fn(async (_text: string) => {
+      if (type.mock.calls.length === 3) {
+        controller.abort(new Error("Timed out"));
+      }
+    });
+    const page = { keyboard: { type } } as any;
+
+    await expect(
+      typeIntoPage(page, "hello", { delayMs: 0, signal: controller.signal }),
+    ).rejects.toThrow("Timed out");
+    expect(type.mock.calls.map(([character]) => character)).toEqual(["h", "e", "l"]);
+  });
+
+  it("reports progress per chunk and once done", async () => {
+    const page = { keyboard: { type: vi.fn(async () => {}) } } as any;
+    const onProgress = vi.fn();
+
+    await typeIntoPage(page, "a".repeat(45), { delayMs: 0, onProgress });
+
+    expect(onProgress.mock.calls).toEqual([
+      [20, 45],
+      [40, 45],
+      [45, 45],
+    ]);
+  });
+});
+
+describe("getTypingTimeoutMs", () => {
+  it("allows for every character at its delay", () => {
+    expect(getTypingTimeoutMs("a".repeat(1000), 10, 5000)).toBe(25_000);
+    expect(getTypingTimeoutMs("😀😀", 1000, 5000)).toBe(7020);
+  });
+
+  it("is capped for very long text", () => {
+    expect(getTypingTimeoutMs("a".repeat(100_000), 1000, 5000)).toBe(5 * 60 * 1000);
+  });
+});
+
+describe("MouseMoveCoalescer", () => {
+  beforeEach(() => {
+    vi.useFakeTimers();
+  });
+
+  afterEach(() => {
+    vi.useRealTimers();
+  });
+
+  const deferredDispatch = () => {
+    const releases: (() => void)[] = [];
+    const dispatch = vi.fn(() => new Promise<void>((resolve) => releases.push(resolve)));
+    return { dispatch, release: () => releases.shift()?.() };
+  };
+
+  it("only dispatches the latest move while one is in flight", async () => {
+    const { dispatch, release } = deferredDispatch();
+    const moves = new MouseMoveCoalescer<number>(dispatch, 0);
+
+    moves.push(1);
+    moves.push(2);
+    moves.push(3);
+    expect(dispatch.mock.calls).toEqual([[1]]);
+
+    release();
+    await vi.runAllTimersAsync();
+    expect(dispatch.mock.calls).toEqual([[1], [3]]);
+  });
+
+  it("dispatches at most one move per interval", async () => {
+    const dispatch = vi.fn().mockResolvedValue(undefined);
+    const moves = new MouseMoveCoalescer<number>(dispatch, 16);
+
+    moves.push(1);
+    await vi.advanceTimersByTimeAsync(5);
+    moves.push(2);
+    moves.push(3);
+    expect(dispatch).toHaveBeenCalledTimes(1);
+
+    await vi.advanceTimersByTimeAsync(11);
+    expect(dispatch.mock.calls).toEqual([[1], [3]]);
+  });
+
+  it("dispatches the waiting move on flush", async () => {
+    const dispatch = vi.fn().mockResolvedValue(undefined);
+    const moves = new MouseMoveCoalescer<number>(dispatch, 1000);
+
+    moves.push(1);
+    moves.push(2);
+    await moves.flush();
+    expect(dispatch.mock.calls).toEqual([[1], [2]]);
+
+    moves.push(3);
+    moves.cancel();
+    await vi.runAllTimersAsync();
+    expect(dispatch).toHaveBeenCalledTimes(2);
+  });
+
+  it("passes dispatch errors on and keeps going", async () => {
+    const onError = vi.fn();
+    const dispatch = vi
+      .fn()
+      .mockRejectedValueOnce(new Error("queue full"))
+      .mockResolvedValue(undefined);
+    const moves = new MouseMoveCoalescer<number>(dispatch, 0, onError);
+
+    moves.push(1);
+    await vi.runAllTimersAsync();
+    moves.push(2);
+    await vi.runAllTimersAsync();
+
+    expect(onError).toHaveBeenCalledWith(new Error("queue full"), 1);
+    expect(dispatch.mock.calls).toEqual([[1], [2]]);
+  });
+});
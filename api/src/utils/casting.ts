@@ -1,5 +1,17 @@
-import { Page } from "puppeteer-core";
-import { NavigationEvent } from "../types/casting.js";
+import { Browser, CDPSession, Page } from "puppeteer-core";
+import {
+  ClipboardContent,
+  ClipboardContentType,
+  GestureEvent,
+  NavigationEvent,
+  PasteResult,
+  ScreencastSettings,
+  TouchEvent,
+  TouchPoint,
+  WindowAction,
+} from "../types/casting.js";
+import { getTargetId } from "./browser.js";
+import { KeyDefinition, MODIFIERS } from "./keymap.js";
 import { normalizeUrl } from "./url.js";
 
 export const navigatePage = async (
@@ -18,6 +30,337 @@ export const navigatePage = async (
   }
 };
 
+/**
+ * Performs a window management action for a page, e.g. to recover a session from a dialog
+ * that blocks the page.
+ * @returns the id of the page that is in the foreground afterwards
+ */
+export const performWindowAction = async (
+  action: WindowAction,
+  browser: Browser,
+  targetPage: Page,
+  targetClient: CDPSession,
+): Promise<string> => {
+  const targetPageId = getTargetId(targetPage);
+
+  switch (action) {
+    case "minimize":
+    case "maximize": {
+      const { windowId } = await targetClient.send("Browser.getWindowForTarget");
+      await targetClient.send("Browser.setWindowBounds", {
+        windowId,
+        bounds: { windowState: action === "minimize" ? "minimized" : "maximized" },
+      });
+      return targetPageId;
+    }
+    case "restore": {
+      const { windowId } = await targetClient.send("Browser.getWindowForTarget");
+      await targetClient.send("Browser.setWindowBounds", {
+        windowId,
+        bounds: { windowState: "normal" },
+      });
+      await targetPage.bringToFront();
+      return targetPageId;
+    }
+    case "nextWindow": {
+      const pages = await browser.pages();
+      const index = pages.findIndex((page) => getTargetId(page) === targetPageId);
+      const nextPage = pages[(index + 1) % pages.length] ?? targetPage;
+      await nextPage.bringToFront();
+      return getTargetId(nextPage);
+    }
+    case "closeDialog": {
+      await targetClient.send("Page.handleJavaScriptDialog", { accept: false });
+      return targetPageId;
+    }
+    default:
+      throw new Error(`Unknown window action: ${action}`);
+  }
+};
+
+/**
+ * Returns the size of the page's visual viewport in CSS pixels, which is the coordinate space
+ * of dispatched input events.
+ */
+export const getViewportSize = async (
+  client: CDPSession,
+): Promise<{ width: number; height: number }> => {
+  const { cssVisualViewport } = await client.send("Page.getLayoutMetrics");
+  return {
+    width: Math.round(cssVisualViewport.clientWidth),
+    height: Math.round(cssVisualViewport.clientHeight),
+  };
+};
+
+/**
+ * Returns the screencast frame encoding for a session.
+ * Screen content mode trades bandwidth for lossless frames so small text stays legible.
+ */
+export const getScreencastSettings = (screenContent?: boolean): ScreencastSettings => {
+  if (screenContent) {
+    return { format: "png" };
+  }
+  return { format: "jpeg", quality: 75 };
+};
+
+/**
+ * Reads the current selection of a page in the requested formats
+ */
+export const getPageSelection = async (
+  page: Page,
+  formats: ClipboardContentType[] = ["text/plain"],
+): Promise<ClipboardContent> => {
+  const includeHtml = formats.includes("text/html");
+  return page.evaluate((includeHtml) => {
+    const selection = window.getSelection();
+    const text = selection ? selection.toString() : "";
+    if (!includeHtml || !selection || selection.rangeCount === 0) {
+      return { text };
+    }
+
+    const container = document.createElement("div");
+    for (let i = 0; i < selection.rangeCount; i++) {
+      container.appendChild(selection.getRangeAt(i).cloneContents());
+    }
+    return { text, html: container.innerHTML };
+  }, includeHtml);
+};
+
+export class ClipboardWriteError extends Error {
+  constructor(
+    public readonly code: "paste_blocked" | "not_editable" | "paste_not_applied" | "dlp_denied",
+    message: string,
+  ) {
+    super(message);
+    this.name = "ClipboardWriteError";
+  }
+}
+
+/**
+ * Pastes content into the focused element of a page.
+ * A paste event carrying both text/plain and text/html is dispatched first so editors can handle
+ * rich content themselves; if nothing cancels it, the content is inserted directly and the
+ * element is read back to confirm the content actually landed.
+ */
+export const pasteIntoPage = async (
+  page: Page,
+  content: ClipboardContent,
+): Promise<PasteResult> => {
+  return page.evaluate(({ text, html }): PasteResult => {
+    const target = (document.activeElement as HTMLElement | null) ?? document.body;
+    const isTextField = target instanceof HTMLInputElement || target instanceof HTMLTextAreaElement;
+    const snapshot = () => (isTextField ? target.value : target.innerHTML);
+    const before = snapshot();
+
+    const data = new DataTransfer();
+    data.setData("text/plain", text);
+    if (html) {
+      data.setData("text/html", html);
+    }
+
+    const event = new ClipboardEvent("paste", {
+      clipboardData: data,
+      bubbles: true,
+      cancelable: true,
+    });
+    if (!target.dispatchEvent(event)) {
+      // The page handled the paste itself, or blocked it if nothing changed
+      return snapshot() !== before ? "pasted" : "blocked";
+    }
+
+    if (!isTextField && !target.isContentEditable) {
+      return "notEditable";
+    }
+
+    if (html && !isTextField) {
+      document.execCommand("insertHTML", false, html);
+    } else {
+      document.execCommand("insertText", false, text);
+    }
+
+    // execCommand fails silently, e.g. on read-only fields or when a handler reverts the input
+    if (isTextField) {
+      return target.value.includes(text) ? "pasted" : "notApplied";
+    }
+    return snapshot() !== before ? "pasted" : "notApplied";
+  }, content);
+};
+
+/**
+ * Brings a page back to the foreground if it has lost focus, e.g. to another tab or a dialog,
+ * so that keyboard input reaches it instead of being dropped.
+ * @returns true if focus had to be restored
+ */
+export const ensurePageFocus = async (page: Page): Promise<boolean> => {
+  const focused = await page.evaluate(() => document.hasFocus()).catch(() => false);
+  if (focused) {
+    return false;
+  }
+
+  await page.bringToFront();
+  await page.evaluate(() => window.focus()).catch(() => {});
+  return true;
+};
+
+// Characters typed between progress reports
+const TYPE_CHUNK_SIZE = 20;
+// Time the key events of a character take on top of its delay
+const TYPE_KEY_OVERHEAD_MS = 10;
+const MAX_TYPING_MS = 5 * 60 * 1000;
+
+/**
+ * How long typing text may take before it is cancelled: baseMs plus enough for every character at
+ * the given delay, at most MAX_TYPING_MS
+ */
+export const getTypingTimeoutMs = (text: string, delayMs: number, baseMs: number): number =>
+  Math.min(MAX_TYPING_MS, baseMs + Array.from(text).length * (delayMs + TYPE_KEY_OVERHEAD_MS));
+
+/**
+ * Types text into the focused element one character at a time, reporting progress after each
+ * chunk. Returning false from onProgress stops typing early, and an aborted signal stops it before
+ * the next character with the signal's reason.
+ */
+export const typeIntoPage = async (
+  page: Page,
+  text: string,
+  options: {
+    delayMs?: number;
+    onProgress?: (typed: number, total: number) => boolean | void;
+    signal?: AbortSignal;
+  } = {},
+): Promise<void> => {
+  const { delayMs = 10, onProgress, signal } = options;
+  // Split by code point so surrogate pairs (emoji, etc.) are never broken apart
+  const characters = Array.from(text);
+
+  for (let typed = 0; typed < characters.length; ) {
+    signal?.throwIfAborted();
+    await page.keyboard.type(characters[typed], { delay: delayMs });
+    typed++;
+
+    if (
+      (typed % TYPE_CHUNK_SIZE === 0 || typed === characters.length) &&
+      onProgress?.(typed, characters.length) === false
+    ) {
+      return;
+    }
+  }
+};
+
+/**
+ * Maps viewer touch input to Input.dispatchTouchEvent. CDP releases touch points missing from a
+ * touchStart or touchMove, and touchEnd and touchCancel must not carry any, so lifting one finger
+ * while others stay down becomes a touchMove with the remaining ones.
+ */
+export const toCdpTouchEvent = (
+  event: TouchEvent["event"],
+): { type: TouchEvent["event"]["type"]; touchPoints: TouchPoint[]; modifiers: number } => {
+  const { touchPoints, modifiers } = event;
+  switch (event.type) {
+    case "touchCancel":
+      return { type: "touchCancel", touchPoints: [], modifiers };
+    case "touchEnd":
+      return touchPoints.length > 0
+        ? { type: "touchMove", touchPoints, modifiers }
+        : { type: "touchEnd", touchPoints: [], modifiers };
+    default:
+      return { type: event.type, touchPoints, modifiers };
+  }
+};
+
+// Wheel events a gesture is split into, so the page animates it instead of jumping
+const MAX_GESTURE_STEPS = 5;
+const GESTURE_STEP_PX = 40;
+
+/**
+ * Translates a two-finger gesture into mouse wheel events. Pinches become Ctrl+wheel, which is how
+ * Chrome reports trackpad pinches to pages, with the delta Chrome derives from the scale. Scrolls
+ * are split into steps of at most GESTURE_STEP_PX.
+ */
+export const gestureToWheelSteps = (
+  event: GestureEvent["event"],
+): { x: number; y: number; deltaX: number; deltaY: number; modifiers: number }[] => {
+  const { deltaX, deltaY, modifiers } =
+    event.type === "pinch"
+      ? { deltaX: 0, deltaY: -100 * Math.log(event.scale), modifiers: MODIFIERS.Control }
+      : { deltaX: event.deltaX, deltaY: event.deltaY, modifiers: 0 };
+
+  const distance = Math.max(Math.abs(deltaX), Math.abs(deltaY));
+  if (distance === 0) {
+    return [];
+  }
+  const steps = Math.min(MAX_GESTURE_STEPS, Math.ceil(distance / GESTURE_STEP_PX));
+  return Array.from({ length: steps }, () => ({
+    x: event.x,
+    y: event.y,
+    deltaX: deltaX / steps,
+    deltaY: deltaY / steps,
+    modifiers,
+  }));
+};
+
+/**
+ * Presses a key with modifiers the way a user would: modifiers go down in order, the key is
+ * pressed and released, and the modifiers are released in reverse order
+ */
+export const pressKeyCombo = async (
+  client: CDPSession,
+  combo: { key: KeyDefinition; modifiers: number },
+): Promise<void> => {
+  const modifierKeys = (["Control", "Alt", "Meta", "Shift"] as const).filter(
+    (name) => combo.modifiers & MODIFIERS[name],
+  );
+  const dispatch = (
+    type: "keyDown" | "keyUp",
+    key: KeyDefinition,
+    modifiers: number,
+    text?: string,
+  ) =>
+    client.send("Input.dispatchKeyEvent", {
+      type,
+      key: key.key,
+      code: key.code,
+      windowsVirtualKeyCode: key.keyCode,
+      nativeVirtualKeyCode: key.keyCode,
+      modifiers,
+      text,
+    });
+
+  let modifiers = 0;
+  for (const name of modifierKeys) {
+    modifiers |= MODIFIERS[name];
+    await dispatch("keyDown", { key: name, code: `${name}Left`, keyCode: 0 }, modifiers);
+  }
+
+  // Shortcuts with Control, Alt or Meta must not also type their character
+  const isShortcut = combo.modifiers & (MODIFIERS.Control | MODIFIERS.Alt | MODIFIERS.Meta);
+  const text = isShortcut
+    ? undefined
+    : (combo.key.text ?? (Array.from(combo.key.key).length === 1 ? combo.key.key : undefined));
+  await dispatch("keyDown", combo.key, modifiers, text);
+  await dispatch("keyUp", combo.key, modifiers);
+
+  for (const name of modifierKeys.reverse()) {
+    modifiers &= ~MODIFIERS[name];
+    await dispatch("keyUp", { key: name, code: `${name}Left`, keyCode: 0 }, modifiers);
+  }
+};
+
+/**
+ * Drops files from the host into the page as if they were dragged in from the desktop. Dropping
+ * on a file input fills it, and drop zones receive the files in their drop event.
+ */
+export const dropFilesIntoPage = async (
+  client: CDPSession,
+  { x, y, files }: { x: number; y: number; files: string[] },
+): Promise<void> => {
+  // 1 allows the copy operation, the only one a drop from outside the browser offers
+  const data = { items: [], files, dragOperationsMask: 1 };
+  for (const type of ["dragEnter", "dragOver", "drop"] as const) {
+    await client.send("Input.dispatchDragEvent", { type, x, y, data });
+  }
+};
+
 export const getPageTitle = async (page: Page): Promise<string> => {
   try {
     return await page.title();
@@ -43,3 +386,222 @@ export const getPageFavicon = async (page: Page): Promise<string | null> => {
     return null;
   }
 };
+
+/**
+ * Coalesces the mouse moves of one connection. While a move is being dispatched, or within the
+ * interval after the last one, newer moves replace the one waiting, so a fast mouse costs at most
+ * one dispatch per interval and the pointer never trails behind a queue of stale positions.
+ */
+export class MouseMoveCoalescer<T> {
+  private pending: T | null = null;
+  private running: Promise<void> | null = null;
+  private timer: NodeJS.Timeout | null = null;
+  private lastDispatchedAt = -Infinity;
+
+  /**
+   * @param dispatch sends a move to the browser; errors are passed to onError with the move
+   */
+  constructor(
+    private readonly dispatch: (move: T) => Promise<void>,
+    private readonly intervalMs: number,
+    private readonly onError: (err: unknown, move: T) => void = () => {},
+  ) {}
+
+  public push(move: T, now: number = Date.now()): void {
+    this.pending = move;
+    if (this.running || this.timer) {
+      return;
+    }
+
+    const wait = this.lastDispatchedAt + this.intervalMs - now;
+    if (wait > 0) {
+      this.timer = setTimeout(() => {
+        this.timer = null;
+        this.drain();
+      }, wait);
+    } else {
+      this.drain();
+    }
+  }
+
+  /**
+   * Dispatches the waiting move right away, e.g. before a click so it lands where the pointer is
+   */
+  public async flush(): Promise<void> {
+    while (this.running) {
+      await this.running;
+    }
+    this.clearTimer();
+    await this.drain();
+  }
+
+  /**
+   * Drops the waiting move, e.g. when the connection closes
+   */
+  public cancel(): void {
+    this.clearTimer();
+    this.pending = null;
+  }
+
+  private drain(): Promise<void> {
+    const move = this.pending;
+    this.pending = null;
+    if (move === null) {
+      return Promise.resolve();
+    }
+
+    this.lastDispatchedAt = Date.now();
+    this.running = this.dispatch(move)
+      .catch((err) => this.onError(err, move))
+      .finally(() => {
+        this.running = null;
+        if (this.pending !== null) {
+          this.push(this.pending);
+        }
+      });
+    return this.running;
+  }
+
+  private clearTimer(): void {
+    if (this.timer) {
+      clearTimeout(this.timer);
+      this.timer = null;
+    }
+  }
+}
+
+/**
+ * Tracks screencast frames and throttles capture while the page is static.
+ *
+ * Chrome only produces the next screencast frame after the previous one is acknowledged, so
+ * delaying acknowledgements once frames stop changing drops the capture rate to roughly
+ * 1000 / idleIntervalMs FPS. Any changed frame or viewer input switches back to full rate.
+ */
+export class IdleFrameThrottle {
+  private lastFrame: string | null = null;
+  private unchangedFrames = 0;
+  private timer: NodeJS.Timeout | null = null;
+  private release: (() => void) | null = null;
+
+  constructor(
+    private readonly idleThreshold = 10,
+    private readonly idleIntervalMs = 500,
+  ) {}
+
+  public get isIdle(): boolean {
+    return this.unchangedFrames >= this.idleThreshold;
+  }
+
+  /**
+   * Records a frame and returns whether it differs from the previous one
+   */
+  public observe(data: string): boolean {
+    const changed = data !== this.lastFrame;
+    this.lastFrame = data;
+    this.unchangedFrames = changed ? 0 : this.unchangedFrames + 1;
+    return changed;
+  }
+
+  /**
+   * Resolves immediately while active, or after the idle interval while idle
+   */
+  public wait(): Promise<void> {
+    if (!this.isIdle) {
+      return Promise.resolve();
+    }
+
+    this.flush();
+    return new Promise((resolve) => {
+      this.release = resolve;
+      this.timer = setTimeout(() => this.flush(), this.idleIntervalMs);
+    });
+  }
+
+  /**
+   * Leaves idle mode and releases any pending wait, e.g. when the viewer sends input
+   */
+  public wake(): void {
+    this.unchangedFrames = 0;
+    this.flush();
+  }
+
+  private flush(): void {
+    if (this.timer) {
+      clearTimeout(this.timer);
+      this.timer = null;
+    }
+    const release = this.release;
+    this.release = null;
+    release?.();
+  }
+}
+
+/**
+ * Adapts screencast JPEG quality to how fast a viewer drains its socket.
+ *
+ * The WebSocket send buffer grows whenever frames are produced faster than the link can carry
+ * them, so it doubles as a bandwidth estimate: quality steps down while the buffer backs up and
+ * steps back up once the buffer has stayed empty for a number of frames.
+ */
+export class AdaptiveQuality {
+  private level = 0;
+  private drainedFrames = 0;
+  private lastChange = Number.NEGATIVE_INFINITY;
+
+  constructor(
+    private readonly levels = [75, 60, 45, 30],
+    private readonly congestedBytes = 512 * 1024,
+    private readonly recoveryFrames = 60,
+    private readonly cooldownMs = 2000,
+  ) {}
+
+  public get quality(): number {
+    return this.levels[this.level];
+  }
+
+  /**
+   * Whether the buffer is so far behind that frames should be dropped until it drains
+   */
+  public isSaturated(bufferedAmount: number): boolean {
+    return bufferedAmount > this.congestedBytes * 4;
+  }
+
+  /**
+   * Records the send buffer size at the time of a frame
+   * @returns the new quality if it should change, otherwise null
+   */
+  public observe(bufferedAmount: number, now = Date.now()): number | null {
+    const canChange = now - this.lastChange >= this.cooldownMs;
+
+    if (bufferedAmount > this.congestedBytes) {
+      this.drainedFrames = 0;
+      if (canChange && this.level < this.levels.length - 1) {
+        return this.setLevel(this.level + 1, now);
+      }
+      return null;
+    }
+
+    this.drainedFrames = bufferedAmount === 0 ? this.drainedFrames + 1 : 0;
+    if (canChange && this.level > 0 && this.drainedFrames >= this.recoveryFrames) {
+      return this.setLevel(this.level - 1, now);
+    }
+    return null;
+  }
+
+  /**
+   * Drops straight to the lowest quality, e.g. when the viewer's network just changed and its
+   * capacity is unknown. Quality recovers step by step once the buffer stays drained.
+   * @returns the new quality, or null if it already is the lowest
+   */
+  public degrade(now = Date.now()): number | null {
+    const lowest = this.levels.length - 1;
+    return this.level < lowest ? this.setLevel(lowest, now) : null;
+  }
+
+  private setLevel(level: number, now: number): number {
+    this.level = level;
+    this.drainedFrames = 0;
+    this.lastChange = now;
+    return this.quality;
+  }
+}
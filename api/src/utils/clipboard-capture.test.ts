@@ -0,0 +1,47 @@
+import { describe, expect, it, vi } from "vitest";
+import { captureClipboard, isCopyCausedBy, parseClipboardCapture } from "./clipboard-capture.js";
+
+describe("parseClipboardCapture", () => {
+  it("returns the captured text and html", () => {
+    expect(parseClipboardCapture(JSON.stringify({ text: "hello", html: "<b>hello</b>" }))).toEqual(
+      { text: "hello", html: "<b>hello</b>" },
+    );
+    expect(parseClipboardCapture(JSON.stringify({ text: "hello" }))).toEqual({ text: "hello" });
+  });
+
+  it("ignores malformed and empty captures", () => {
+    expect(parseClipboardCapture("not json")).toBeNull();
+    expect(parseClipboardCapture("null")).toBeNull();
+    expect(parseClipboardCapture(JSON.stringify({ text: "" }))).toBeNull();
+    expect(parseClipboardCapture(JSON.stringify({ text: 42 }))).toBeNull();
+  });
+});
+
+describe("captureClipboard", () => {
+  it("adds the binding and installs the script in current and future documents", async () => {
+    const client = { send: vi.fn().mockResolvedValue(undefined) };
+
+    await captureClipboard(client as any, "__steelClipboardTest");
+
+    expect(client.send).toHaveBeenCalledWith("Runtime.addBinding", {
+      name: "__steelClipboardTest",
+    });
+    const [, { source }] = client.send.mock.calls.find(
+      ([method]) => method === "Page.addScriptToEvaluateOnNewDocument",
+    )!;
+    expect(source).toContain('"__steelClipboardTest"');
+    expect(client.send).toHaveBeenCalledWith("Runtime.evaluate", { expression: source });
+  });
+});
+
+describe("isCopyCausedBy", () => {
+  it("hands copies to a connection shortly after its input", () => {
+    expect(isCopyCausedBy({ viewOnly: false, lastInputAt: 1_000 }, 2_000, 2_500)).toBe(true);
+    expect(isCopyCausedBy({ viewOnly: false, lastInputAt: 1_000 }, 2_000, 3_500)).toBe(false);
+    expect(isCopyCausedBy({ viewOnly: false, lastInputAt: 0 }, 2_000, 1_000)).toBe(false);
+  });
+
+  it("never hands copies to a view-only connection", () => {
+    expect(isCopyCausedBy({ viewOnly: true, lastInputAt: 1_000 }, 2_000, 1_500)).toBe(false);
+  });
+});
@@ -0,0 +1,166 @@
+import { CDPSession } from "puppeteer-core";
+import { ClipboardContent } from "../types/casting.js";
+
+const MAX_CAPTURED_LENGTH = 1024 * 1024;
+// Set while the server writes to the page clipboard, so the capture does not echo that write
+const CLIPBOARD_WRITING_FLAG = "__steelClipboardWriting";
+
+/**
+ * Reports what the page puts on the clipboard: the content of copy and cut events after the
+ * page's own handlers ran, and text written with navigator.clipboard.writeText. Runs in the main
+ * world so the writeText override is the one the page calls.
+ */
+function installClipboardCapture(options: { bindingName: string; writingFlag: string }): void {
+  const { bindingName, writingFlag } = options;
+  const steelWindow = window as unknown as Window & Record<string, unknown>;
+  const installedFlag = `${bindingName}Installed`;
+  if (steelWindow[installedFlag]) return;
+  Object.defineProperty(steelWindow, installedFlag, {
+    value: true,
+    configurable: false,
+    enumerable: false,
+  });
+
+  const report = (text: string, html?: string) => {
+    // The binding is gone once the connection that installed it closed
+    const binding = steelWindow[bindingName];
+    if (typeof binding === "function" && text && !steelWindow[writingFlag]) {
+      binding(JSON.stringify({ text, html: html || undefined }));
+    }
+  };
+
+  const selectedContent = (): { text: string; html?: string } => {
+    const active = document.activeElement;
+    if (active instanceof HTMLInputElement || active instanceof HTMLTextAreaElement) {
+      return { text: active.value.slice(active.selectionStart ?? 0, active.selectionEnd ?? 0) };
+    }
+
+    const selection = window.getSelection();
+    if (!selection || selection.rangeCount === 0) return { text: "" };
+    const container = document.createElement("div");
+    for (let i = 0; i < selection.rangeCount; i++) {
+      container.appendChild(selection.getRangeAt(i).cloneContents());
+    }
+    return { text: selection.toString(), html: container.innerHTML };
+  };
+
+  // Listening on window runs after handlers on the document, which may replace the content
+  const onCopy = (event: ClipboardEvent) => {
+    if (event.defaultPrevented && event.clipboardData) {
+      report(event.clipboardData.getData("text/plain"), event.clipboardData.getData("text/html"));
+    } else {
+      const { text, html } = selectedContent();
+      report(text, html);
+    }
+  };
+  window.addEventListener("copy", onCopy);
+  window.addEventListener("cut", onCopy);
+
+  const clipboard = navigator.clipboard;
+  if (clipboard && typeof clipboard.writeText === "function") {
+    const writeText = clipboard.writeText.bind(clipboard);
+    clipboard.writeText = (text: string) => {
+      report(String(text));
+      return writeText(text);
+    };
+  }
+}
+
+export function createClipboardCaptureScript(bindingName: string): string {
+  return `(() => { const __name = (fn) => fn; (${installClipboardCapture.toString()})(${JSON.stringify(
+    { bindingName, writingFlag: CLIPBOARD_WRITING_FLAG },
+  )}); })();`;
+}
+
+/**
+ * Starts capturing clipboard writes of the page behind a CDP session. Captures are delivered as
+ * Runtime.bindingCalled events named after the binding, see parseClipboardCapture.
+ */
+export async function captureClipboard(client: CDPSession, bindingName: string): Promise<void> {
+  const source = createClipboardCaptureScript(bindingName);
+  await client.send("Runtime.addBinding", { name: bindingName });
+  await client.send("Page.addScriptToEvaluateOnNewDocument", { source });
+  await client.send("Runtime.evaluate", { expression: source });
+}
+
+/**
+ * Puts content on the page's clipboard through a copy command whose content is replaced, so a
+ * later paste in the page, e.g. Ctrl+V from a viewer, inserts it.
+ */
+function writeClipboard(content: { text: string; html?: string }, writingFlag: string): boolean {
+  const steelWindow = window as unknown as Window & Record<string, unknown>;
+  const onCopy = (event: ClipboardEvent) => {
+    event.clipboardData?.setData("text/plain", content.text);
+    if (content.html) {
+      event.clipboardData?.setData("text/html", content.html);
+    }
+    event.preventDefault();
+    event.stopImmediatePropagation();
+  };
+
+  steelWindow[writingFlag] = true;
+  window.addEventListener("copy", onCopy, true);
+  try {
+    return document.execCommand("copy");
+  } finally {
+    window.removeEventListener("copy", onCopy, true);
+    steelWindow[writingFlag] = false;
+  }
+}
+
+/**
+ * @returns false if the page refused the copy command
+ */
+export async function writePageClipboard(
+  client: CDPSession,
+  content: ClipboardContent,
+): Promise<boolean> {
+  const { result, exceptionDetails } = await client.send("Runtime.evaluate", {
+    expression: `(() => { const __name = (fn) => fn; return (${writeClipboard.toString()})(${JSON.stringify(
+      content,
+    )}, ${JSON.stringify(CLIPBOARD_WRITING_FLAG)}); })()`,
+    // Copy commands are only allowed with user activation
+    userGesture: true,
+    returnByValue: true,
+  });
+  if (exceptionDetails) {
+    throw new Error(`Failed to write the page clipboard: ${exceptionDetails.text}`);
+  }
+  return result.value === true;
+}
+
+export function parseClipboardCapture(payload: string): ClipboardContent | null {
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(payload);
+  } catch {
+    return null;
+  }
+
+  const { text, html } = (parsed ?? {}) as Record<string, unknown>;
+  if (typeof text !== "string" || !text) {
+    return null;
+  }
+  return {
+    text: text.slice(0, MAX_CAPTURED_LENGTH),
+    ...(typeof html === "string" && html ? { html: html.slice(0, MAX_CAPTURED_LENGTH) } : {}),
+  };
+}
+
+/**
+ * Whether a copy the page made is handed to a connection without clipboard sync: only if the
+ * connection dispatched input within the window, as that input could have caused the copy.
+ * View-only connections never dispatch input, so they never get copies this way.
+ * @param lastInputAt when the connection last dispatched input, 0 if it never did
+ */
+export function isCopyCausedBy(
+  connection: { viewOnly: boolean; lastInputAt: number },
+  windowMs: number,
+  now: number = Date.now(),
+): boolean {
+  return (
+    !connection.viewOnly &&
+    connection.lastInputAt > 0 &&
+    now - connection.lastInputAt <= windowMs
+  );
+}
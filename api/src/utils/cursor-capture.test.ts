@@ -0,0 +1,44 @@
+import { describe, expect, it, vi } from "vitest";
+import { captureCursor, parseCursorCapture } from "./cursor-capture.js";
+
+describe("parseCursorCapture", () => {
+  it("returns the position and cursor", () => {
+    expect(parseCursorCapture(JSON.stringify({ x: 10.4, y: 20, cursor: "pointer" }))).toEqual({
+      x: 10,
+      y: 20,
+      cursor: "pointer",
+    });
+  });
+
+  it("shows cursors a viewer cannot draw as the default", () => {
+    expect(
+      parseCursorCapture(JSON.stringify({ x: 1, y: 2, cursor: 'url("evil.png"), auto' })),
+    ).toEqual({ x: 1, y: 2, cursor: "default" });
+    expect(parseCursorCapture(JSON.stringify({ x: 1, y: 2 }))).toEqual({
+      x: 1,
+      y: 2,
+      cursor: "default",
+    });
+  });
+
+  it("ignores malformed captures", () => {
+    expect(parseCursorCapture("not json")).toBeNull();
+    expect(parseCursorCapture("null")).toBeNull();
+    expect(parseCursorCapture(JSON.stringify({ x: "1", y: 2 }))).toBeNull();
+  });
+});
+
+describe("captureCursor", () => {
+  it("adds the binding and installs the script in current and future documents", async () => {
+    const client = { send: vi.fn().mockResolvedValue(undefined) };
+
+    await captureCursor(client as any, "__steelCursorTest");
+
+    expect(client.send).toHaveBeenCalledWith("Runtime.addBinding", { name: "__steelCursorTest" });
+    const [, { source }] = client.send.mock.calls.find(
+      ([method]) => method === "Page.addScriptToEvaluateOnNewDocument",
+    )!;
+    expect(source).toContain('"__steelCursorTest"');
+    expect(client.send).toHaveBeenCalledWith("Runtime.evaluate", { expression: source });
+  });
+});
@@ -0,0 +1,129 @@
+import { CDPSession } from "puppeteer-core";
+
+// Cursors a viewer can draw with CSS, anything else, e.g. a custom image, is shown as the default
+const CURSOR_KEYWORDS = new Set([
+  "default",
+  "none",
+  "context-menu",
+  "help",
+  "pointer",
+  "progress",
+  "wait",
+  "cell",
+  "crosshair",
+  "text",
+  "vertical-text",
+  "alias",
+  "copy",
+  "move",
+  "no-drop",
+  "not-allowed",
+  "grab",
+  "grabbing",
+  "all-scroll",
+  "col-resize",
+  "row-resize",
+  "n-resize",
+  "e-resize",
+  "s-resize",
+  "w-resize",
+  "ne-resize",
+  "nw-resize",
+  "se-resize",
+  "sw-resize",
+  "ew-resize",
+  "ns-resize",
+  "nesw-resize",
+  "nwse-resize",
+  "zoom-in",
+  "zoom-out",
+]);
+
+export type CursorState = { x: number; y: number; cursor: string };
+
+/**
+ * Reports where the mouse is in the page and the cursor the page shows there, at most once per
+ * animation frame. Moves of every source are seen, including automation driving the page over
+ * CDP, which viewers cannot see otherwise since screencast frames never contain the cursor.
+ */
+function installCursorCapture(options: { bindingName: string }): void {
+  const { bindingName } = options;
+  const steelWindow = window as unknown as Window & Record<string, unknown>;
+  const installedFlag = `${bindingName}Installed`;
+  if (steelWindow[installedFlag]) return;
+  Object.defineProperty(steelWindow, installedFlag, {
+    value: true,
+    configurable: false,
+    enumerable: false,
+  });
+
+  let pending: MouseEvent | null = null;
+  const report = () => {
+    const event = pending;
+    pending = null;
+    // The binding is gone once the connection that installed it closed
+    const binding = steelWindow[bindingName];
+    if (!event || typeof binding !== "function") return;
+
+    let cursor = "default";
+    if (event.target instanceof Element) {
+      cursor = getComputedStyle(event.target).cursor;
+      // Auto is the text cursor over text that can be selected and the arrow elsewhere
+      if (cursor === "auto") {
+        const editable =
+          event.target instanceof HTMLInputElement ||
+          event.target instanceof HTMLTextAreaElement ||
+          (event.target instanceof HTMLElement && event.target.isContentEditable);
+        cursor = editable ? "text" : "default";
+      }
+    }
+    binding(JSON.stringify({ x: event.clientX, y: event.clientY, cursor }));
+  };
+
+  window.addEventListener(
+    "mousemove",
+    (event) => {
+      if (!pending) {
+        requestAnimationFrame(report);
+      }
+      pending = event;
+    },
+    { capture: true, passive: true },
+  );
+}
+
+export function createCursorCaptureScript(bindingName: string): string {
+  return `(() => { const __name = (fn) => fn; (${installCursorCapture.toString()})(${JSON.stringify(
+    { bindingName },
+  )}); })();`;
+}
+
+/**
+ * Starts capturing the cursor of the page behind a CDP session. Captures are delivered as
+ * Runtime.bindingCalled events named after the binding, see parseCursorCapture.
+ */
+export async function captureCursor(client: CDPSession, bindingName: string): Promise<void> {
+  const source = createCursorCaptureScript(bindingName);
+  await client.send("Runtime.addBinding", { name: bindingName });
+  await client.send("Page.addScriptToEvaluateOnNewDocument", { source });
+  await client.send("Runtime.evaluate", { expression: source });
+}
+
+export function parseCursorCapture(payload: string): CursorState | null {
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(payload);
+  } catch {
+    return null;
+  }
+
+  const { x, y, cursor } = (parsed ?? {}) as Record<string, unknown>;
+  if (typeof x !== "number" || typeof y !== "number" || !isFinite(x) || !isFinite(y)) {
+    return null;
+  }
+  return {
+    x: Math.round(x),
+    y: Math.round(y),
+    cursor: typeof cursor === "string" && CURSOR_KEYWORDS.has(cursor) ? cursor : "default",
+  };
+}
@@ -0,0 +1,122 @@
+import fs from "fs";
+import { tmpdir } from "os";
+import path from "path";
+import { FastifyBaseLogger } from "fastify";
+import { getBuildInfo } from "./build-info.js";
+
+/**
+ * Exit codes of the server, so supervisors can tell a broken configuration from a crash
+ */
+export const EXIT_CODES = {
+  /** The server could not be set up or could not start listening */
+  startupFailed: 1,
+  /** An exception escaped every handler, the state of the process is unknown */
+  uncaughtException: 70,
+} as const;
+
+export type FatalReason = keyof typeof EXIT_CODES;
+
+const SECRET_KEY_PATTERN = /secret|token|password|passwd|key|credential|auth|jwt/i;
+const REDACTED = "[redacted]";
+
+const redactUrlCredentials = (value: string) => value.replace(/\/\/[^/@\s]+@/g, `//${REDACTED}@`);
+
+/**
+ * Copies a configuration with the values of secret-looking keys replaced, and credentials
+ * removed from URLs, so it can be written to a crash report
+ */
+export const redactConfig = (config: Record<string, unknown>): Record<string, unknown> =>
+  Object.fromEntries(
+    Object.entries(config).map(([key, value]) => {
+      if (value === undefined || value === null || value === "") {
+        return [key, value];
+      }
+      if (SECRET_KEY_PATTERN.test(key)) {
+        return [key, REDACTED];
+      }
+      if (typeof value === "string") {
+        return [key, redactUrlCredentials(value)];
+      }
+      if (Array.isArray(value)) {
+        return [
+          key,
+          value.map((item) => (typeof item === "string" ? redactUrlCredentials(item) : item)),
+        ];
+      }
+      return [key, value];
+    }),
+  );
+
+const serializeError = (err: unknown) =>
+  err instanceof Error
+    ? { name: err.name, message: err.message, stack: err.stack }
+    : { message: String(err) };
+
+/**
+ * Writes what is known about a fatal error to a JSON file: the error and its stack, the build,
+ * the redacted configuration and the state of the process. Runs synchronously since the process
+ * is about to exit.
+ * @returns the path of the report, or null if it could not be written
+ */
+export const writeCrashReport = (
+  reason: FatalReason,
+  err: unknown,
+  config: Record<string, unknown>,
+  directory: string = tmpdir(),
+  now: Date = new Date(),
+): string | null => {
+  const report = {
+    reason,
+    exitCode: EXIT_CODES[reason],
+    time: now.toISOString(),
+    error: serializeError(err),
+    build: getBuildInfo(),
+    config: redactConfig(config),
+    process: {
+      pid: process.pid,
+      uptimeSeconds: process.uptime(),
+      memory: process.memoryUsage(),
+      argv: process.argv,
+    },
+  };
+
+  const file = path.join(directory, `steel-crash-${now.getTime()}-${process.pid}.json`);
+  try {
+    fs.mkdirSync(directory, { recursive: true });
+    fs.writeFileSync(file, JSON.stringify(report, null, 2), { mode: 0o600 });
+    return file;
+  } catch {
+    return null;
+  }
+};
+
+/**
+ * Logs a fatal error, writes a crash report and exits with the code of the reason
+ */
+export const exitOnFatalError = (
+  logger: FastifyBaseLogger,
+  reason: FatalReason,
+  err: unknown,
+  options: { config: Record<string, unknown>; directory?: string },
+): never => {
+  const report = writeCrashReport(reason, err, options.config, options.directory);
+  logger.fatal({ err, reason, exitCode: EXIT_CODES[reason], report }, "Fatal error, exiting");
+  process.exit(EXIT_CODES[reason]);
+};
+
+/**
+ * Exits on uncaught exceptions, whose state cannot be trusted. Rejected promises nobody handled
+ * are logged instead: they come from work of a single request or connection, and taking every
+ * session down for one of them does more harm than the rejection.
+ */
+export const installFatalErrorHandlers = (
+  logger: FastifyBaseLogger,
+  options: { config: Record<string, unknown>; directory?: string },
+): void => {
+  process.on("uncaughtException", (err) => {
+    exitOnFatalError(logger, "uncaughtException", err, options);
+  });
+  process.on("unhandledRejection", (reason) => {
+    logger.error({ err: reason }, "Unhandled promise rejection");
+  });
+};
@@ -0,0 +1,87 @@
+import fs from "fs";
+import { tmpdir } from "os";
+import path from "path";
+import { afterEach, beforeEach, describe, expect, it } from "vitest";
+import { FileUploadReceiver, sanitizeFileName } from "./file-upload.js";
+
+describe("sanitizeFileName", () => {
+  it("keeps only the base name", () => {
+    expect(sanitizeFileName("report.pdf")).toBe("report.pdf");
+    expect(sanitizeFileName("../../etc/passwd")).toBe("passwd");
+    expect(sanitizeFileName("C:\\Users\\me\\notes.txt")).toBe("notes.txt");
+    expect(sanitizeFileName("..")).toBe("upload");
+    expect(sanitizeFileName("a\nb.txt")).toBe("ab.txt");
+  });
+});
+
+describe("FileUploadReceiver", () => {
+  let directory: string;
+
+  beforeEach(async () => {
+    directory = await fs.promises.mkdtemp(path.join(tmpdir(), "file-upload-test-"));
+  });
+
+  afterEach(async () => {
+    await fs.promises.rm(directory, { recursive: true, force: true });
+  });
+
+  it("spools chunks to a temporary file in order", async () => {
+    const receiver = new FileUploadReceiver({ maxBytes: 100, directory });
+    await receiver.start({ uploadId: 1, name: "dir/hello.txt", size: 11, mimeType: "text/plain" });
+
+    await expect(
+      Promise.all([
+        receiver.write(1, Buffer.from("hello ")),
+        receiver.write(1, Buffer.from("world")),
+      ]),
+    ).resolves.toEqual([6, 11]);
+    const file = await receiver.finish(1);
+
+    expect(file).toMatchObject({ name: "hello.txt", size: 11, mimeType: "text/plain" });
+    expect(path.dirname(file.tempPath)).toBe(directory);
+    await expect(fs.promises.readFile(file.tempPath, "utf8")).resolves.toBe("hello world");
+  });
+
+  it("rejects files that are too large or exceed the announced size", async () => {
+    const receiver = new FileUploadReceiver({ maxBytes: 4, directory });
+
+    await expect(receiver.start({ uploadId: 1, name: "a", size: 5 })).rejects.toMatchObject({
+      code: "too_large",
+    });
+
+    await receiver.start({ uploadId: 2, name: "b", size: 2 });
+    await expect(receiver.write(2, Buffer.from("abc"))).rejects.toMatchObject({
+      code: "size_mismatch",
+    });
+    await expect(receiver.write(2, Buffer.from("a"))).rejects.toMatchObject({
+      code: "unknown_upload",
+    });
+    await expect(fs.promises.readdir(directory)).resolves.toEqual([]);
+  });
+
+  it("rejects incomplete uploads", async () => {
+    const receiver = new FileUploadReceiver({ maxBytes: 100, directory });
+    await receiver.start({ uploadId: 1, name: "a", size: 4 });
+    await receiver.write(1, Buffer.from("ab"));
+
+    await expect(receiver.finish(1)).rejects.toMatchObject({ code: "size_mismatch" });
+    await expect(fs.promises.readdir(directory)).resolves.toEqual([]);
+  });
+
+  it("limits uploads in flight and discards them on cancel", async () => {
+    const receiver = new FileUploadReceiver({ maxBytes: 100, maxConcurrent: 2, directory });
+    await receiver.start({ uploadId: 1, name: "a", size: 1 });
+    await receiver.start({ uploadId: 2, name: "b", size: 1 });
+
+    await expect(receiver.start({ uploadId: 1, name: "c", size: 1 })).rejects.toMatchObject({
+      code: "duplicate_upload",
+    });
+    await expect(receiver.start({ uploadId: 3, name: "c", size: 1 })).rejects.toMatchObject({
+      code: "too_many_uploads",
+    });
+
+    await receiver.cancelAll();
+    await expect(fs.promises.readdir(directory)).resolves.toEqual([]);
+    await receiver.start({ uploadId: 3, name: "c", size: 1 });
+  });
+});
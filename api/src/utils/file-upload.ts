@@ -0,0 +1,188 @@
+import fs from "fs";
+import { tmpdir } from "os";
+import path from "path";
+import { v4 as uuidv4 } from "uuid";
+
+/** Most uploads a connection may have in flight at once */
+export const MAX_CONCURRENT_UPLOADS = 4;
+
+export type FileUploadErrorCode =
+  | "too_large"
+  | "too_many_uploads"
+  | "unknown_upload"
+  | "duplicate_upload"
+  | "size_mismatch"
+  | "dlp_denied";
+
+export class FileUploadError extends Error {
+  constructor(
+    public readonly code: FileUploadErrorCode,
+    message: string,
+  ) {
+    super(message);
+    this.name = "FileUploadError";
+  }
+}
+
+export interface ReceivedFile {
+  /** Temporary file holding the content, the caller moves or deletes it */
+  tempPath: string;
+  name: string;
+  size: number;
+  mimeType?: string;
+}
+
+interface Upload {
+  name: string;
+  size: number;
+  mimeType?: string;
+  tempPath: string;
+  received: number;
+  // Chunks are appended one after another even when their messages are handled concurrently
+  writes: Promise<fs.promises.FileHandle>;
+}
+
+/**
+ * Reduces a file name from the viewer to a plain name that cannot leave the upload directory
+ */
+export const sanitizeFileName = (name: string): string => {
+  const base = path.basename(name.replace(/\\/g, "/"));
+  const cleaned = base.replace(/[\x00-\x1f\x7f]/g, "").trim();
+  return cleaned && cleaned !== "." && cleaned !== ".." ? cleaned : "upload";
+};
+
+/**
+ * Collects the files a viewer drops into the live view. The viewer announces each file with its
+ * size, streams the content in order and finishes it; the content is spooled to a temporary file
+ * so it can be checked before it reaches the session's files.
+ */
+export class FileUploadReceiver {
+  private uploads = new Map<number, Upload>();
+
+  constructor(
+    private readonly options: {
+      maxBytes: number;
+      maxConcurrent?: number;
+      directory?: string;
+    },
+  ) {}
+
+  /**
+   * @throws FileUploadError if the file is too large or too many uploads are in flight, or an
+   * error if the temporary file cannot be created
+   */
+  public async start({
+    uploadId,
+    name,
+    size,
+    mimeType,
+  }: {
+    uploadId: number;
+    name: string;
+    size: number;
+    mimeType?: string;
+  }): Promise<void> {
+    if (this.uploads.has(uploadId)) {
+      throw new FileUploadError("duplicate_upload", `Upload ${uploadId} is already in progress`);
+    }
+    if (size > this.options.maxBytes) {
+      throw new FileUploadError("too_large", `Files can be at most ${this.options.maxBytes} bytes`);
+    }
+    if (this.uploads.size >= (this.options.maxConcurrent ?? MAX_CONCURRENT_UPLOADS)) {
+      throw new FileUploadError("too_many_uploads", "Too many uploads in progress");
+    }
+
+    const tempPath = path.join(this.options.directory ?? tmpdir(), `steel-upload-${uuidv4()}`);
+    const upload: Upload = {
+      name: sanitizeFileName(name),
+      size,
+      mimeType,
+      tempPath,
+      received: 0,
+      writes: fs.promises.open(tempPath, "w"),
+    };
+    this.uploads.set(uploadId, upload);
+    try {
+      await upload.writes;
+    } catch (err) {
+      this.uploads.delete(uploadId);
+      throw err;
+    }
+  }
+
+  /**
+   * Appends the next chunk of an upload
+   * @returns how many bytes of the file have been received
+   * @throws FileUploadError if the upload is unknown or the chunk goes past the announced size
+   */
+  public async write(uploadId: number, data: Uint8Array): Promise<number> {
+    const upload = this.getUpload(uploadId);
+    if (upload.received + data.byteLength > upload.size) {
+      await this.cancel(uploadId);
+      throw new FileUploadError("size_mismatch", "Received more data than the announced size");
+    }
+
+    upload.received += data.byteLength;
+    const received = upload.received;
+    upload.writes = upload.writes.then(async (handle) => {
+      await handle.write(data);
+      return handle;
+    });
+    await upload.writes;
+    return received;
+  }
+
+  /**
+   * @throws FileUploadError if the upload is unknown or incomplete
+   */
+  public async finish(uploadId: number): Promise<ReceivedFile> {
+    const upload = this.getUpload(uploadId);
+    this.uploads.delete(uploadId);
+    const handle = await upload.writes;
+    await handle.close();
+
+    if (upload.received !== upload.size) {
+      await fs.promises.rm(upload.tempPath, { force: true });
+      throw new FileUploadError(
+        "size_mismatch",
+        `Received ${upload.received} of ${upload.size} bytes`,
+      );
+    }
+    return {
+      tempPath: upload.tempPath,
+      name: upload.name,
+      size: upload.size,
+      mimeType: upload.mimeType,
+    };
+  }
+
+  /**
+   * Discards an upload and its data, unknown uploads are ignored
+   */
+  public async cancel(uploadId: number): Promise<void> {
+    const upload = this.uploads.get(uploadId);
+    if (!upload) {
+      return;
+    }
+    this.uploads.delete(uploadId);
+    try {
+      const handle = await upload.writes;
+      await handle.close();
+    } catch {
+      // The file could not be opened or written, there is nothing left to close
+    }
+    await fs.promises.rm(upload.tempPath, { force: true });
+  }
+
+  public async cancelAll(): Promise<void> {
+    await Promise.all(Array.from(this.uploads.keys(), (uploadId) => this.cancel(uploadId)));
+  }
+
+  private getUpload(uploadId: number): Upload {
+    const upload = this.uploads.get(uploadId);
+    if (!upload) {
+      throw new FileUploadError("unknown_upload", `No upload ${uploadId} in progress`);
+    }
+    return upload;
+  }
+}
@@ -0,0 +1,26 @@
+import { describe, expect, it } from "vitest";
+import { MAX_SAMPLE_RATE, MIN_SAMPLE_RATE, parseFrameSamplingOptions } from "./frame-sampling.js";
+
+describe("parseFrameSamplingOptions", () => {
+  it("defaults to one JPEG frame per second", () => {
+    expect(parseFrameSamplingOptions({})).toEqual({ rate: 1, format: "jpeg", quality: 80 });
+  });
+
+  it("reads the requested rate, format and quality", () => {
+    expect(parseFrameSamplingOptions({ rate: "0.5", format: "png", quality: "60" })).toEqual({
+      rate: 0.5,
+      format: "png",
+      quality: 60,
+    });
+  });
+
+  it("clamps the rate and ignores invalid values", () => {
+    expect(parseFrameSamplingOptions({ rate: "1000" }).rate).toBe(MAX_SAMPLE_RATE);
+    expect(parseFrameSamplingOptions({ rate: "0.0001" }).rate).toBe(MIN_SAMPLE_RATE);
+    expect(parseFrameSamplingOptions({ rate: "-1", format: "gif", quality: "101" })).toEqual({
+      rate: 1,
+      format: "jpeg",
+      quality: 80,
+    });
+  });
+});
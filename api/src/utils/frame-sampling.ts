@@ -0,0 +1,32 @@
+/** Fastest sample rate a consumer may ask for, in frames per second */
+export const MAX_SAMPLE_RATE = 10;
+/** Slowest sample rate, one frame a minute */
+export const MIN_SAMPLE_RATE = 1 / 60;
+
+export interface FrameSamplingOptions {
+  /** Frames per second */
+  rate: number;
+  format: "jpeg" | "png";
+  /** JPEG quality from 1 to 100, unused for PNG */
+  quality: number;
+}
+
+/**
+ * Reads the sampling options of a frames connection from its query parameters. Missing or
+ * invalid values fall back to one JPEG frame per second at quality 80, and the rate is clamped
+ * to MIN_SAMPLE_RATE..MAX_SAMPLE_RATE.
+ */
+export const parseFrameSamplingOptions = (
+  params: Record<string, string>,
+): FrameSamplingOptions => {
+  const rate = Number(params.rate);
+  const quality = Number(params.quality);
+  return {
+    rate:
+      Number.isFinite(rate) && rate > 0
+        ? Math.min(Math.max(rate, MIN_SAMPLE_RATE), MAX_SAMPLE_RATE)
+        : 1,
+    format: params.format === "png" ? "png" : "jpeg",
+    quality: Number.isInteger(quality) && quality >= 1 && quality <= 100 ? quality : 80,
+  };
+};
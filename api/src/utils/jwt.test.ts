@@ -0,0 +1,85 @@
+import { createHmac, generateKeyPairSync, sign } from "crypto";
+import { afterEach, describe, expect, it, vi } from "vitest";
+import { verifyJwt } from "./jwt.js";
+
+const encode = (value: object) => Buffer.from(JSON.stringify(value)).toString("base64url");
+
+const signHs256 = (claims: object, secret: string) => {
+  const input = `${encode({ alg: "HS256", typ: "JWT" })}.${encode(claims)}`;
+  return `${input}.${createHmac("sha256", secret).update(input).digest("base64url")}`;
+};
+
+describe("verifyJwt", () => {
+  afterEach(() => {
+    vi.unstubAllGlobals();
+  });
+
+  it("verifies HS256 tokens", async () => {
+    const token = signHs256({ sub: "viewer", sessionId: "s1", exp: 2_000 }, "secret");
+
+    await expect(verifyJwt(token, { secret: "secret", now: 1_000_000 })).resolves.toMatchObject({
+      sub: "viewer",
+      sessionId: "s1",
+    });
+  });
+
+  it("rejects tampered, expired and misaddressed tokens", async () => {
+    const token = signHs256({ exp: 2_000, aud: "live-view" }, "secret");
+
+    await expect(verifyJwt(token, { secret: "other", now: 1_000_000 })).rejects.toThrow(
+      "signature",
+    );
+    await expect(verifyJwt(token, { secret: "secret", now: 3_000_000 })).rejects.toThrow(
+      "expired",
+    );
+    await expect(
+      verifyJwt(token, { secret: "secret", audience: "admin", now: 1_000_000 }),
+    ).rejects.toThrow("audience");
+    await expect(verifyJwt("not-a-token", { secret: "secret" })).rejects.toThrow("Malformed");
+  });
+
+  it("rejects tokens that never expire", async () => {
+    const token = signHs256({ sub: "viewer" }, "secret");
+
+    await expect(verifyJwt(token, { secret: "secret" })).rejects.toThrow("no expiry");
+  });
+
+  it("verifies ES256 tokens against a JWKS", async () => {
+    const { privateKey, publicKey } = generateKeyPairSync("ec", { namedCurve: "P-256" });
+    const jwk = { ...publicKey.export({ format: "jwk" }), kid: "key-1" };
+    vi.stubGlobal(
+      "fetch",
+      vi.fn().mockResolvedValue({ ok: true, json: async () => ({ keys: [jwk] }) }),
+    );
+
+    const claims = { permission: "view", exp: 4_000_000_000 };
+    const input = `${encode({ alg: "ES256", kid: "key-1" })}.${encode(claims)}`;
+    const signature = sign("sha256", Buffer.from(input), {
+      key: privateKey,
+      dsaEncoding: "ieee-p1363",
+    }).toString("base64url");
+
+    await expect(
+      verifyJwt(`${input}.${signature}`, { jwksUrl: "https://example.com/jwks.json" }),
+    ).resolves.toMatchObject({ permission: "view" });
+  });
+
+  it("refetches the JWKS for unknown keys at most every 30 seconds", async () => {
+    vi.useFakeTimers();
+    const fetchMock = vi.fn().mockResolvedValue({ ok: true, json: async () => ({ keys: [] }) });
+    vi.stubGlobal("fetch", fetchMock);
+    const input = `${encode({ alg: "RS256", kid: "unknown" })}.${encode({ exp: 4_000_000_000 })}`;
+    const verify = () =>
+      verifyJwt(`${input}.c2ln`, { jwksUrl: "https://example.com/rotating.json" });
+
+    await expect(verify()).rejects.toThrow("No key unknown");
+    await expect(verify()).rejects.toThrow("No key unknown");
+    expect(fetchMock).toHaveBeenCalledTimes(1);
+
+    vi.advanceTimersByTime(31_000);
+    await expect(verify()).rejects.toThrow("No key unknown");
+    expect(fetchMock).toHaveBeenCalledTimes(2);
+    expect(fetchMock.mock.calls[0][1].signal).toBeInstanceOf(AbortSignal);
+    vi.useRealTimers();
+  });
+});
@@ -0,0 +1,160 @@
+import { createHmac, createPublicKey, JsonWebKey, KeyObject, timingSafeEqual, verify } from "crypto";
+
+export interface JwtClaims {
+  sub?: string;
+  iss?: string;
+  aud?: string | string[];
+  exp?: number;
+  nbf?: number;
+  [claim: string]: unknown;
+}
+
+export interface JwtVerifyOptions {
+  /** Shared secret for HS256 tokens */
+  secret?: string;
+  /** URL of a JSON Web Key Set for RS256 and ES256 tokens */
+  jwksUrl?: string;
+  audience?: string;
+  issuer?: string;
+  /** Allowed clock skew in seconds */
+  clockTolerance?: number;
+  now?: number;
+}
+
+const JWKS_CACHE_TTL_MS = 10 * 60 * 1000;
+// Tokens with an unknown kid refetch the JWKS at most this often, since anyone can send them
+const JWKS_REFETCH_INTERVAL_MS = 30 * 1000;
+const JWKS_FETCH_TIMEOUT_MS = 5000;
+
+const jwksCache = new Map<string, { keys: Map<string, KeyObject>; fetchedAt: number }>();
+// Fetches in progress, shared by the tokens waiting for them, and when each URL was last fetched
+const jwksFetches = new Map<string, Promise<Map<string, KeyObject>>>();
+const jwksFetchStartedAt = new Map<string, number>();
+
+const decodeSegment = <T>(segment: string): T =>
+  JSON.parse(Buffer.from(segment, "base64url").toString("utf-8"));
+
+async function fetchJwks(jwksUrl: string): Promise<Map<string, KeyObject>> {
+  const response = await fetch(jwksUrl, { signal: AbortSignal.timeout(JWKS_FETCH_TIMEOUT_MS) });
+  if (!response.ok) {
+    throw new Error(`Failed to fetch JWKS from ${jwksUrl}: ${response.status}`);
+  }
+
+  const { keys = [] } = (await response.json()) as { keys?: (JsonWebKey & { kid?: string })[] };
+  const keyObjects = new Map<string, KeyObject>();
+  for (const jwk of keys) {
+    keyObjects.set(jwk.kid ?? "", createPublicKey({ key: jwk, format: "jwk" }));
+  }
+
+  jwksCache.set(jwksUrl, { keys: keyObjects, fetchedAt: Date.now() });
+  return keyObjects;
+}
+
+async function getJwksKey(jwksUrl: string, kid: string = ""): Promise<KeyObject> {
+  const cached = jwksCache.get(jwksUrl);
+  let keys = cached?.keys;
+
+  // Refetch when the cache is stale or the key may have been rotated in after the last fetch. A
+  // failed fetch falls back to the keys already known.
+  const stale = !cached || Date.now() - cached.fetchedAt > JWKS_CACHE_TTL_MS;
+  if (stale || !keys?.has(kid)) {
+    let fetching = jwksFetches.get(jwksUrl);
+    const lastFetch = jwksFetchStartedAt.get(jwksUrl) ?? -Infinity;
+    if (!fetching && Date.now() - lastFetch > JWKS_REFETCH_INTERVAL_MS) {
+      jwksFetchStartedAt.set(jwksUrl, Date.now());
+      fetching = fetchJwks(jwksUrl).finally(() => jwksFetches.delete(jwksUrl));
+      jwksFetches.set(jwksUrl, fetching);
+    }
+    if (fetching) {
+      const known = keys;
+      keys = await fetching.catch((err) => {
+        if (!known) {
+          throw err;
+        }
+        return known;
+      });
+    }
+  }
+  if (!keys) {
+    throw new Error("JWKS is not available yet");
+  }
+
+  const key = keys.get(kid) ?? (kid ? undefined : keys.values().next().value);
+  if (!key) {
+    throw new Error(`No key ${kid} in JWKS`);
+  }
+  return key;
+}
+
+/**
+ * Signs claims as a compact HS256 token
+ */
+export function signJwt(claims: JwtClaims, secret: string): string {
+  const encode = (value: object) => Buffer.from(JSON.stringify(value)).toString("base64url");
+  const signingInput = `${encode({ alg: "HS256", typ: "JWT" })}.${encode(claims)}`;
+  const signature = createHmac("sha256", secret).update(signingInput).digest("base64url");
+  return `${signingInput}.${signature}`;
+}
+
+/**
+ * Verifies a compact JWS token and its registered claims. Tokens must expire, one without an exp
+ * claim would grant access for good.
+ * Supports HS256 with a shared secret, and RS256/ES256 with keys from a JWKS URL.
+ * @throws if the token is malformed, has an invalid signature or fails a claim check
+ */
+export async function verifyJwt(token: string, options: JwtVerifyOptions): Promise<JwtClaims> {
+  const segments = token.split(".");
+  if (segments.length !== 3) {
+    throw new Error("Malformed token");
+  }
+
+  const [encodedHeader, encodedPayload, encodedSignature] = segments;
+  const header = decodeSegment<{ alg?: string; kid?: string }>(encodedHeader);
+  const claims = decodeSegment<JwtClaims>(encodedPayload);
+  const signingInput = `${encodedHeader}.${encodedPayload}`;
+  const signature = Buffer.from(encodedSignature, "base64url");
+
+  let valid = false;
+  if (header.alg === "HS256" && options.secret) {
+    const expected = createHmac("sha256", options.secret).update(signingInput).digest();
+    valid = expected.length === signature.length && timingSafeEqual(expected, signature);
+  } else if ((header.alg === "RS256" || header.alg === "ES256") && options.jwksUrl) {
+    const key = await getJwksKey(options.jwksUrl, header.kid);
+    valid = verify(
+      "sha256",
+      Buffer.from(signingInput),
+      // JWS encodes ECDSA signatures as raw r || s rather than DER
+      header.alg === "ES256" ? { key, dsaEncoding: "ieee-p1363" } : key,
+      signature,
+    );
+  } else {
+    throw new Error(`Unsupported token algorithm ${header.alg}`);
+  }
+
+  if (!valid) {
+    throw new Error("Invalid token signature");
+  }
+
+  const now = Math.floor((options.now ?? Date.now()) / 1000);
+  const tolerance = options.clockTolerance ?? 30;
+  if (typeof claims.exp !== "number") {
+    throw new Error("Token has no expiry");
+  }
+  if (now - tolerance >= claims.exp) {
+    throw new Error("Token has expired");
+  }
+  if (claims.nbf !== undefined && now + tolerance < claims.nbf) {
+    throw new Error("Token is not valid yet");
+  }
+  if (options.issuer && claims.iss !== options.issuer) {
+    throw new Error("Token issuer mismatch");
+  }
+  if (options.audience) {
+    const audiences = Array.isArray(claims.aud) ? claims.aud : [claims.aud];
+    if (!audiences.includes(options.audience)) {
+      throw new Error("Token audience mismatch");
+    }
+  }
+
+  return claims;
+}
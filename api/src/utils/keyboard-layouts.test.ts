@@ -0,0 +1,55 @@
+import { describe, expect, it } from "vitest";
+import { applyKeyboardLayout, isKeyboardLayout, KeyboardLayout } from "./keyboard-layouts.js";
+
+describe("applyKeyboardLayout", () => {
+  const translate = (
+    event: { code: string; key?: string; keyCode?: number; modifiers?: number },
+    layout: KeyboardLayout,
+  ) => {
+    const translated: Parameters<typeof applyKeyboardLayout>[0] = { type: "keyDown", ...event };
+    applyKeyboardLayout(translated, layout);
+    return translated;
+  };
+
+  it("gives physical keys the character of the viewer's layout", () => {
+    expect(translate({ code: "KeyQ" }, "fr")).toMatchObject({ key: "a", keyCode: 65, text: "a" });
+    expect(translate({ code: "Digit2", modifiers: 8 }, "uk")).toMatchObject({ key: '"' });
+    expect(translate({ code: "Digit2", modifiers: 8 }, "us")).toMatchObject({ key: "@" });
+  });
+
+  it("falls back to the key code of the US key for characters without one", () => {
+    expect(translate({ code: "Quote" }, "de")).toMatchObject({ key: "ä", keyCode: 222 });
+  });
+
+  it("types AltGr characters instead of pressing Control+Alt", () => {
+    expect(translate({ code: "KeyQ", modifiers: 3 }, "de")).toMatchObject({
+      key: "@",
+      modifiers: 0,
+      text: "@",
+    });
+    expect(translate({ code: "KeyQ", key: "@", keyCode: 81, modifiers: 3 }, "de")).toMatchObject({
+      key: "@",
+      keyCode: 81,
+      modifiers: 0,
+    });
+    // Without an AltGr character on the key, Control+Alt stays a shortcut
+    const shortcut = translate({ code: "KeyT", modifiers: 3 }, "de");
+    expect(shortcut).toMatchObject({ key: "t", modifiers: 3 });
+    expect(shortcut).not.toHaveProperty("text");
+  });
+
+  it("keeps what the viewer sent", () => {
+    expect(translate({ code: "KeyY", key: "y", keyCode: 89 }, "de")).toMatchObject({
+      key: "y",
+      keyCode: 89,
+    });
+  });
+});
+
+describe("isKeyboardLayout", () => {
+  it("accepts supported layouts only", () => {
+    expect(isKeyboardLayout("de")).toBe(true);
+    expect(isKeyboardLayout("dvorak")).toBe(false);
+    expect(isKeyboardLayout(null)).toBe(false);
+  });
+});
@@ -0,0 +1,148 @@
+import { MODIFIERS, resolveKey } from "./keymap.js";
+
+export const KEYBOARD_LAYOUTS = ["us", "uk", "de", "fr"] as const;
+export type KeyboardLayout = (typeof KEYBOARD_LAYOUTS)[number];
+
+// Characters a physical key produces: unshifted, with Shift, and with AltGr
+type LayoutKeys = Record<string, [base: string, shifted: string, altGr?: string]>;
+
+const US: LayoutKeys = {
+  ...Object.fromEntries(
+    Array.from("abcdefghijklmnopqrstuvwxyz", (letter) => [
+      `Key${letter.toUpperCase()}`,
+      [letter, letter.toUpperCase()],
+    ]),
+  ),
+  ...Object.fromEntries(
+    Array.from(")!@#$%^&*(", (shifted, digit) => [`Digit${digit}`, [`${digit}`, shifted]]),
+  ),
+  Minus: ["-", "_"],
+  Equal: ["=", "+"],
+  BracketLeft: ["[", "{"],
+  BracketRight: ["]", "}"],
+  Backslash: ["\\", "|"],
+  Semicolon: [";", ":"],
+  Quote: ["'", '"'],
+  Comma: [",", "<"],
+  Period: [".", ">"],
+  Slash: ["/", "?"],
+  Backquote: ["`", "~"],
+};
+
+// Other layouts only list the keys that differ from US. Dead keys are left out, they produce no
+// character by themselves.
+const LAYOUTS: Record<KeyboardLayout, LayoutKeys> = {
+  us: {},
+  uk: {
+    Digit2: ["2", '"'],
+    Digit3: ["3", "£"],
+    Digit4: ["4", "$", "€"],
+    Quote: ["'", "@"],
+    Backslash: ["#", "~"],
+    Backquote: ["`", "¬", "¦"],
+    IntlBackslash: ["\\", "|"],
+  },
+  de: {
+    KeyY: ["z", "Z"],
+    KeyZ: ["y", "Y"],
+    KeyQ: ["q", "Q", "@"],
+    KeyE: ["e", "E", "€"],
+    KeyM: ["m", "M", "µ"],
+    Digit2: ["2", '"', "²"],
+    Digit3: ["3", "§", "³"],
+    Digit6: ["6", "&"],
+    Digit7: ["7", "/", "{"],
+    Digit8: ["8", "(", "["],
+    Digit9: ["9", ")", "]"],
+    Digit0: ["0", "=", "}"],
+    Minus: ["ß", "?", "\\"],
+    BracketLeft: ["ü", "Ü"],
+    BracketRight: ["+", "*", "~"],
+    Semicolon: ["ö", "Ö"],
+    Quote: ["ä", "Ä"],
+    Backslash: ["#", "'"],
+    Comma: [",", ";"],
+    Period: [".", ":"],
+    Slash: ["-", "_"],
+    IntlBackslash: ["<", ">", "|"],
+  },
+  fr: {
+    KeyQ: ["a", "A"],
+    KeyA: ["q", "Q"],
+    KeyW: ["z", "Z"],
+    KeyZ: ["w", "W"],
+    KeyE: ["e", "E", "€"],
+    KeyM: [",", "?"],
+    Semicolon: ["m", "M"],
+    Digit1: ["&", "1"],
+    Digit2: ["é", "2", "~"],
+    Digit3: ['"', "3", "#"],
+    Digit4: ["'", "4", "{"],
+    Digit5: ["(", "5", "["],
+    Digit6: ["-", "6", "|"],
+    Digit7: ["è", "7", "`"],
+    Digit8: ["_", "8", "\\"],
+    Digit9: ["ç", "9", "^"],
+    Digit0: ["à", "0", "@"],
+    Minus: [")", "°", "]"],
+    Equal: ["=", "+", "}"],
+    BracketRight: ["$", "£", "¤"],
+    Quote: ["ù", "%"],
+    Backslash: ["*", "µ"],
+    Comma: [";", "."],
+    Period: [":", "/"],
+    Slash: ["!", "§"],
+    Backquote: ["²", "²"],
+    IntlBackslash: ["<", ">"],
+  },
+};
+
+const ALT_GR = MODIFIERS.Control | MODIFIERS.Alt;
+
+export const isKeyboardLayout = (name: unknown): name is KeyboardLayout =>
+  typeof name === "string" && (KEYBOARD_LAYOUTS as readonly string[]).includes(name);
+
+/**
+ * Translates a viewer's key event from the viewer's keyboard layout before it is dispatched. The
+ * code names the physical key the viewer pressed, so events that only carry a code get the key of
+ * that position on the viewer's layout rather than on US. Characters typed with AltGr arrive with
+ * Control and Alt held, which Chrome would treat as a shortcut, so those modifiers are dropped
+ * when the layout says the key types a character with AltGr.
+ */
+export function applyKeyboardLayout(
+  event: {
+    type: string;
+    key?: string;
+    code?: string;
+    keyCode?: number;
+    text?: string;
+    modifiers?: number;
+  },
+  layout: KeyboardLayout,
+): void {
+  const characters = event.code ? (LAYOUTS[layout][event.code] ?? US[event.code]) : undefined;
+  if (!characters || event.type === "char") {
+    return;
+  }
+
+  const [base, shifted, altGr] = characters;
+  const modifiers = event.modifiers ?? 0;
+  const typesAltGr = !!altGr && (modifiers & ALT_GR) === ALT_GR;
+  const character = typesAltGr ? altGr : modifiers & MODIFIERS.Shift ? shifted : base;
+
+  if (typesAltGr && (event.key === undefined || event.key === altGr)) {
+    event.modifiers = modifiers & ~ALT_GR;
+  }
+  if (event.key === undefined) {
+    event.key = character;
+    if (event.type === "keyDown" && !((event.modifiers ?? 0) & ~MODIFIERS.Shift)) {
+      event.text ??= character;
+    }
+  }
+
+  // Pages read the key code of the character, falling back to that of the US key at the position
+  if (event.keyCode === undefined) {
+    const usKey = US[event.code!]?.[0];
+    event.keyCode = resolveKey(event.key)?.keyCode || (usKey && resolveKey(usKey)?.keyCode) || 0;
+  }
+}
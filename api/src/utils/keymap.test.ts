@@ -0,0 +1,55 @@
+import { describe, expect, it } from "vitest";
+import { MODIFIERS, parseKeyCombo, resolveKey } from "./keymap.js";
+
+describe("resolveKey", () => {
+  it("resolves DOM key values and aliases", () => {
+    expect(resolveKey("Enter")).toEqual({ key: "Enter", code: "Enter", keyCode: 13, text: "\r" });
+    expect(resolveKey("esc")).toMatchObject({ key: "Escape", keyCode: 27 });
+    expect(resolveKey("Left")).toMatchObject({ key: "ArrowLeft", code: "ArrowLeft" });
+    expect(resolveKey("space")).toMatchObject({ key: " ", code: "Space", text: " " });
+    expect(resolveKey("F5")).toMatchObject({ key: "F5", keyCode: 116 });
+  });
+
+  it("resolves characters to their US layout key", () => {
+    expect(resolveKey("a")).toEqual({ key: "a", code: "KeyA", keyCode: 65 });
+    expect(resolveKey("A")).toEqual({ key: "A", code: "KeyA", keyCode: 65 });
+    expect(resolveKey("7")).toEqual({ key: "7", code: "Digit7", keyCode: 55 });
+    expect(resolveKey("@")).toEqual({ key: "@", code: "Digit2", keyCode: 50 });
+    expect(resolveKey("?")).toEqual({ key: "?", code: "Slash", keyCode: 191 });
+    expect(resolveKey("é")).toEqual({ key: "é", code: "", keyCode: 0 });
+  });
+
+  it("rejects unknown names", () => {
+    expect(resolveKey("NotAKey")).toBeNull();
+    expect(resolveKey("")).toBeNull();
+  });
+});
+
+describe("parseKeyCombo", () => {
+  it("parses modifiers and the key", () => {
+    expect(parseKeyCombo("Control+Shift+T")).toEqual({
+      key: { key: "T", code: "KeyT", keyCode: 84 },
+      modifiers: MODIFIERS.Control | MODIFIERS.Shift,
+    });
+    expect(parseKeyCombo("ctrl+alt+Delete")).toMatchObject({
+      key: { key: "Delete" },
+      modifiers: MODIFIERS.Control | MODIFIERS.Alt,
+    });
+    expect(parseKeyCombo("Tab")).toMatchObject({ key: { key: "Tab" }, modifiers: 0 });
+  });
+
+  it("accepts + as the key", () => {
+    expect(parseKeyCombo("Control++")).toMatchObject({
+      key: { key: "+", code: "Equal" },
+      modifiers: MODIFIERS.Control,
+    });
+    expect(parseKeyCombo("+")).toMatchObject({ key: { key: "+" }, modifiers: 0 });
+  });
+
+  it("rejects unknown modifiers and keys", () => {
+    expect(parseKeyCombo("Hyper+A")).toBeNull();
+    expect(parseKeyCombo("A+B")).toBeNull();
+    expect(parseKeyCombo("Control+NotAKey")).toBeNull();
+    expect(parseKeyCombo("Control+")).toBeNull();
+  });
+});
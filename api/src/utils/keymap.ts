@@ -0,0 +1,172 @@
+export interface KeyDefinition {
+  key: string;
+  code: string;
+  keyCode: number;
+  /** Text the key inserts, for keys whose key value is not the text itself */
+  text?: string;
+}
+
+/** CDP modifier bits */
+export const MODIFIERS: Record<string, number> = {
+  Alt: 1,
+  Control: 2,
+  Meta: 4,
+  Shift: 8,
+};
+
+const NAMED_KEYS: KeyDefinition[] = [
+  { key: "Enter", code: "Enter", keyCode: 13, text: "\r" },
+  { key: "Tab", code: "Tab", keyCode: 9 },
+  { key: "Backspace", code: "Backspace", keyCode: 8 },
+  { key: "Escape", code: "Escape", keyCode: 27 },
+  { key: "Delete", code: "Delete", keyCode: 46 },
+  { key: "Insert", code: "Insert", keyCode: 45 },
+  { key: "Home", code: "Home", keyCode: 36 },
+  { key: "End", code: "End", keyCode: 35 },
+  { key: "PageUp", code: "PageUp", keyCode: 33 },
+  { key: "PageDown", code: "PageDown", keyCode: 34 },
+  { key: "ArrowLeft", code: "ArrowLeft", keyCode: 37 },
+  { key: "ArrowUp", code: "ArrowUp", keyCode: 38 },
+  { key: "ArrowRight", code: "ArrowRight", keyCode: 39 },
+  { key: "ArrowDown", code: "ArrowDown", keyCode: 40 },
+  { key: "Shift", code: "ShiftLeft", keyCode: 16 },
+  { key: "Control", code: "ControlLeft", keyCode: 17 },
+  { key: "Alt", code: "AltLeft", keyCode: 18 },
+  { key: "Meta", code: "MetaLeft", keyCode: 91 },
+  { key: "CapsLock", code: "CapsLock", keyCode: 20 },
+  { key: "ContextMenu", code: "ContextMenu", keyCode: 93 },
+  { key: " ", code: "Space", keyCode: 32, text: " " },
+  ...Array.from({ length: 12 }, (_, i) => ({
+    key: `F${i + 1}`,
+    code: `F${i + 1}`,
+    keyCode: 112 + i,
+  })),
+];
+
+// Names clients commonly use that are not DOM key values
+const ALIASES: Record<string, string> = {
+  esc: "Escape",
+  return: "Enter",
+  left: "ArrowLeft",
+  right: "ArrowRight",
+  up: "ArrowUp",
+  down: "ArrowDown",
+  del: "Delete",
+  ins: "Insert",
+  pgup: "PageUp",
+  pgdn: "PageDown",
+  space: " ",
+  spacebar: " ",
+  ctrl: "Control",
+  cmd: "Meta",
+  command: "Meta",
+  super: "Meta",
+  win: "Meta",
+  option: "Alt",
+  menu: "ContextMenu",
+};
+
+// US layout punctuation, shifted characters share the code of their unshifted key
+const PUNCTUATION: Record<string, [code: string, keyCode: number]> = {
+  "-": ["Minus", 189],
+  _: ["Minus", 189],
+  "=": ["Equal", 187],
+  "+": ["Equal", 187],
+  "[": ["BracketLeft", 219],
+  "{": ["BracketLeft", 219],
+  "]": ["BracketRight", 221],
+  "}": ["BracketRight", 221],
+  "\\": ["Backslash", 220],
+  "|": ["Backslash", 220],
+  ";": ["Semicolon", 186],
+  ":": ["Semicolon", 186],
+  "'": ["Quote", 222],
+  '"': ["Quote", 222],
+  ",": ["Comma", 188],
+  "<": ["Comma", 188],
+  ".": ["Period", 190],
+  ">": ["Period", 190],
+  "/": ["Slash", 191],
+  "?": ["Slash", 191],
+  "`": ["Backquote", 192],
+  "~": ["Backquote", 192],
+};
+const SHIFTED_DIGITS = ")!@#$%^&*(";
+
+const namedKeys = new Map<string, KeyDefinition>(
+  NAMED_KEYS.map((definition) => [definition.key.toLowerCase(), definition]),
+);
+const namedCodes = new Map<string, KeyDefinition>(
+  NAMED_KEYS.map((definition) => [definition.code, definition]),
+);
+
+/**
+ * Resolves a key name to the values CDP needs to dispatch it. Accepts DOM key values (ArrowLeft,
+ * Escape, " "), common aliases (Esc, Left, Ctrl) and single characters. Characters without a key
+ * on a US layout resolve without a code, and are dispatched as text only.
+ * @returns null for names that are neither a known key nor a single character
+ */
+export function resolveKey(name: string): KeyDefinition | null {
+  const alias = ALIASES[name.toLowerCase()];
+  const named = namedKeys.get((alias ?? name).toLowerCase());
+  // Single characters are case sensitive, "a" and "A" are different keys
+  if (named && (alias || name.length > 1 || name === " ")) {
+    return named;
+  }
+
+  if (Array.from(name).length !== 1) {
+    return null;
+  }
+  if (/^[a-z]$/i.test(name)) {
+    const upper = name.toUpperCase();
+    return { key: name, code: `Key${upper}`, keyCode: upper.charCodeAt(0) };
+  }
+  if (/^[0-9]$/.test(name)) {
+    return { key: name, code: `Digit${name}`, keyCode: name.charCodeAt(0) };
+  }
+  const shiftedDigit = SHIFTED_DIGITS.indexOf(name);
+  if (shiftedDigit !== -1) {
+    return { key: name, code: `Digit${shiftedDigit}`, keyCode: 48 + shiftedDigit };
+  }
+  if (PUNCTUATION[name]) {
+    const [code, keyCode] = PUNCTUATION[name];
+    return { key: name, code, keyCode };
+  }
+  return { key: name, code: "", keyCode: 0 };
+}
+
+/**
+ * Resolves the physical code of a key that does not type a character, e.g. Enter or ShiftRight
+ * @returns null for codes of character keys, which depend on the keyboard layout
+ */
+export function resolveCode(code: string): KeyDefinition | null {
+  const named = namedCodes.get(code) ?? namedCodes.get(code.replace(/Right$/, "Left"));
+  return named ? { ...named, code } : null;
+}
+
+/**
+ * Parses a key combination like "Control+Shift+T" or "ctrl+alt+Delete". The last part is the
+ * key, the others are modifiers; "+" itself can be the key, e.g. "Control++".
+ * @returns null if a modifier or the key is unknown
+ */
+export function parseKeyCombo(combo: string): { key: KeyDefinition; modifiers: number } | null {
+  const plusKey = combo === "+" || combo.endsWith("++");
+  const parts = plusKey ? [...combo.slice(0, -1).split("+").slice(0, -1), "+"] : combo.split("+");
+  const keyName = parts.pop();
+  if (!keyName) {
+    return null;
+  }
+
+  let modifiers = 0;
+  for (const part of parts) {
+    const modifier = resolveKey(part.trim());
+    const bit = modifier ? MODIFIERS[modifier.key] : undefined;
+    if (!bit) {
+      return null;
+    }
+    modifiers |= bit;
+  }
+
+  const key = resolveKey(keyName === " " ? keyName : keyName.trim());
+  return key ? { key, modifiers } : null;
+}
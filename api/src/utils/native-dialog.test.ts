@@ -0,0 +1,118 @@
+import { EventEmitter } from "events";
+import { describe, expect, it, vi } from "vitest";
+import {
+  describeAuthChallenge,
+  describeFileChooser,
+  describeJavaScriptDialog,
+  watchNativeDialogs,
+} from "./native-dialog.js";
+
+const createClient = () => {
+  const client = new EventEmitter() as EventEmitter & { send: ReturnType<typeof vi.fn> };
+  client.send = vi.fn().mockResolvedValue({});
+  return client;
+};
+
+describe("describeJavaScriptDialog", () => {
+  it("titles the dialog after its type", () => {
+    expect(
+      describeJavaScriptDialog({
+        type: "confirm",
+        message: "Delete?",
+        url: "https://example.com/",
+        hasBrowserHandler: true,
+      }),
+    ).toEqual({
+      kind: "javascript",
+      title: "Confirm",
+      dialogType: "confirm",
+      message: "Delete?",
+      url: "https://example.com/",
+    });
+  });
+});
+
+describe("describeAuthChallenge", () => {
+  it("names the origin asking for credentials", () => {
+    expect(
+      describeAuthChallenge({ origin: "https://example.com", scheme: "basic", realm: "Admin" }),
+    ).toEqual({
+      kind: "auth",
+      title: "Sign in to https://example.com",
+      origin: "https://example.com",
+      realm: "Admin",
+      scheme: "basic",
+      source: "Server",
+    });
+    expect(
+      describeAuthChallenge({
+        origin: "http://proxy:8080",
+        scheme: "basic",
+        realm: "",
+        source: "Proxy",
+      }),
+    ).toMatchObject({ title: "Sign in to the proxy http://proxy:8080", source: "Proxy" });
+  });
+});
+
+describe("describeFileChooser", () => {
+  it("tells single from multiple file choosers", () => {
+    expect(
+      describeFileChooser({ frameId: "f1", mode: "selectMultiple", backendNodeId: 1 }),
+    ).toEqual({ kind: "fileChooser", title: "Choose files", multiple: true });
+  });
+});
+
+describe("watchNativeDialogs", () => {
+  it("intercepts file choosers and authentication on navigations", async () => {
+    const client = createClient();
+
+    await watchNativeDialogs(client as any, { onOpened: vi.fn(), onClosed: vi.fn() });
+
+    expect(client.send).toHaveBeenCalledWith("Page.setInterceptFileChooserDialog", {
+      enabled: true,
+    });
+    expect(client.send).toHaveBeenCalledWith("Fetch.enable", {
+      handleAuthRequests: true,
+      patterns: [{ urlPattern: "*", resourceType: "Document", requestStage: "Request" }],
+    });
+  });
+
+  it("reports authentication prompts and leaves them to the default handling", async () => {
+    const client = createClient();
+    const onOpened = vi.fn();
+    await watchNativeDialogs(client as any, { onOpened, onClosed: vi.fn() });
+
+    client.emit("Fetch.requestPaused", { requestId: "r1" });
+    client.emit("Fetch.authRequired", {
+      requestId: "r1",
+      authChallenge: { origin: "https://example.com", scheme: "basic", realm: "" },
+    });
+
+    expect(client.send).toHaveBeenCalledWith("Fetch.continueRequest", { requestId: "r1" });
+    expect(onOpened).toHaveBeenCalledWith(
+      expect.objectContaining({ kind: "auth", title: "Sign in to https://example.com" }),
+    );
+    expect(client.send).toHaveBeenCalledWith("Fetch.continueWithAuth", {
+      requestId: "r1",
+      authChallengeResponse: { response: "Default" },
+    });
+  });
+
+  it("reports file choosers and the closing of JavaScript dialogs", async () => {
+    const client = createClient();
+    const onOpened = vi.fn();
+    const onClosed = vi.fn();
+    await watchNativeDialogs(client as any, { onOpened, onClosed });
+
+    client.emit("Page.fileChooserOpened", { frameId: "f1", mode: "selectSingle" });
+    client.emit("Page.javascriptDialogClosed", { result: true, userInput: "" });
+
+    expect(onOpened).toHaveBeenCalledWith({
+      kind: "fileChooser",
+      title: "Choose a file",
+      multiple: false,
+    });
+    expect(onClosed).toHaveBeenCalledTimes(1);
+  });
+});
@@ -0,0 +1,111 @@
+import type { CDPSession, Protocol } from "puppeteer-core";
+
+/**
+ * A dialog the browser shows outside the page, which the screencast does not capture. The page
+ * looks frozen while one is open, so viewers are told about it.
+ */
+export type NativeDialog =
+  | {
+      kind: "javascript";
+      title: string;
+      /** alert, confirm, prompt or beforeunload */
+      dialogType: string;
+      message: string;
+      url: string;
+    }
+  | {
+      kind: "auth";
+      title: string;
+      origin: string;
+      realm?: string;
+      scheme?: string;
+      /** Whether the server or a proxy asked for credentials */
+      source: "Server" | "Proxy";
+    }
+  | {
+      kind: "fileChooser";
+      title: string;
+      multiple: boolean;
+    };
+
+const JAVASCRIPT_DIALOG_TITLES: Record<string, string> = {
+  alert: "Alert",
+  confirm: "Confirm",
+  prompt: "Prompt",
+  beforeunload: "Leave site?",
+};
+
+export function describeJavaScriptDialog({
+  type,
+  message,
+  url,
+}: Protocol.Page.JavascriptDialogOpeningEvent): NativeDialog {
+  return {
+    kind: "javascript",
+    title: JAVASCRIPT_DIALOG_TITLES[type] ?? "Dialog",
+    dialogType: type,
+    message,
+    url,
+  };
+}
+
+export function describeAuthChallenge({
+  origin,
+  realm,
+  scheme,
+  source,
+}: Protocol.Fetch.AuthChallenge): NativeDialog {
+  const proxy = source === "Proxy";
+  return {
+    kind: "auth",
+    title: proxy ? `Sign in to the proxy ${origin}` : `Sign in to ${origin}`,
+    origin,
+    ...(realm ? { realm } : {}),
+    ...(scheme ? { scheme } : {}),
+    source: proxy ? "Proxy" : "Server",
+  };
+}
+
+export function describeFileChooser({ mode }: Protocol.Page.FileChooserOpenedEvent): NativeDialog {
+  const multiple = mode === "selectMultiple";
+  return { kind: "fileChooser", title: multiple ? "Choose files" : "Choose a file", multiple };
+}
+
+/**
+ * Reports the dialogs a page opens outside itself: JavaScript dialogs, HTTP authentication
+ * prompts and file choosers. Authentication is only seen on navigations, which are paused and
+ * continued right away, and the prompt is left to whoever else handles it, e.g. credentials set
+ * for the session. File choosers are intercepted, as the chooser itself would not be visible to
+ * viewers, who upload files by dropping them onto the page instead.
+ */
+export async function watchNativeDialogs(
+  client: CDPSession,
+  handlers: { onOpened: (dialog: NativeDialog) => void; onClosed: () => void },
+): Promise<void> {
+  client.on("Page.javascriptDialogOpening", (event) => {
+    handlers.onOpened(describeJavaScriptDialog(event));
+  });
+  client.on("Page.javascriptDialogClosed", () => handlers.onClosed());
+  client.on("Page.fileChooserOpened", (event) => {
+    handlers.onOpened(describeFileChooser(event));
+  });
+  client.on("Fetch.requestPaused", ({ requestId }) => {
+    client.send("Fetch.continueRequest", { requestId }).catch(() => {});
+  });
+  client.on("Fetch.authRequired", ({ requestId, authChallenge }) => {
+    handlers.onOpened(describeAuthChallenge(authChallenge));
+    client
+      .send("Fetch.continueWithAuth", {
+        requestId,
+        authChallengeResponse: { response: "Default" },
+      })
+      .catch(() => {});
+  });
+
+  await client.send("Page.enable");
+  await client.send("Page.setInterceptFileChooserDialog", { enabled: true });
+  await client.send("Fetch.enable", {
+    handleAuthRequests: true,
+    patterns: [{ urlPattern: "*", resourceType: "Document", requestStage: "Request" }],
+  });
+}
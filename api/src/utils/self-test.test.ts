@@ -0,0 +1,30 @@
+import net from "node:net";
+import { afterEach, describe, expect, it } from "vitest";
+import { checkTcpPort, parseHostPort } from "./self-test.js";
+
+describe("self-test", () => {
+  let server: net.Server | null = null;
+
+  afterEach(() => {
+    server?.close();
+    server = null;
+  });
+
+  it("detects listening and closed ports", async () => {
+    server = net.createServer();
+    await new Promise<void>((resolve) => server!.listen(0, "127.0.0.1", resolve));
+    const { port } = server.address() as net.AddressInfo;
+
+    expect(await checkTcpPort("127.0.0.1", port, 1000)).toBe(true);
+
+    server.close();
+    server = null;
+    expect(await checkTcpPort("127.0.0.1", port, 1000)).toBe(false);
+  });
+
+  it("parses advertised addresses", () => {
+    expect(parseHostPort("localhost:9223", 80)).toEqual({ host: "localhost", port: 9223 });
+    expect(parseHostPort("example.com", 443)).toEqual({ host: "example.com", port: 443 });
+    expect(parseHostPort("[::1]:3000", 80)).toEqual({ host: "::1", port: 3000 });
+  });
+});
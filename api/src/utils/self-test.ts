@@ -0,0 +1,115 @@
+import net from "node:net";
+import { env } from "../env.js";
+
+export type SelfTestStatus = "pass" | "warn" | "fail";
+
+export interface SelfTestCheck {
+  name: string;
+  status: SelfTestStatus;
+  message: string;
+}
+
+export interface SelfTestResult {
+  ok: boolean;
+  checks: SelfTestCheck[];
+}
+
+/**
+ * Resolves when a TCP connection to host:port succeeds within the timeout
+ */
+export const checkTcpPort = (host: string, port: number, timeoutMs: number): Promise<boolean> =>
+  new Promise((resolve) => {
+    const socket = net.connect({ host, port });
+    const done = (reachable: boolean) => {
+      socket.destroy();
+      resolve(reachable);
+    };
+    socket.setTimeout(timeoutMs, () => done(false));
+    socket.once("connect", () => done(true));
+    socket.once("error", () => done(false));
+  });
+
+/**
+ * Splits a "host:port" address, falling back to the protocol's default port
+ */
+export const parseHostPort = (address: string, defaultPort: number) => {
+  const { hostname, port } = new URL(`tcp://${address}`);
+  return {
+    host: hostname.replace(/^\[|\]$/g, ""),
+    port: port ? parseInt(port, 10) : defaultPort,
+  };
+};
+
+/**
+ * Checks that the ports the API and the CDP proxy listen on are up, and optionally that the
+ * addresses advertised to clients reach them. A wrong port mapping otherwise only shows up as a
+ * live view or CDP connection that never loads.
+ */
+export async function runSelfTest(
+  options: { probe?: boolean; timeoutMs?: number } = {},
+): Promise<SelfTestResult> {
+  const { probe = false, timeoutMs = 3000 } = options;
+  const checks: SelfTestCheck[] = [];
+  const apiPort = parseInt(env.PORT, 10);
+  const cdpPort = parseInt(env.CDP_REDIRECT_PORT, 10);
+
+  checks.push(
+    (await checkTcpPort("127.0.0.1", apiPort, timeoutMs))
+      ? { name: "apiPort", status: "pass", message: `API is listening on port ${apiPort}` }
+      : {
+          name: "apiPort",
+          status: "fail",
+          message: `Nothing is listening on port ${apiPort}, check PORT`,
+        },
+  );
+
+  checks.push(
+    (await checkTcpPort("127.0.0.1", cdpPort, timeoutMs))
+      ? { name: "cdpPort", status: "pass", message: `CDP proxy is listening on port ${cdpPort}` }
+      : {
+          name: "cdpPort",
+          status: "warn",
+          message:
+            `Nothing is listening on CDP_REDIRECT_PORT ${cdpPort}, ` +
+            "direct CDP connections will fail unless they go through the API port",
+        },
+  );
+
+  if (!env.DOMAIN && (env.HOST === "0.0.0.0" || env.HOST === "::")) {
+    checks.push({
+      name: "advertisedAddress",
+      status: "warn",
+      message:
+        `Session URLs advertise ${env.HOST}:${env.PORT}, which clients cannot connect to. ` +
+        "Set DOMAIN to the host and published port clients use to reach the API",
+    });
+  }
+
+  if (probe) {
+    const advertised = [
+      { name: "apiProbe", address: env.DOMAIN ?? `${env.HOST}:${env.PORT}`, variable: "DOMAIN" },
+      {
+        name: "cdpProbe",
+        address: env.CDP_DOMAIN ?? env.DOMAIN ?? `${env.HOST}:${env.CDP_REDIRECT_PORT}`,
+        variable: "CDP_DOMAIN",
+      },
+    ];
+
+    for (const { name, address, variable } of advertised) {
+      const { host, port } = parseHostPort(address, env.USE_SSL ? 443 : 80);
+      checks.push(
+        (await checkTcpPort(host, port, timeoutMs))
+          ? { name, status: "pass", message: `${address} is reachable` }
+          : {
+              name,
+              status: "fail",
+              message:
+                `${address} is not reachable from the API. Check that ${variable} matches the ` +
+                "published port mapping, e.g. the ports section of docker-compose.yml",
+            },
+      );
+    }
+  }
+
+  return { ok: checks.every((check) => check.status !== "fail"), checks };
+}
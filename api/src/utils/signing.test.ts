@@ -0,0 +1,40 @@
+import { describe, expect, it } from "vitest";
+import { signFileClaims, verifyFileSignature } from "./signing.js";
+
+const secret = "test-secret";
+const now = Date.UTC(2025, 0, 1);
+const claims = {
+  sessionId: "7f0c1a52-6a8e-4b8e-9d55-5f1d2f1d6a11",
+  path: "reports/summary.pdf",
+  expires: now / 1000 + 300,
+};
+
+describe("verifyFileSignature", () => {
+  it("accepts a signature for the same claims", () => {
+    const signature = signFileClaims(claims, secret);
+    expect(verifyFileSignature(claims, signature, secret, now)).toBe(true);
+  });
+
+  it("rejects expired claims", () => {
+    const signature = signFileClaims(claims, secret);
+    expect(verifyFileSignature(claims, signature, secret, now + 301_000)).toBe(false);
+  });
+
+  it("rejects a different path", () => {
+    const signature = signFileClaims(claims, secret);
+    expect(
+      verifyFileSignature({ ...claims, path: "reports/other.pdf" }, signature, secret, now),
+    ).toBe(false);
+  });
+
+  it("binds the subject into the signature", () => {
+    const signature = signFileClaims({ ...claims, subject: "alice" }, secret);
+    expect(verifyFileSignature({ ...claims, subject: "alice" }, signature, secret, now)).toBe(true);
+    expect(verifyFileSignature({ ...claims, subject: "bob" }, signature, secret, now)).toBe(false);
+  });
+
+  it("rejects signatures made with another secret", () => {
+    const signature = signFileClaims(claims, "other-secret");
+    expect(verifyFileSignature(claims, signature, secret, now)).toBe(false);
+  });
+});
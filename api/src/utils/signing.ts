@@ -0,0 +1,44 @@
+import { createHmac, randomBytes, timingSafeEqual } from "crypto";
+import { env } from "../env.js";
+
+// Without a configured secret, signed URLs stay valid only for the lifetime of this process
+const defaultSecret = env.FILE_URL_SIGNING_SECRET || randomBytes(32).toString("hex");
+
+export interface SignedFileClaims {
+  sessionId: string;
+  path: string;
+  /** Expiry as a unix timestamp in seconds */
+  expires: number;
+  /** Optional identity of whoever the URL was minted for, recorded in the audit log */
+  subject?: string;
+}
+
+function canonicalize(claims: SignedFileClaims): string {
+  return [claims.sessionId, claims.path, claims.expires, claims.subject ?? ""].join("\n");
+}
+
+/**
+ * Signs file access claims with HMAC-SHA256
+ * @returns The base64url encoded signature
+ */
+export function signFileClaims(claims: SignedFileClaims, secret: string = defaultSecret): string {
+  return createHmac("sha256", secret).update(canonicalize(claims)).digest("base64url");
+}
+
+/**
+ * Verifies a signature against the given claims and checks that it has not expired
+ */
+export function verifyFileSignature(
+  claims: SignedFileClaims,
+  signature: string,
+  secret: string = defaultSecret,
+  now: number = Date.now(),
+): boolean {
+  if (!Number.isFinite(claims.expires) || claims.expires * 1000 < now) {
+    return false;
+  }
+
+  const expected = Buffer.from(signFileClaims(claims, secret));
+  const actual = Buffer.from(signature);
+  return expected.length === actual.length && timingSafeEqual(expected, actual);
+}
@@ -0,0 +1,57 @@
+import { describe, expect, it } from "vitest";
+import {
+  DEFAULT_STREAM_QUALITY,
+  getSessionStreamSettings,
+  isSessionStreamPreset,
+  resolveStreamQuality,
+} from "./stream-quality.js";
+
+describe("resolveStreamQuality", () => {
+  it("uses the settings of a named preset", () => {
+    expect(resolveStreamQuality({ preset: "low" })).toEqual({
+      preset: "low",
+      quality: 40,
+      maxFps: 10,
+      maxBitrateKbps: 1000,
+    });
+    expect(resolveStreamQuality({ preset: "high" })).toEqual(DEFAULT_STREAM_QUALITY);
+  });
+
+  it("turns overrides into a custom quality", () => {
+    expect(resolveStreamQuality({ preset: "medium", maxFps: 5 })).toEqual({
+      preset: "custom",
+      quality: 60,
+      maxFps: 5,
+      maxBitrateKbps: 4000,
+    });
+    expect(resolveStreamQuality({ preset: "custom", maxBitrateKbps: 500 })).toEqual({
+      preset: "custom",
+      quality: 75,
+      maxFps: null,
+      maxBitrateKbps: 500,
+    });
+  });
+
+  it("keeps the preset when overrides are left undefined", () => {
+    expect(resolveStreamQuality({ preset: "low", quality: undefined }).preset).toBe("low");
+  });
+});
+
+describe("getSessionStreamSettings", () => {
+  it("bundles the frame format with the stream quality", () => {
+    expect(getSessionStreamSettings("low-bandwidth")).toEqual({
+      screenContent: false,
+      quality: resolveStreamQuality({ preset: "low" }),
+    });
+    expect(getSessionStreamSettings("sharp-text")).toMatchObject({
+      screenContent: true,
+      quality: { preset: "custom", maxFps: 15 },
+    });
+  });
+
+  it("recognizes preset names only", () => {
+    expect(isSessionStreamPreset("archival")).toBe(true);
+    expect(isSessionStreamPreset("high")).toBe(false);
+    expect(isSessionStreamPreset(undefined)).toBe(false);
+  });
+});
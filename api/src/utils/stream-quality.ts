@@ -0,0 +1,79 @@
+export const STREAM_QUALITY_PRESETS = ["low", "medium", "high", "custom"] as const;
+export type StreamQualityPreset = (typeof STREAM_QUALITY_PRESETS)[number];
+
+export interface StreamQuality {
+  preset: StreamQualityPreset;
+  /** Highest JPEG quality of the screencast, PNG streams ignore it */
+  quality: number;
+  /** Frames per second sent to each connection, null to send every frame the page produces */
+  maxFps: number | null;
+  /** Frame bitrate of each connection, null for no cap */
+  maxBitrateKbps: number | null;
+}
+
+export type StreamQualitySettings = Omit<StreamQuality, "preset">;
+
+// High is what the live view does without a preset
+const PRESETS: Record<Exclude<StreamQualityPreset, "custom">, StreamQualitySettings> = {
+  low: { quality: 40, maxFps: 10, maxBitrateKbps: 1000 },
+  medium: { quality: 60, maxFps: 20, maxBitrateKbps: 4000 },
+  high: { quality: 75, maxFps: null, maxBitrateKbps: null },
+};
+
+export const DEFAULT_STREAM_QUALITY: StreamQuality = { preset: "high", ...PRESETS.high };
+
+/**
+ * Resolves a preset and individual overrides into stream settings. Custom starts from high, and
+ * a named preset with overrides becomes custom.
+ */
+export const resolveStreamQuality = ({
+  preset,
+  ...overrides
+}: { preset: StreamQualityPreset } & Partial<StreamQualitySettings>): StreamQuality => {
+  const defined = Object.fromEntries(
+    Object.entries(overrides).filter(([, value]) => value !== undefined),
+  ) as Partial<StreamQualitySettings>;
+  const base = preset === "custom" ? PRESETS.high : PRESETS[preset];
+  return {
+    ...base,
+    ...defined,
+    preset: Object.keys(defined).length > 0 ? "custom" : preset,
+  };
+};
+
+export const SESSION_STREAM_PRESETS = [
+  "sharp-text",
+  "smooth-motion",
+  "low-bandwidth",
+  "archival",
+] as const;
+export type SessionStreamPreset = (typeof SESSION_STREAM_PRESETS)[number];
+
+export interface SessionStreamSettings {
+  /** Lossless PNG frames instead of JPEG */
+  screenContent: boolean;
+  quality: StreamQuality;
+}
+
+// Bundles of the individual live view settings, picked for a whole session or a viewer token
+const SESSION_PRESETS: Record<SessionStreamPreset, SessionStreamSettings> = {
+  // Lossless frames keep small text legible, the frame rate keeps their bandwidth in check
+  "sharp-text": {
+    screenContent: true,
+    quality: resolveStreamQuality({ preset: "custom", maxFps: 15 }),
+  },
+  // Every frame the page produces, at a quality low enough for the link to keep up
+  "smooth-motion": {
+    screenContent: false,
+    quality: resolveStreamQuality({ preset: "custom", quality: 50 }),
+  },
+  "low-bandwidth": { screenContent: false, quality: resolveStreamQuality({ preset: "low" }) },
+  // Full fidelity for viewers that review the session rather than drive it
+  archival: { screenContent: true, quality: resolveStreamQuality({ preset: "high" }) },
+};
+
+export const isSessionStreamPreset = (value: unknown): value is SessionStreamPreset =>
+  SESSION_STREAM_PRESETS.includes(value as SessionStreamPreset);
+
+export const getSessionStreamSettings = (preset: SessionStreamPreset): SessionStreamSettings =>
+  SESSION_PRESETS[preset];
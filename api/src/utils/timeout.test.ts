@@ -0,0 +1,15 @@
+import { describe, expect, it } from "vitest";
+import { TimeoutError, withTimeout } from "./timeout.js";
+
+describe("withTimeout", () => {
+  it("resolves with the result when the promise settles in time", async () => {
+    await expect(withTimeout(Promise.resolve("done"), 100, "Task")).resolves.toBe("done");
+  });
+
+  it("rejects with a TimeoutError when the promise hangs", async () => {
+    const result = withTimeout(new Promise(() => {}), 10, "Paste");
+
+    await expect(result).rejects.toBeInstanceOf(TimeoutError);
+    await expect(result).rejects.toThrow("Paste timed out after 10ms");
+  });
+});
@@ -0,0 +1,18 @@
+export class TimeoutError extends Error {
+  constructor(label: string, timeoutMs: number) {
+    super(`${label} timed out after ${timeoutMs}ms`);
+    this.name = "TimeoutError";
+  }
+}
+
+/**
+ * Rejects with a TimeoutError if the promise does not settle in time. The underlying operation
+ * is not cancelled, but the caller stops waiting on it.
+ */
+export const withTimeout = <T>(promise: Promise<T>, timeoutMs: number, label: string) => {
+  let timer: NodeJS.Timeout | undefined;
+  const timeout = new Promise<never>((_, reject) => {
+    timer = setTimeout(() => reject(new TimeoutError(label, timeoutMs)), timeoutMs);
+  });
+  return Promise.race([promise, timeout]).finally(() => clearTimeout(timer));
+};
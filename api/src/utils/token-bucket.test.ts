@@ -0,0 +1,33 @@
+import { describe, expect, it } from "vitest";
+import { TokenBucket } from "./token-bucket.js";
+
+describe("TokenBucket", () => {
+  it("allows a burst and then limits to the refill rate", () => {
+    const bucket = new TokenBucket(1000, 1000, 0);
+
+    expect(bucket.tryConsume(600, 0)).toBe(true);
+    expect(bucket.tryConsume(600, 0)).toBe(true);
+    expect(bucket.tryConsume(1, 0)).toBe(false);
+
+    // 200 tokens in debt, refilled after 200ms
+    expect(bucket.msUntilAvailable(0)).toBe(201);
+    expect(bucket.tryConsume(1, 100)).toBe(false);
+    expect(bucket.tryConsume(1, 250)).toBe(true);
+  });
+
+  it("never holds more than the burst size", () => {
+    const bucket = new TokenBucket(1000, 500, 0);
+
+    expect(bucket.tryConsume(500, 10_000)).toBe(true);
+    expect(bucket.tryConsume(1, 10_000)).toBe(false);
+  });
+
+  it("applies a new rate to later refills", () => {
+    const bucket = new TokenBucket(1000, 1000, 0);
+    bucket.tryConsume(1001, 0);
+    bucket.setRate(100);
+
+    expect(bucket.tryConsume(1, 5)).toBe(false);
+    expect(bucket.tryConsume(1, 20)).toBe(true);
+  });
+});
@@ -0,0 +1,54 @@
+/**
+ * Token bucket that caps average throughput while allowing short bursts. A consumer may take more
+ * than is available as long as the bucket is not empty, so a single item larger than the burst
+ * size still gets through and the debt is paid off before the next one.
+ */
+export class TokenBucket {
+  private tokens: number;
+  private updatedAt: number;
+
+  /**
+   * @param ratePerSecond tokens added per second
+   * @param burst maximum number of tokens the bucket holds, defaults to one second's worth
+   */
+  constructor(
+    private ratePerSecond: number,
+    private burst: number = ratePerSecond,
+    now: number = Date.now(),
+  ) {
+    this.tokens = burst;
+    this.updatedAt = now;
+  }
+
+  public setRate(ratePerSecond: number, burst: number = ratePerSecond): void {
+    this.ratePerSecond = ratePerSecond;
+    this.burst = burst;
+    this.tokens = Math.min(this.tokens, burst);
+  }
+
+  /**
+   * @returns false, without consuming anything, if the bucket is empty
+   */
+  public tryConsume(amount: number, now: number = Date.now()): boolean {
+    this.refill(now);
+    if (this.tokens <= 0) {
+      return false;
+    }
+    this.tokens -= amount;
+    return true;
+  }
+
+  /**
+   * Time until tryConsume succeeds again
+   */
+  public msUntilAvailable(now: number = Date.now()): number {
+    this.refill(now);
+    return this.tokens > 0 ? 0 : Math.ceil(((1 - this.tokens) / this.ratePerSecond) * 1000);
+  }
+
+  private refill(now: number): void {
+    const elapsedSeconds = Math.max(0, now - this.updatedAt) / 1000;
+    this.tokens = Math.min(this.burst, this.tokens + elapsedSeconds * this.ratePerSecond);
+    this.updatedAt = now;
+  }
+}
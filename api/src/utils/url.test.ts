@@ -0,0 +1,38 @@
+import { describe, expect, it } from "vitest";
+import { IncomingMessage } from "http";
+import { isLoopbackRequest, redactUrl } from "./url.js";
+
+describe("redactUrl", () => {
+  it("masks credentials in the query string and keeps everything else", () => {
+    expect(
+      redactUrl("/v1/sessions/cast?pageId=p1&apiKey=secret&token=a.b.c&resumeToken=r#top"),
+    ).toBe(
+      "/v1/sessions/cast?pageId=p1&apiKey=[REDACTED]&token=[REDACTED]&resumeToken=[REDACTED]#top",
+    );
+    expect(redactUrl("/v1/files/a.pdf?expires=1&signature=abc")).toBe(
+      "/v1/files/a.pdf?expires=1&signature=[REDACTED]",
+    );
+  });
+
+  it("leaves URLs without credentials untouched", () => {
+    expect(redactUrl("/v1/sessions?mytoken=1")).toBe("/v1/sessions?mytoken=1");
+    expect(redactUrl("/v1/sessions/token")).toBe("/v1/sessions/token");
+  });
+});
+
+describe("isLoopbackRequest", () => {
+  const request = (remoteAddress: string, headers: Record<string, string> = {}) =>
+    ({ headers, socket: { remoteAddress } }) as unknown as IncomingMessage;
+
+  it("accepts requests from this host", () => {
+    expect(isLoopbackRequest(request("127.0.0.1"))).toBe(true);
+    expect(isLoopbackRequest(request("::1"))).toBe(true);
+    expect(isLoopbackRequest(request("::ffff:127.0.0.1"))).toBe(true);
+  });
+
+  it("refuses remote and forwarded requests", () => {
+    expect(isLoopbackRequest(request("10.0.0.5"))).toBe(false);
+    const forwarded = request("127.0.0.1", { "x-forwarded-for": "127.0.0.1" });
+    expect(isLoopbackRequest(forwarded)).toBe(false);
+  });
+});
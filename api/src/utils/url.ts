@@ -1,3 +1,4 @@
+import { IncomingMessage } from "http";
 import { env } from "../env.js";
 
 /**
@@ -61,3 +62,32 @@ export function normalizeUrl(url: string): string | null {
     return null;
   }
 }
+
+// Query parameters that carry credentials, e.g. API keys or live view and signed URL tokens
+const SENSITIVE_QUERY_PARAMS = ["apiKey", "token", "resumeToken", "signature"];
+const SENSITIVE_QUERY_PATTERN = new RegExp(
+  `([?&](?:${SENSITIVE_QUERY_PARAMS.join("|")})=)[^&#]*`,
+  "g",
+);
+
+/**
+ * Masks the values of credential query parameters, so request URLs can be logged or forwarded
+ * @param url A request URL, e.g. /v1/sessions/debug?apiKey=...
+ * @returns The URL with those values replaced by [REDACTED]
+ */
+export function redactUrl(url: string): string {
+  return url.replace(SENSITIVE_QUERY_PATTERN, "$1[REDACTED]");
+}
+
+/**
+ * Whether a request came straight from this host, judged by the socket's peer address rather than
+ * the forwarded address, which a client can set. A request that went through a proxy carries
+ * forwarding headers and is never taken as local, even if the proxy runs on this host.
+ */
+export function isLoopbackRequest(request: IncomingMessage): boolean {
+  if (request.headers["x-forwarded-for"] || request.headers.forwarded) {
+    return false;
+  }
+  const address = request.socket?.remoteAddress ?? "";
+  return address === "::1" || /^127\./.test(address) || /^::ffff:127\./.test(address);
+}
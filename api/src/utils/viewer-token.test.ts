@@ -0,0 +1,43 @@
+import { createHmac } from "crypto";
+import { describe, expect, it } from "vitest";
+import { signJwt } from "./jwt.js";
+import { issueViewerToken, verifyViewerToken } from "./viewer-token.js";
+
+const claims = { sessionId: "s1", viewerId: "v1", permission: "control" as const };
+
+describe("viewer tokens", () => {
+  it("carry the viewer and session until they expire", async () => {
+    const token = issueViewerToken(claims, 60_000, 1_000_000);
+
+    await expect(verifyViewerToken(token, 1_030_000)).resolves.toMatchObject({
+      sub: "v1",
+      sessionId: "s1",
+      permission: "control",
+    });
+    await expect(verifyViewerToken(token, 1_061_000)).resolves.toBeNull();
+  });
+
+  it("carry the caps of the credential the page was opened with", async () => {
+    const token = issueViewerToken(
+      { ...claims, permission: "view", maxBitrateKbps: 500, streamPreset: "low-bandwidth" },
+      60_000,
+      1_000_000,
+    );
+
+    await expect(verifyViewerToken(token, 1_030_000)).resolves.toMatchObject({
+      permission: "view",
+      maxBitrateKbps: 500,
+      streamPreset: "low-bandwidth",
+    });
+  });
+
+  it("are not accepted when signed by anyone else", async () => {
+    const forged = signJwt(
+      { iss: "steel-browser/live-view", sub: "v1", sessionId: "s1", exp: 2_000_000_000 },
+      createHmac("sha256", "guess").digest("hex"),
+    );
+
+    await expect(verifyViewerToken(forged)).resolves.toBeNull();
+    await expect(verifyViewerToken("not-a-token")).resolves.toBeNull();
+  });
+});
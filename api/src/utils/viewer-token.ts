@@ -0,0 +1,54 @@
+import { randomBytes } from "crypto";
+import { JwtClaims, signJwt, verifyJwt } from "./jwt.js";
+
+const VIEWER_TOKEN_ISSUER = "steel-browser/live-view";
+
+// Only this process verifies the tokens, it also served the page they were issued to
+const secret = randomBytes(32).toString("hex");
+
+export interface ViewerTokenClaims {
+  sessionId: string;
+  viewerId: string;
+  permission: "view" | "control";
+  /** Caps of the credential the page was opened with, applied to its sockets as well */
+  maxBitrateKbps?: number;
+  streamPreset?: string;
+}
+
+/**
+ * Issues the token the live view page opens its sockets with, so the page never needs the admin
+ * API key. It only grants live view of one session, as one viewer. Sockets accept it in place of
+ * the credential the page was authorized with, so it must carry everything that credential limits.
+ */
+export function issueViewerToken(
+  { sessionId, viewerId, permission, maxBitrateKbps, streamPreset }: ViewerTokenClaims,
+  ttlMs: number,
+  now: number = Date.now(),
+): string {
+  return signJwt(
+    {
+      iss: VIEWER_TOKEN_ISSUER,
+      sub: viewerId,
+      sessionId,
+      permission,
+      ...(maxBitrateKbps !== undefined ? { maxBitrateKbps } : {}),
+      ...(streamPreset !== undefined ? { streamPreset } : {}),
+      exp: Math.floor((now + ttlMs) / 1000),
+    },
+    secret,
+  );
+}
+
+/**
+ * @returns the claims of a token issued by issueViewerToken, null for any other token
+ */
+export async function verifyViewerToken(
+  token: string,
+  now: number = Date.now(),
+): Promise<JwtClaims | null> {
+  try {
+    return await verifyJwt(token, { secret, issuer: VIEWER_TOKEN_ISSUER, now, clockTolerance: 0 });
+  } catch {
+    return null;
+  }
+}
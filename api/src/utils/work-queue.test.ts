@@ -0,0 +1,87 @@
+import { describe, expect, it } from "vitest";
+import { WorkQueue, WorkQueueFullError, WorkQueueTimeoutError } from "./work-queue.js";
+
+const deferred = () => {
+  let resolve!: () => void;
+  const promise = new Promise<void>((res) => (resolve = res));
+  return { promise, resolve };
+};
+
+describe("WorkQueue", () => {
+  it("limits how many tasks run at once", async () => {
+    const queue = new WorkQueue({ concurrency: 2, maxQueued: 10, timeoutMs: 1000 });
+    const tasks = [deferred(), deferred(), deferred()];
+    const results = tasks.map((task) => queue.run(() => task.promise));
+
+    await Promise.resolve();
+    expect(queue.active).toBe(2);
+    expect(queue.queued).toBe(1);
+
+    tasks.forEach((task) => task.resolve());
+    await Promise.all(results);
+    expect(queue.active).toBe(0);
+    expect(queue.queued).toBe(0);
+  });
+
+  it("rejects tasks once the wait queue is full", async () => {
+    const queue = new WorkQueue({ concurrency: 1, maxQueued: 1, timeoutMs: 1000 });
+    const blocker = deferred();
+    const running = queue.run(() => blocker.promise);
+    const waiting = queue.run(async () => "done");
+
+    await expect(queue.run(async () => "rejected")).rejects.toBeInstanceOf(WorkQueueFullError);
+
+    blocker.resolve();
+    await running;
+    await expect(waiting).resolves.toBe("done");
+  });
+
+  it("times out hung tasks and frees their slot", async () => {
+    const queue = new WorkQueue({ concurrency: 1, maxQueued: 1, timeoutMs: 10 });
+
+    await expect(queue.run(() => new Promise(() => {}))).rejects.toBeInstanceOf(
+      WorkQueueTimeoutError,
+    );
+    await expect(queue.run(async () => "next")).resolves.toBe("next");
+  });
+
+  it("aborts the signal of a task that times out", async () => {
+    const queue = new WorkQueue({ concurrency: 1, maxQueued: 1, timeoutMs: 1000 });
+    let signal: AbortSignal | undefined;
+
+    await expect(
+      queue.run(
+        (taskSignal) => {
+          signal = taskSignal;
+          return new Promise(() => {});
+        },
+        { timeoutMs: 10 },
+      ),
+    ).rejects.toBeInstanceOf(WorkQueueTimeoutError);
+    expect(signal?.aborted).toBe(true);
+    expect(signal?.reason).toBeInstanceOf(WorkQueueTimeoutError);
+  });
+
+  it("counts the time a task waits for a slot towards its timeout", async () => {
+    const queue = new WorkQueue({ concurrency: 1, maxQueued: 1, timeoutMs: 1000 });
+    const blocker = deferred();
+    const running = queue.run(() => blocker.promise);
+    let started = false;
+
+    await expect(
+      queue.run(
+        async () => {
+          started = true;
+        },
+        { timeoutMs: 10 },
+      ),
+    ).rejects.toBeInstanceOf(WorkQueueTimeoutError);
+    expect(queue.queued).toBe(0);
+
+    blocker.resolve();
+    await running;
+    expect(started).toBe(false);
+    expect(queue.active).toBe(0);
+    await expect(queue.run(async () => "next")).resolves.toBe("next");
+  });
+});
@@ -0,0 +1,107 @@
+export class WorkQueueFullError extends Error {
+  constructor(maxQueued: number) {
+    super(`Work queue is full (${maxQueued} tasks waiting)`);
+    this.name = "WorkQueueFullError";
+  }
+}
+
+export class WorkQueueTimeoutError extends Error {
+  constructor(timeoutMs: number) {
+    super(`Task did not complete within ${timeoutMs}ms`);
+    this.name = "WorkQueueTimeoutError";
+  }
+}
+
+export interface WorkQueueOptions {
+  /** Maximum number of tasks running at once */
+  concurrency: number;
+  /** Maximum number of tasks waiting for a slot, further tasks are rejected */
+  maxQueued: number;
+  /**
+   * Time, counted from when a task is queued, after which it is rejected and its slot released.
+   * Time spent waiting for a slot counts, so tasks do not pile up behind a slow one.
+   */
+  timeoutMs: number;
+}
+
+/**
+ * Runs async tasks with bounded concurrency and a bounded wait queue, so a burst of work is
+ * shed instead of piling up without limit.
+ */
+export class WorkQueue {
+  private running = 0;
+  private waiting: (() => void)[] = [];
+
+  constructor(private readonly options: WorkQueueOptions) {}
+
+  public get active(): number {
+    return this.running;
+  }
+
+  public get queued(): number {
+    return this.waiting.length;
+  }
+
+  /**
+   * @param task receives a signal that is aborted when the task times out. Tasks that can stop
+   * part way, e.g. typing text, should check it so they do not outlive their slot.
+   * @param options.timeoutMs overrides the queue's timeout, e.g. for tasks whose duration depends
+   * on their input
+   * @throws WorkQueueFullError if the wait queue is full
+   * @throws WorkQueueTimeoutError if the task does not settle within the timeout, including the
+   * time it waited for a slot. A waiting task is dropped from the queue without running, a
+   * running one has its signal aborted and its slot released, so a hung task does not block the
+   * queue.
+   */
+  public async run<T>(
+    task: (signal: AbortSignal) => Promise<T>,
+    options: { timeoutMs?: number } = {},
+  ): Promise<T> {
+    const timeoutMs = options.timeoutMs ?? this.options.timeoutMs;
+    if (this.running >= this.options.concurrency && this.waiting.length >= this.options.maxQueued) {
+      throw new WorkQueueFullError(this.options.maxQueued);
+    }
+
+    const controller = new AbortController();
+    let timer: NodeJS.Timeout | undefined;
+    const timedOut = new Promise<never>((_, reject) => {
+      timer = setTimeout(() => {
+        const error = new WorkQueueTimeoutError(timeoutMs);
+        controller.abort(error);
+        reject(error);
+      }, timeoutMs);
+    });
+
+    let hasSlot = false;
+    let takeSlot = () => {};
+    const slot = new Promise<void>((resolve) => {
+      takeSlot = () => {
+        hasSlot = true;
+        resolve();
+      };
+    });
+    try {
+      if (this.running >= this.options.concurrency) {
+        // The finishing task hands its slot over directly, so nothing can take it in between
+        this.waiting.push(takeSlot);
+        await Promise.race([slot, timedOut]);
+      } else {
+        this.running++;
+        hasSlot = true;
+      }
+      return await Promise.race([task(controller.signal), timedOut]);
+    } finally {
+      clearTimeout(timer);
+      if (hasSlot) {
+        const next = this.waiting.shift();
+        if (next) {
+          next();
+        } else {
+          this.running--;
+        }
+      } else {
+        this.waiting.splice(this.waiting.indexOf(takeSlot), 1);
+      }
+    }
+  }
+}